@@ -0,0 +1,223 @@
+package anvil
+
+import (
+	"cmp"
+	"math/bits"
+	"slices"
+)
+
+// AllocStrategy the strategy used to find free space for an entry in an anvil file.
+type AllocStrategy byte
+
+// supported strategies
+const (
+	// AllocFirstFit uses the first free space that is large enough to store the entry.
+	AllocFirstFit AllocStrategy = iota
+	// AllocBestFit uses the smallest free space that is large enough to store the entry.
+	AllocBestFit
+	// AllocNextFit is the same as [AllocFirstFit] but starts searching from
+	// where the previous search ended instead of the start of the file.
+	AllocNextFit
+	// AllocSegregated groups free space into size classes and uses the first free space
+	// in the smallest size class that is large enough to store the entry.
+	AllocSegregated
+)
+
+func (s AllocStrategy) String() string {
+	switch s {
+	case AllocFirstFit:
+		return "first-fit"
+	case AllocBestFit:
+		return "best-fit"
+	case AllocNextFit:
+		return "next-fit"
+	case AllocSegregated:
+		return "segregated"
+	default:
+		return "unsupported"
+	}
+}
+
+// sizeClasses the number of size classes used by [AllocSegregated].
+// An entry can use at most 255 sections, so 8 power of two classes are enough.
+const sizeClasses = 8
+
+// hole a run of free sections in an anvil file.
+type hole struct{ offset, size uint }
+
+// freeList free space in an anvil file grouped by size class.
+// The class of a hole is the floor of log2 of its size.
+// The holes in each class are sorted by their offset.
+type freeList [sizeClasses][]hole
+
+// add adds the given hole to the free list.
+func (f *freeList) add(hl hole) {
+	class := &f[sizeClass(hl.size)]
+	i, _ := slices.BinarySearchFunc(*class, hl.offset, compareOffset)
+	*class = slices.Insert(*class, i, hl)
+}
+
+// remove removes the given hole from the free list.
+func (f *freeList) remove(hl hole) {
+	class := &f[sizeClass(hl.size)]
+	if i, found := slices.BinarySearchFunc(*class, hl.offset, compareOffset); found {
+		*class = slices.Delete(*class, i, i+1)
+	}
+}
+
+func compareOffset(hl hole, offset uint) int { return cmp.Compare(hl.offset, offset) }
+
+// sizeClass returns the size class for the given number of sections.
+func sizeClass(size uint) int {
+	if size == 0 {
+		return 0
+	}
+	class := bits.Len(size) - 1
+	if class >= sizeClasses {
+		class = sizeClasses - 1
+	}
+	return class
+}
+
+// nextHole returns the next free space starting at or after `from`.
+// Free space at the end of the file is not returned, since it is not
+// bounded by a used section.
+func (h *Header) nextHole(from uint) (hole, bool) {
+	offset, ok := h.used.NextClear(from)
+	if !ok {
+		return hole{}, false
+	}
+
+	next, ok := h.used.NextSet(offset)
+	if !ok {
+		return hole{}, false
+	}
+
+	return hole{offset: offset, size: next - offset}, true
+}
+
+// firstFit finds the first free space between `start` and `end`
+// that is large enough to store `size` sections.
+// If end is 0, this searches until the end of the file.
+func (h *Header) firstFit(size, start, end uint) (offset uint, found bool) {
+	for hl, ok := h.nextHole(start); ok && (end == 0 || hl.offset < end); hl, ok = h.nextHole(hl.offset + hl.size) {
+		if hl.size >= size {
+			return hl.offset, true
+		}
+	}
+	return 0, false
+}
+
+// bestFit finds the smallest free space that is large enough to store `size` sections.
+func (h *Header) bestFit(size uint) (offset uint, found bool) {
+	var best hole
+	for hl, ok := h.nextHole(2); ok; hl, ok = h.nextHole(hl.offset + hl.size) {
+		if hl.size >= size && (!found || hl.size < best.size) {
+			best, found = hl, true
+			if hl.size == size {
+				break
+			}
+		}
+	}
+	return best.offset, found
+}
+
+// nextFit finds the first free space that is large enough to store `size` sections,
+// starting from where the last search ended.
+func (h *Header) nextFit(size uint) (offset uint, found bool) {
+	start := h.next
+	if start < 2 {
+		start = 2
+	}
+
+	if offset, found = h.firstFit(size, start, 0); !found && start > 2 {
+		offset, found = h.firstFit(size, 2, start)
+	}
+
+	if found {
+		h.next = offset + size
+	}
+	return
+}
+
+// freeStart returns the first section of the free space that contains the unused section at `pos`.
+func (h *Header) freeStart(pos uint) uint {
+	// PreviousSet does not search past the end of the bitset
+	if pos >= h.used.Len() {
+		if h.used.Len() == 0 {
+			return 2
+		}
+		pos = h.used.Len() - 1
+	}
+
+	if prev, ok := h.used.PreviousSet(pos); ok && prev >= 2 {
+		return prev + 1
+	}
+	return 2
+}
+
+// markFree updates the free lists before the sections used by `c` are marked as used.
+// The sections must be unused.
+func (h *Header) markFree(c Entry) {
+	if h.free == nil || c.size == 0 {
+		return
+	}
+
+	start, end := uint(c.offset), uint(c.offset)+uint(c.size)
+	left := h.freeStart(start)
+
+	// the entry splits the hole that contains it.
+	// If the entry is in the free space at the end of the file, the space before it becomes a hole.
+	if right, ok := h.used.NextSet(start); ok {
+		h.free.remove(hole{offset: left, size: right - left})
+		if right > end {
+			h.free.add(hole{offset: end, size: right - end})
+		}
+	}
+	if start > left {
+		h.free.add(hole{offset: left, size: start - left})
+	}
+}
+
+// clearFree updates the free lists after the sections used by `c` were marked as unused.
+func (h *Header) clearFree(c Entry) {
+	if h.free == nil || c.size == 0 {
+		return
+	}
+
+	start, end := uint(c.offset), uint(c.offset)+uint(c.size)
+	left := h.freeStart(start)
+
+	// the freed space is merged with the holes next to it
+	if start > left {
+		h.free.remove(hole{offset: left, size: start - left})
+	}
+	if right, ok := h.used.NextSet(end); ok {
+		if right > end {
+			h.free.remove(hole{offset: end, size: right - end})
+		}
+		h.free.add(hole{offset: left, size: right - left})
+	}
+}
+
+// segregatedFit finds free space using the free lists.
+// The free lists are built from the `used` bitset when they are first used
+// and are kept up to date when space is marked as used or unused.
+func (h *Header) segregatedFit(size uint) (offset uint, found bool) {
+	if h.free == nil {
+		h.free = &freeList{}
+		for hl, ok := h.nextHole(2); ok; hl, ok = h.nextHole(hl.offset + hl.size) {
+			class := sizeClass(hl.size)
+			h.free[class] = append(h.free[class], hl)
+		}
+	}
+
+	for class := sizeClass(size); class < sizeClasses; class++ {
+		for _, hl := range h.free[class] {
+			if hl.size >= size {
+				return hl.offset, true
+			}
+		}
+	}
+	return 0, false
+}
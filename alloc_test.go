@@ -0,0 +1,166 @@
+package anvil
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/spf13/afero/mem"
+	"github.com/yehan2002/is/v2"
+)
+
+var allocStrategies = []AllocStrategy{AllocFirstFit, AllocBestFit, AllocNextFit, AllocSegregated}
+
+type allocTest struct{}
+
+func TestAlloc(t *testing.T) { is.SuiteP(t, &allocTest{}) }
+
+// makeHoles creates a header with free space of sizes 4, 2 and 3 at offsets 3, 8 and 11.
+func (*allocTest) makeHoles() *Header {
+	h := makeHeader()
+	for _, used := range []uint{2, 7, 10, 14} {
+		h.used.Set(used)
+	}
+	return h
+}
+
+func (a *allocTest) TestFirstFit(is is.Is) {
+	h := a.makeHoles()
+	h.SetStrategy(AllocFirstFit)
+
+	offset, found := h.FindSpace(2)
+	is(found && offset == 3, "incorrect offset returned: %d", offset)
+	offset, found = h.FindSpace(4)
+	is(found && offset == 3, "incorrect offset returned: %d", offset)
+	_, found = h.FindSpace(5)
+	is(!found, "found space for an entry that does not fit")
+}
+
+func (a *allocTest) TestBestFit(is is.Is) {
+	h := a.makeHoles()
+	h.SetStrategy(AllocBestFit)
+
+	offset, found := h.FindSpace(2)
+	is(found && offset == 8, "incorrect offset returned: %d", offset)
+	offset, found = h.FindSpace(3)
+	is(found && offset == 11, "incorrect offset returned: %d", offset)
+	offset, found = h.FindSpace(4)
+	is(found && offset == 3, "incorrect offset returned: %d", offset)
+	_, found = h.FindSpace(5)
+	is(!found, "found space for an entry that does not fit")
+}
+
+func (a *allocTest) TestNextFit(is is.Is) {
+	h := a.makeHoles()
+	h.SetStrategy(AllocNextFit)
+
+	offset, found := h.FindSpace(2)
+	is(found && offset == 3, "incorrect offset returned: %d", offset)
+	offset, found = h.FindSpace(2)
+	is(found && offset == 5, "incorrect offset returned: %d", offset)
+	offset, found = h.FindSpace(2)
+	is(found && offset == 8, "incorrect offset returned: %d", offset)
+	offset, found = h.FindSpace(4)
+	is(found && offset == 3, "search did not wrap around: %d", offset)
+}
+
+func (a *allocTest) TestSegregated(is is.Is) {
+	h := a.makeHoles()
+	h.SetStrategy(AllocSegregated)
+
+	offset, found := h.FindSpace(1)
+	is(found && offset == 8, "incorrect offset returned: %d", offset)
+	offset, found = h.FindSpace(3)
+	is(found && offset == 11, "incorrect offset returned: %d", offset)
+
+	err := h.Set(0, 0, Entry{offset: 11, size: 3})
+	is(err == nil, "unexpected error: %s", err)
+	offset, found = h.FindSpace(3)
+	is(found && offset == 3, "free lists were not updated: %d", offset)
+}
+
+func (a *allocTest) TestSegregatedUpdate(is is.Is) {
+	rng := rand.New(rand.NewSource(1))
+	h := makeHeader()
+	h.SetStrategy(AllocSegregated)
+
+	for i := 0; i < 5000; i++ {
+		// build the free lists if they were discarded
+		size := uint(1 + rng.Intn(8))
+		offset, found := h.FindSpace(size)
+		if !found {
+			offset = 2
+			if last, ok := h.used.PreviousSet(h.used.Len() - 1); ok && last >= 2 {
+				offset = last + 1
+			}
+		}
+
+		x, z := uint8(rng.Intn(32)), uint8(rng.Intn(32))
+		var err error
+		if rng.Intn(3) == 0 {
+			err = h.Remove(x, z)
+		} else {
+			err = h.Set(x, z, Entry{offset: uint32(offset), size: uint8(size)})
+		}
+		is(err == nil, "unexpected error: %s", err)
+		is(h.free != nil, "free lists were discarded")
+
+		// the free lists must be the same as the lists built from the bitset
+		expected := &freeList{}
+		for hl, ok := h.nextHole(2); ok; hl, ok = h.nextHole(hl.offset + hl.size) {
+			class := sizeClass(hl.size)
+			expected[class] = append(expected[class], hl)
+		}
+		for class := range expected {
+			is(slices.Equal(expected[class], h.free[class]), "inconsistent free list %d after %d writes: %v != %v", class, i, h.free[class], expected[class])
+		}
+	}
+}
+
+func (*allocTest) TestUnsupported(is is.Is) {
+	_, err := ReadAnvil(0, 0, mem.NewFileHandle(mem.CreateFile("alloc")), 0, nil, Settings{Allocation: 0xff})
+	is(err != nil, "unsupported allocation strategy was accepted")
+}
+
+func BenchmarkAlloc(b *testing.B) {
+	for _, strategy := range allocStrategies {
+		b.Run(strategy.String(), func(b *testing.B) { benchmarkSaveWorkload(b, strategy) })
+	}
+}
+
+// benchmarkSaveWorkload simulates a server repeatedly saving chunks of varying sizes.
+// This reports the number of sections in the file for each section used by an entry.
+func benchmarkSaveWorkload(b *testing.B, strategy AllocStrategy) {
+	rng := rand.New(rand.NewSource(1))
+	payloads := make([][]byte, 64)
+	for i := range payloads {
+		// use random data so the entries don't compress
+		payloads[i] = make([]byte, SectionSize*(1+rng.Intn(8))-entryHeaderSize*2)
+		rng.Read(payloads[i])
+	}
+
+	f, err := ReadAnvil(0, 0, mem.NewFileHandle(mem.CreateFile("alloc")), 0, nil, Settings{Allocation: strategy})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err = f.CompressionMethod(CompressionNone); err != nil {
+		b.Fatal(err)
+	}
+
+	var written int64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := payloads[rng.Intn(len(payloads))]
+		if err = f.Write(uint8(rng.Intn(32)), uint8(rng.Intn(32)), buf); err != nil {
+			b.Fatal(err)
+		}
+		written += int64(len(buf))
+	}
+	b.StopTimer()
+
+	a := f.(*file)
+	if live := a.header.used.Count(); live > 0 {
+		b.ReportMetric(float64(a.size/SectionSize)/float64(live+2), "sections/live")
+	}
+	b.SetBytes(written / int64(b.N))
+}
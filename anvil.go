@@ -3,12 +3,13 @@ package anvil
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sync"
+	"time"
 
-	lru "github.com/hashicorp/golang-lru/v2/simplelru"
 	"github.com/spf13/afero"
 	"github.com/yehan2002/errors"
 )
@@ -27,6 +28,9 @@ const (
 	ErrClosed = errors.Const("anvil: file closed")
 	// ErrReadOnly the file was opened in readonly mode.
 	ErrReadOnly = errors.Const("anvil: file is opened in read-only mode")
+	// ErrTooLarge returned if an entry exceeds [Settings.MaxDecompressedSize] or [Settings.MaxExternalSize].
+	// The returned error is a [*LimitError].
+	ErrTooLarge = errors.Const("anvil: entry is too large")
 )
 
 const (
@@ -40,6 +44,11 @@ const (
 	SectionSize = 1 << sectionShift
 	// MaxFileSections the maximum number of sections a file can contain
 	MaxFileSections = 255 * Entries
+
+	// DefaultMaxDecompressedSize the default value for [Settings.MaxDecompressedSize].
+	DefaultMaxDecompressedSize = 256 << 20
+	// DefaultMaxExternalSize the default value for [Settings.MaxExternalSize].
+	DefaultMaxExternalSize = 64 << 20
 )
 
 // Settings settings
@@ -56,6 +65,63 @@ type Settings struct {
 	// If this value is -1 the cache will be disabled.
 	// Default: 20
 	CacheSize int
+	// Eviction the policy used to choose which anvil files are closed when the cache is full.
+	// If this is nil, [NewLRUPolicy] is used with [Settings.CacheSize].
+	// This is ignored if the cache is disabled.
+	// A policy must not be used by more than one [Anvil].
+	// Default: nil
+	Eviction EvictionPolicy
+	// MaxPinned the maximum number of anvil files that can be pinned using [Anvil.Pin].
+	// If this value is -1 the number of pinned files is not limited.
+	// Default: [DefaultMaxPinned]
+	MaxPinned int
+
+	// Allocation the strategy used to find free space when writing entries.
+	// Default: [AllocFirstFit]
+	Allocation AllocStrategy
+
+	// MaxDecompressedSize the maximum size of the decompressed data of an entry.
+	// Reading an entry that decompresses to more than this returns a [*LimitError].
+	// If this value is -1 the size is not limited.
+	// Default: [DefaultMaxDecompressedSize]
+	MaxDecompressedSize int64
+	// MaxExternalSize the maximum size of an external file.
+	// Reading an entry stored in a larger external file returns a [*LimitError],
+	// and writing an entry that would be stored in a larger external file fails with a [*LimitError]
+	// without modifying the entry.
+	// If this value is -1 the size is not limited.
+	// Default: [DefaultMaxExternalSize]
+	MaxExternalSize int64
+
+	// AsyncWorkers the number of goroutines that write the entries queued by [Anvil.WriteAsync].
+	// Default: [DefaultAsyncWorkers]
+	AsyncWorkers int
+	// AsyncQueueSize the maximum number of entries queued by [Anvil.WriteAsync].
+	// Queuing an entry that is already queued does not use more space.
+	// Default: [DefaultAsyncQueueSize]
+	AsyncQueueSize int
+	// AsyncDelay the minimum time entries queued by [Anvil.WriteAsync] wait before they are written.
+	// Writes to an entry during the delay are coalesced into a single write.
+	// Default: 0
+	AsyncDelay time.Duration
+
+	// PrefetchWorkers the number of goroutines that open the anvil files queued by [Anvil.Prefetch].
+	// Default: [DefaultPrefetchWorkers]
+	PrefetchWorkers int
+	// PrefetchQueueSize the maximum number of anvil files queued by [Anvil.Prefetch].
+	// Default: [DefaultPrefetchQueueSize]
+	PrefetchQueueSize int
+
+	// Observer receives events for file operations, reads and writes.
+	// See the observe package for adapters for expvar and tracing.
+	// Default: nil
+	Observer Observer
+
+	// Dictionaries the zstd dictionaries used to read and write entries compressed using
+	// the methods returned by [CompressionZstdDict].
+	// Use [ReadDictionaries] to read dictionaries stored next to the world.
+	// Default: nil
+	Dictionaries []*Dictionary
 
 	// The formatting string to be used to generate the file name for an anvil file
 	AnvilFmt string
@@ -63,32 +129,67 @@ type Settings struct {
 	// separately from and anvil file.
 	ChunkFmt string
 
-	fs afero.Fs
+	fs    afero.Fs
+	dicts *dictionaries
 }
 
 var filesystem afero.Fs = &afero.OsFs{}
 
 var defaultSettings = Settings{
-	CacheSize: 20,
-	AnvilFmt:  "r.%d.%d.mca",
-	ChunkFmt:  "c.%d.%d.mcc",
-	fs:        filesystem,
+	CacheSize:           20,
+	MaxPinned:           DefaultMaxPinned,
+	MaxDecompressedSize: DefaultMaxDecompressedSize,
+	MaxExternalSize:     DefaultMaxExternalSize,
+	AsyncWorkers:        DefaultAsyncWorkers,
+	AsyncQueueSize:      DefaultAsyncQueueSize,
+	PrefetchWorkers:     DefaultPrefetchWorkers,
+	PrefetchQueueSize:   DefaultPrefetchQueueSize,
+	AnvilFmt:            "r.%d.%d.mca",
+	ChunkFmt:            "c.%d.%d.mcc",
+	fs:                  filesystem,
 }
 
 // Anvil a anvil file cache.
 type Anvil struct {
 	inUse map[pos]*file
 
-	lru *lru.LRU[pos, *file]
+	// cache the files that are not in use and are kept open by `policy`.
+	// Files used by scans stay in the cache while they are used.
+	cache  map[pos]*file
+	policy EvictionPolicy
 
 	settings Settings
 
 	mux sync.RWMutex
+
+	subMux sync.RWMutex
+	subs   map[*Subscription]struct{}
+
+	// snapMux is held for reading while a file is modified, so that snapshots are taken between writes.
+	snapMux   sync.RWMutex
+	snapshots map[*Snapshot]struct{}
+
+	queue    *writeQueue
+	prefetch *prefetcher
+
+	// pinned the files pinned using [Anvil.Pin]. Each pinned file holds one use of the file.
+	pinMux sync.Mutex
+	pinned map[pos]*file
+
+	// opening the anvil files that are being opened. This must only be accessed while holding `mux`.
+	opening map[pos]*opening
 }
 
 // Read reads the content of the entry at the given coordinates to a
 // a byte slice and returns it.
 func (a *Anvil) Read(entryX, entryZ int32) (buf []byte, err error) {
+	if data, ok := a.queue.get(ChunkPos{X: entryX, Z: entryZ}); ok {
+		if data == nil {
+			return nil, ErrNotExist
+		}
+		return append([]byte(nil), data...), nil
+	}
+
 	var f *file
 	if f, err = a.get(entryX>>5, entryZ>>5); err == nil {
 		defer func() {
@@ -106,6 +207,10 @@ func (a *Anvil) Read(entryX, entryZ int32) (buf []byte, err error) {
 // `reader` must not retain the [io.Reader] passed to it.
 // `reader` must not return before reading has completed.
 func (a *Anvil) ReadTo(entryX, entryZ int32, reader io.ReaderFrom) (n int64, err error) {
+	if ok, err := a.queue.read(ChunkPos{X: entryX, Z: entryZ}, func(r io.Reader) (err error) { n, err = reader.ReadFrom(r); return }); ok {
+		return n, err
+	}
+
 	var f *file
 	if f, err = a.get(entryX>>5, entryZ>>5); err == nil {
 		defer func() {
@@ -123,6 +228,10 @@ func (a *Anvil) ReadTo(entryX, entryZ int32, reader io.ReaderFrom) (n int64, err
 // `readFn` must not retain the [io.Reader] passed to it.
 // `readFn` must not return before reading has completed.
 func (a *Anvil) ReadFn(entryX, entryZ int32, readFn func(io.Reader) error) (err error) {
+	if ok, err := a.queue.read(ChunkPos{X: entryX, Z: entryZ}, readFn); ok {
+		return err
+	}
+
 	var f *file
 	if f, err = a.get(entryX>>5, entryZ>>5); err == nil {
 		defer func() {
@@ -136,8 +245,72 @@ func (a *Anvil) ReadFn(entryX, entryZ int32, readFn func(io.Reader) error) (err
 	return
 }
 
-// Write writes the chunk data for the given location
+// Write writes the chunk data for the given location.
+// Data queued for the entry by [Anvil.WriteAsync] is discarded.
 func (a *Anvil) Write(entryX, entryZ int32, p []byte) (err error) {
+	return a.WriteWithOptions(entryX, entryZ, p, WriteOptions{})
+}
+
+// WriteWithOptions writes the chunk data for the given location using the given options.
+// See [WriteOptions] for more information.
+func (a *Anvil) WriteWithOptions(entryX, entryZ int32, p []byte, opts WriteOptions) (err error) {
+	a.queue.discard(ChunkPos{X: entryX, Z: entryZ})
+
+	var f *file
+	if f, err = a.get(entryX>>5, entryZ>>5); err == nil {
+		defer func() {
+			if closeErr := a.free(f); closeErr != nil && err != nil {
+				err = closeErr
+			}
+		}()
+
+		err = f.WriteWithOptions(uint8(entryX&0x1f), uint8(entryZ&0x1f), p, opts)
+	}
+	return
+}
+
+// Remove removes the entry at the given coordinates.
+// Data queued for the entry by [Anvil.WriteAsync] is discarded.
+func (a *Anvil) Remove(entryX, entryZ int32) (err error) {
+	a.queue.discard(ChunkPos{X: entryX, Z: entryZ})
+
+	var f *file
+	if f, err = a.get(entryX>>5, entryZ>>5); err == nil {
+		defer func() {
+			if closeErr := a.free(f); closeErr != nil && err != nil {
+				err = closeErr
+			}
+		}()
+
+		err = f.Remove(uint8(entryX&0x1f), uint8(entryZ&0x1f))
+	}
+	return
+}
+
+// ReadRaw reads the compressed data for the entry at the given coordinates without decompressing it.
+// This also returns the compression method used to compress the data.
+func (a *Anvil) ReadRaw(entryX, entryZ int32) (buf []byte, method CompressMethod, err error) {
+	a.queue.wait(func(pos ChunkPos) bool { return pos == ChunkPos{X: entryX, Z: entryZ} })
+
+	var f *file
+	if f, err = a.get(entryX>>5, entryZ>>5); err == nil {
+		defer func() {
+			if closeErr := a.free(f); closeErr != nil && err != nil {
+				err = closeErr
+			}
+		}()
+
+		buf, method, err = f.ReadRaw(uint8(entryX&0x1f), uint8(entryZ&0x1f))
+	}
+	return
+}
+
+// ReadEntry is the same as [Anvil.Read] but also returns the header entry for the data.
+// Unlike calling [Anvil.Info] and [Anvil.Read], the entry always describes the returned data
+// even if the entry is written concurrently.
+func (a *Anvil) ReadEntry(entryX, entryZ int32) (buf []byte, entry Entry, err error) {
+	a.queue.wait(func(pos ChunkPos) bool { return pos == ChunkPos{X: entryX, Z: entryZ} })
+
 	var f *file
 	if f, err = a.get(entryX>>5, entryZ>>5); err == nil {
 		defer func() {
@@ -146,13 +319,56 @@ func (a *Anvil) Write(entryX, entryZ int32, p []byte) (err error) {
 			}
 		}()
 
-		err = f.Write(uint8(entryX&0x1f), uint8(entryZ&0x1f), p)
+		buf, _, entry, err = f.readEntry(uint8(entryX&0x1f), uint8(entryZ&0x1f), false)
+	}
+	return
+}
+
+// ReadRawEntry is the same as [Anvil.ReadRaw] but also returns the header entry for the data.
+// See [Anvil.ReadEntry] for more information.
+func (a *Anvil) ReadRawEntry(entryX, entryZ int32) (buf []byte, method CompressMethod, entry Entry, err error) {
+	a.queue.wait(func(pos ChunkPos) bool { return pos == ChunkPos{X: entryX, Z: entryZ} })
+
+	var f *file
+	if f, err = a.get(entryX>>5, entryZ>>5); err == nil {
+		defer func() {
+			if closeErr := a.free(f); closeErr != nil && err != nil {
+				err = closeErr
+			}
+		}()
+
+		buf, method, entry, err = f.readEntry(uint8(entryX&0x1f), uint8(entryZ&0x1f), true)
+	}
+	return
+}
+
+// WriteRaw writes data that was already compressed using the given method
+// to the entry at the given coordinates without recompressing it.
+func (a *Anvil) WriteRaw(entryX, entryZ int32, method CompressMethod, p []byte) (err error) {
+	return a.writeRaw(entryX, entryZ, method, p, time.Time{})
+}
+
+// writeRaw is the same as [Anvil.WriteRaw] but also sets the timestamp for the entry.
+func (a *Anvil) writeRaw(entryX, entryZ int32, method CompressMethod, p []byte, timestamp time.Time) (err error) {
+	a.queue.discard(ChunkPos{X: entryX, Z: entryZ})
+
+	var f *file
+	if f, err = a.get(entryX>>5, entryZ>>5); err == nil {
+		defer func() {
+			if closeErr := a.free(f); closeErr != nil && err != nil {
+				err = closeErr
+			}
+		}()
+
+		err = f.writeRaw(uint8(entryX&0x1f), uint8(entryZ&0x1f), method, p, timestamp)
 	}
 	return
 }
 
 // Info gets information stored in the anvil header for the given entry.
 func (a *Anvil) Info(entryX, entryZ int32) (entry Entry, exists bool, err error) {
+	a.queue.wait(func(pos ChunkPos) bool { return pos == ChunkPos{X: entryX, Z: entryZ} })
+
 	var f *file
 	if f, err = a.get(entryX>>5, entryZ>>5); err == nil {
 		defer func() {
@@ -179,44 +395,211 @@ func (a *Anvil) File(rgX, rgZ int32) (f File, err error) {
 	return cf, nil
 }
 
-// get gets the anvil get for the given coords
-func (a *Anvil) get(rgX, rgZ int32) (f *file, err error) {
-	rg := pos{rgX, rgZ}
+// Close writes the entries queued by [Anvil.WriteAsync], stops prefetching
+// and closes all anvil files opened by this Anvil, including pinned files.
+// Errors that occurred while writing queued entries are returned as [AsyncErrors].
+// The Anvil must not be used after Close is called.
+func (a *Anvil) Close() (err error) {
+	a.prefetch.close()
+	err = a.queue.close()
+
+	a.pinMux.Lock()
+	a.pinned = nil
+	a.pinMux.Unlock()
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	for rg, f := range a.inUse {
+		// files used by scans are also in the cache, they are closed below
+		if !f.cached {
+			if closeErr := f.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+		delete(a.inUse, rg)
+	}
+
+	for _, f := range a.cache {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		a.uncache(f)
+	}
+	return
+}
+
+// RegionPos the position of an anvil file.
+type RegionPos struct{ X, Z int32 }
+
+// ChunkPos the position of an entry.
+type ChunkPos struct{ X, Z int32 }
+
+// Region returns the position of the anvil file that contains the entry.
+func (c ChunkPos) Region() RegionPos { return RegionPos{X: c.X >> 5, Z: c.Z >> 5} }
+
+// Regions returns the positions of all anvil files in the directory.
+// Files that do not match [Settings.AnvilFmt] are ignored.
+func (a *Anvil) Regions() (regions []RegionPos, err error) {
+	var files []os.FileInfo
+	if files, err = afero.ReadDir(a.settings.fs, "."); err != nil {
+		return nil, errors.Wrap("anvil: unable to list anvil files", err)
+	}
+
+	for _, info := range files {
+		var rg RegionPos
+		if info.IsDir() {
+			continue
+		}
+
+		if _, err := fmt.Sscanf(info.Name(), a.settings.AnvilFmt, &rg.X, &rg.Z); err != nil {
+			continue
+		}
+
+		// Sscanf ignores any trailing characters, so check if the name matches exactly
+		if fmt.Sprintf(a.settings.AnvilFmt, rg.X, rg.Z) == info.Name() {
+			regions = append(regions, rg)
+		}
+	}
+	return regions, nil
+}
+
+// RegionExists checks if the anvil file at rgX, rgZ exists.
+// This can be used to avoid creating empty anvil files, since every other method
+// creates the file if it does not exist unless [Settings.ReadOnly] is set.
+func (a *Anvil) RegionExists(rgX, rgZ int32) (bool, error) {
+	_, err := a.settings.fs.Stat(fmt.Sprintf(a.settings.AnvilFmt, rgX, rgZ))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap("anvil: unable to stat anvil file", err)
+	}
+	return true, nil
+}
+
+// cached checks if the anvil file at the given position is open or in the cache.
+func (a *Anvil) cached(rg pos) (ok bool) {
 	a.mux.RLock()
-	f, ok := a.getFile(rg)
+	defer a.mux.RUnlock()
+
+	if _, ok = a.inUse[rg]; !ok {
+		_, ok = a.cache[rg]
+	}
+	return
+}
+
+// exists checks if the anvil file at the given position is open or exists on disk.
+func (a *Anvil) exists(rg pos) (bool, error) {
+	if a.cached(rg) {
+		return true, nil
+	}
+	return a.RegionExists(rg.x, rg.z)
+}
+
+// get gets the anvil get for the given coords.
+// The lock is not held while the file is opened, so opening a file does not block access to other files.
+// If the file is already being opened by another goroutine, this waits for it instead of opening it again.
+func (a *Anvil) get(rgX, rgZ int32) (f *file, err error) { return a.acquire(pos{rgX, rgZ}, false) }
+
+// getScan is the same as [Anvil.get] but does not add the file to the cache once it is no longer used,
+// and uses files that are already cached without removing them from the cache.
+// This is used by methods that use every file once, so that they do not evict frequently used files.
+func (a *Anvil) getScan(rgX, rgZ int32) (f *file, err error) { return a.acquire(pos{rgX, rgZ}, true) }
+
+// acquire gets the anvil file at rg. See [Anvil.get] and [Anvil.getScan].
+func (a *Anvil) acquire(rg pos, scan bool) (f *file, err error) {
+	cached := true
+	if a.settings.Observer != nil {
+		start := time.Now()
+		defer func() {
+			a.settings.Observer.Open(OpenEvent{Region: rg.region(), Cached: cached, Start: start, Duration: time.Since(start), Err: err})
+		}()
+	}
+
+	a.mux.RLock()
+	f, ok := a.inUse[rg]
+	// files used by scans must be removed from the cache before they are used by other callers
+	if ok = ok && (scan || (!f.scan && !f.cached)); ok {
+		f.useCount.Add(1)
+	}
 	a.mux.RUnlock()
 
-	if !ok {
+	for !ok {
 		a.mux.Lock()
-		defer a.mux.Unlock()
 		// check if the file was opened while we were waiting for the mux
-		if f, ok = a.getFile(rg); !ok {
+		if f, ok = a.inUse[rg]; !ok {
+			// check if the file is in the cache
+			f, ok = a.cache[rg]
+		}
 
-			if a.lru != nil {
-				// check if the file is in the lru cache
-				if f, ok = a.lru.Get(rg); ok {
-					a.lru.Remove(rg)
-				}
+		if ok {
+			f.useCount.Add(1)
+			a.inUse[rg] = f
+			if !scan {
+				a.uncache(f)
+				f.scan = false
+			} else if f.useCount.Load() == 1 {
+				f.scan = true
 			}
+			a.mux.Unlock()
+			break
+		}
 
-			// file wasn't in the cache. read file from the disk
-			if f == nil {
-				var r reader
-				var size int64
-				filename := fmt.Sprintf(a.settings.AnvilFmt, rg.x, rg.z)
-				if r, size, err = openFile(filename, a.settings); err == nil {
-					f, err = newAnvil(rg.x, rg.z, r, size, a.settings)
-					f.cache = a
-				}
+		// wait for the file to be opened if another goroutine is opening it
+		if o, opening := a.opening[rg]; opening {
+			a.mux.Unlock()
+			if <-o.done; o.err != nil {
+				return nil, o.err
 			}
+			continue
+		}
 
-			if err == nil {
-				f.useCount.Add(1)
-				a.inUse[rg] = f
-			}
+		o := &opening{done: make(chan struct{})}
+		if a.opening == nil {
+			a.opening = map[pos]*opening{}
+		}
+		a.opening[rg] = o
+		a.mux.Unlock()
+
+		// file wasn't in the cache. read file from the disk
+		cached = false
+		f, err = a.open(rg)
+
+		a.mux.Lock()
+		delete(a.opening, rg)
+		if err == nil {
+			f.useCount.Add(1)
+			f.scan = scan
+			a.inUse[rg] = f
 		}
+		o.err = err
+		close(o.done)
+		a.mux.Unlock()
+		return f, err
 	}
 
+	return f, nil
+}
+
+// opening an anvil file that is being opened by [Anvil.get].
+type opening struct {
+	// done is closed once the file is opened.
+	done chan struct{}
+	err  error
+}
+
+// open opens the anvil file at rg from the disk.
+func (a *Anvil) open(rg pos) (f *file, err error) {
+	var r reader
+	var size int64
+	filename := fmt.Sprintf(a.settings.AnvilFmt, rg.x, rg.z)
+	if r, size, err = openFile(filename, a.settings); err == nil {
+		if f, err = newAnvil(rg.x, rg.z, r, size, a.settings); err == nil {
+			f.cache = a
+		} else {
+			r.Close()
+		}
+	}
 	return
 }
 
@@ -225,46 +608,79 @@ func (a *Anvil) free(f *file) (err error) {
 	newCount := f.useCount.Add(-1)
 	a.mux.RUnlock()
 
-	if newCount == 0 {
-		a.mux.Lock()
-		defer a.mux.Unlock()
-		if newCount = f.useCount.Load(); newCount == 0 {
+	if newCount != 0 {
+		return
+	}
 
-			if a.lru == nil {
-				// cache is disabled. close the file
-				delete(a.inUse, f.pos)
-				return f.Close()
-			}
+	// the files that should be closed. These are closed without holding the lock since closing syncs the file.
+	var closing []*file
+	evicted := false
+
+	a.mux.Lock()
+	if newCount = f.useCount.Load(); newCount == 0 {
+		delete(a.inUse, f.pos)
+
+		switch {
+		case f.cached:
+			// the file was used by scans while it was cached. It is still in the cache.
+		case a.policy == nil || f.scan:
+			// cache is disabled or the file was only used by scans. close the file
+			closing = append(closing, f)
+		default:
+			f.cached = true
+			a.cache[f.pos] = f
+
+			f.mux.RLock()
+			entry := CacheEntry{Region: f.pos.region(), Size: f.size, Memory: f.memory()}
+			f.mux.RUnlock()
+			a.policy.Add(entry)
+
+			// We evict files manually instead of closing them when they are removed to handle errors
+			// that occur while closing the file and to avoid holding the lock while closing it.
+			for {
+				rg, ok := a.policy.Evict()
+				if !ok {
+					break
+				}
 
-			// evict the oldest file from the lru if adding a new element will cause a element to be evicted
-			// We do this to insure the file gets closed properly and to free all associated resources.
-			// We cannot use EvictCallback since there is no way to handle error that occur while closing the file.
-			if a.lru.Len() == a.settings.CacheSize {
-				if _, old, ok := a.lru.RemoveOldest(); ok {
-					if err = old.Close(); err != nil {
-						err = errors.Wrap("anvil.Cache: error occurred while evicting file", err)
-					}
+				old, ok := a.cache[pos{rg.X, rg.Z}]
+				if !ok {
+					continue
 				}
-			}
 
-			evicted := a.lru.Add(f.pos, f)
-			if evicted {
-				// This should never happen since we manually evicted the oldest element
-				panic("anvil.Cache: File was incorrectly evicted")
+				if a.settings.Observer != nil {
+					a.settings.Observer.Evict(rg)
+				}
+
+				delete(a.cache, old.pos)
+				old.cached = false
+				// files that are used by scans are closed once they are no longer used
+				if old.useCount.Load() == 0 {
+					closing, evicted = append(closing, old), true
+				}
 			}
+		}
+	}
+	a.mux.Unlock()
 
-			delete(a.inUse, f.pos)
+	for _, c := range closing {
+		if closeErr := c.Close(); closeErr != nil && err == nil {
+			if err = closeErr; evicted {
+				err = errors.Wrap("anvil.Cache: error occurred while evicting file", err)
+			}
 		}
 	}
 	return
 }
 
-func (a *Anvil) getFile(rg pos) (f *file, ok bool) {
-	f, ok = a.inUse[rg]
-	if ok {
-		f.useCount.Add(1)
+// uncache removes the given file from the cache.
+// Callers must hold the write lock.
+func (a *Anvil) uncache(f *file) {
+	if f.cached {
+		f.cached = false
+		delete(a.cache, f.pos)
+		a.policy.Remove(f.pos.region())
 	}
-	return
 }
 
 // Open opens the given directory.
@@ -285,17 +701,39 @@ func Open(path string, opt ...Settings) (c *Anvil, err error) {
 func OpenFs(fs afero.Fs, opt ...Settings) (c *Anvil, err error) {
 	settings := getSettings(opt, fs)
 
-	cache := Anvil{inUse: map[pos]*file{}, settings: settings}
+	cache := Anvil{inUse: map[pos]*file{}, cache: map[pos]*file{}, settings: settings}
+	cache.queue = newWriteQueue(&cache)
+	cache.prefetch = newPrefetcher(&cache)
 
 	if settings.CacheSize > 0 {
-		if cache.lru, err = lru.NewLRU[pos, *file](settings.CacheSize, nil); err != nil {
-			return nil, err
+		if cache.policy = settings.Eviction; cache.policy == nil {
+			cache.policy = NewLRUPolicy(settings.CacheSize)
 		}
 	}
 
 	return &cache, nil
 }
 
+// OpenFS opens the given [fs.FS] in read-only mode.
+// [Settings.ReadOnly] is always set.
+// Anvil files are opened by their paths relative to the root of `fsys`;
+// use [fs.Sub] to open a subdirectory (e.g. the `region` directory of a world).
+// This can be used to read worlds from zip archives ([archive/zip.Reader]) or embedded files ([embed.FS])
+// without extracting them.
+// Files that do not implement [io.ReaderAt] are read into memory when they are opened.
+// Opening such a file fails with [ErrTooLarge] if it is larger than the largest valid anvil file,
+// or larger than [Settings.MaxExternalSize] for external files.
+func OpenFS(fsys fs.FS, opt ...Settings) (c *Anvil, err error) {
+	settings := defaultSettings
+	if len(opt) == 1 {
+		settings = opt[0]
+	}
+	settings.ReadOnly = true
+
+	limits := getSettings([]Settings{settings}, nil)
+	return OpenFs(ioFS{FromIOFS: afero.FromIOFS{FS: fsys}, maxExternal: limits.MaxExternalSize, chunkFmt: limits.ChunkFmt}, settings)
+}
+
 func getSettings(s []Settings, fs afero.Fs) Settings {
 	var settings = defaultSettings
 
@@ -306,6 +744,34 @@ func getSettings(s []Settings, fs afero.Fs) Settings {
 			settings.CacheSize = defaultSettings.CacheSize
 		}
 
+		if settings.MaxPinned == 0 {
+			settings.MaxPinned = defaultSettings.MaxPinned
+		}
+
+		if settings.MaxDecompressedSize == 0 {
+			settings.MaxDecompressedSize = defaultSettings.MaxDecompressedSize
+		}
+
+		if settings.MaxExternalSize == 0 {
+			settings.MaxExternalSize = defaultSettings.MaxExternalSize
+		}
+
+		if settings.AsyncWorkers <= 0 {
+			settings.AsyncWorkers = defaultSettings.AsyncWorkers
+		}
+
+		if settings.AsyncQueueSize <= 0 {
+			settings.AsyncQueueSize = defaultSettings.AsyncQueueSize
+		}
+
+		if settings.PrefetchWorkers <= 0 {
+			settings.PrefetchWorkers = defaultSettings.PrefetchWorkers
+		}
+
+		if settings.PrefetchQueueSize <= 0 {
+			settings.PrefetchQueueSize = defaultSettings.PrefetchQueueSize
+		}
+
 		if settings.AnvilFmt == "" {
 			settings.AnvilFmt = defaultSettings.AnvilFmt
 		}
@@ -316,6 +782,7 @@ func getSettings(s []Settings, fs afero.Fs) Settings {
 	}
 
 	settings.fs = fs
+	settings.dicts = newDictionaries(settings.Dictionaries)
 
 	return settings
 }
@@ -0,0 +1,115 @@
+package anvil
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type anvilTest struct{}
+
+func TestAnvil(t *testing.T) { is.SuiteP(t, &anvilTest{}) }
+
+// blockingFs an [afero.Fs] that blocks opening the given file until `unblock` is closed.
+type blockingFs struct {
+	afero.Fs
+	name    string
+	opened  chan struct{}
+	unblock chan struct{}
+	opens   atomic.Int32
+}
+
+func (b *blockingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if name == b.name {
+		if b.opens.Add(1) == 1 {
+			close(b.opened)
+		}
+		<-b.unblock
+	}
+	return b.Fs.OpenFile(name, flag, perm)
+}
+
+func (*anvilTest) TestOpen(is is.Is) {
+	fs := &blockingFs{Fs: afero.NewMemMapFs(), name: "r.1.0.mca", opened: make(chan struct{}), unblock: make(chan struct{})}
+	a, err := OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+	is(a.Write(0, 0, []byte{1}) == nil, "unexpected error")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.Write(32, 0, []byte{2}); err != nil {
+				is.T().Error(err)
+				return
+			}
+		}()
+	}
+	<-fs.opened
+
+	// files that are already open can be used while another file is being opened
+	done := make(chan error)
+	go func() { _, err := a.Read(0, 0); done <- err }()
+	select {
+	case err = <-done:
+		is(err == nil, "unexpected error: %s", err)
+	case <-time.After(10 * time.Second):
+		is.Fail("reading an open file was blocked by opening another file")
+	}
+
+	close(fs.unblock)
+	wg.Wait()
+	is(fs.opens.Load() == 1, "file was opened %d times", fs.opens.Load())
+
+	data, err := a.Read(32, 0)
+	is(err == nil && data[0] == 2, "incorrect data: %v %s", data, err)
+}
+
+func (*anvilTest) TestReadEntry(is is.Is) {
+	a := makeWorld(is, nil)
+	_, _, err := a.ReadEntry(0, 0)
+	is.Err(err, ErrNotExist, "incorrect error")
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := byte(1); ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := a.WriteWithOptions(0, 0, []byte{i}, WriteOptions{Timestamp: time.Unix(int64(i)+1, 0)}); err != nil {
+				is.T().Error(err)
+				return
+			}
+		}
+	}()
+
+	// the entry always describes the data that was read
+	for i := 0; i < 200; i++ {
+		data, entry, err := a.ReadEntry(0, 0)
+		if errors.Is(err, ErrNotExist) {
+			continue
+		}
+		is(err == nil, "unexpected error: %s", err)
+		is(entry.Modified().Unix() == int64(data[0])+1, "entry does not match the data: %d %d", entry.Modified().Unix(), data[0])
+	}
+	close(done)
+	wg.Wait()
+
+	is(a.WriteAsync(0, 0, []byte{1}) == nil, "unexpected error")
+	data, entry, err := a.ReadEntry(0, 0)
+	is(err == nil && data[0] == 1 && entry.Exists(), "queued data was not read: %v %s", data, err)
+	raw, method, rawEntry, err := a.ReadRawEntry(0, 0)
+	is(err == nil && method == DefaultCompression && rawEntry == entry && len(raw) > 0, "incorrect raw entry: %s", err)
+}
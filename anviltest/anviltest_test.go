@@ -0,0 +1,184 @@
+package anviltest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type anviltestTest struct{}
+
+func TestAnviltest(t *testing.T) { is.SuiteP(t, &anviltestTest{}) }
+
+func (*anviltestTest) check(is is.Is, world *anvil.Anvil, pos anvil.ChunkPos, size int) {
+	data, err := world.Read(pos.X, pos.Z)
+	is(err == nil, "unexpected error reading (%d,%d): %s", pos.X, pos.Z, err)
+	is(bytes.Equal(data, Data(pos, size)), "incorrect data for (%d,%d)", pos.X, pos.Z)
+}
+
+func (a *anviltestTest) TestWorld(is is.Is) {
+	external := Region{X: -1, Entries: []Entry{
+		{X: 31, Z: 2, Data: Data(anvil.ChunkPos{X: -1, Z: 2}, 100), External: true, Timestamp: time.Unix(1000, 0)},
+		{X: 0, Z: 0, Data: Data(anvil.ChunkPos{X: -32}, 100), Method: anvil.CompressionNone},
+	}}
+
+	fs, err := World(Packed(0, 0, 40, 5000), Sparse(1, 0, 5, 100, 3), external)
+	is(err == nil, "unexpected error: %s", err)
+
+	world, err := anvil.OpenFs(fs, anvil.Settings{ReadOnly: true})
+	is(err == nil, "unexpected error: %s", err)
+
+	for i := int32(0); i < 40; i++ {
+		a.check(is, world, anvil.ChunkPos{X: i & 31, Z: i >> 5}, 5000)
+	}
+	for i := int32(0); i < 5; i++ {
+		a.check(is, world, anvil.ChunkPos{X: 32 + i}, 100)
+	}
+	a.check(is, world, anvil.ChunkPos{X: -1, Z: 2}, 100)
+	a.check(is, world, anvil.ChunkPos{X: -32}, 100)
+
+	entry, exists, err := world.Info(-1, 2)
+	is(err == nil && exists, "unexpected error: %s", err)
+	is(entry.Modified().Unix() == 1000, "incorrect timestamp: %s", entry.Modified())
+
+	// there are 3 free sections after each entry
+	f, err := world.File(1, 0)
+	is(err == nil, "unexpected error: %s", err)
+	defer f.Close()
+	first, _ := f.Info(0, 0)
+	second, _ := f.Info(1, 0)
+	is(second.Offset()-first.Offset() == 4, "incorrect offsets: %d %d", first.Offset(), second.Offset())
+}
+
+func (*anviltestTest) TestCorrupted(is is.Is) {
+	data := Data(anvil.ChunkPos{}, 100)
+	tests := []struct {
+		name   string
+		region Region
+		err    error
+	}{
+		{"overlap", Region{Entries: []Entry{{Data: data}, {X: 1, Data: data, Offset: 2}}}, anvil.ErrCorrupted},
+		{"outside", Region{Entries: []Entry{{Data: data, Sections: 5}}}, anvil.ErrCorrupted},
+		{"length", Region{Entries: []Entry{{Data: data, Length: 5000}}}, anvil.ErrCorrupted},
+		{"truncated", Region{Entries: []Entry{{Data: data}}, Size: 5000}, anvil.ErrSize},
+		{"method", Region{Entries: []Entry{{Data: data, Method: 9, Raw: true}}}, nil},
+		{"data", Region{Entries: []Entry{{Data: data, Raw: true}}}, nil},
+		{"external", Region{Entries: []Entry{{Data: data, External: true}}}, nil},
+	}
+
+	for _, test := range tests {
+		fs, err := World(test.region)
+		is(err == nil, "%s: unexpected error: %s", test.name, err)
+
+		if test.name == "external" {
+			is(fs.Remove("c.0.0.mcc") == nil, "unable to remove external file")
+		}
+
+		world, err := anvil.OpenFs(fs, anvil.Settings{ReadOnly: true})
+		is(err == nil, "%s: unexpected error: %s", test.name, err)
+
+		_, err = world.Read(0, 0)
+		is(err != nil, "%s: expected an error", test.name)
+		is(test.err == nil || errors.Is(err, test.err), "%s: incorrect error returned: %s", test.name, err)
+	}
+}
+
+func (a *anviltestTest) TestFaults(is is.Is) {
+	fs := NewFS(afero.NewMemMapFs())
+	world, err := anvil.OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+
+	is(world.Write(0, 0, Data(anvil.ChunkPos{}, 100)) == nil, "unexpected error")
+	writes := fs.Count(OpWrite)
+	is(writes > 0 && fs.Count(OpSync) > 0 && fs.Count(OpTruncate) > 0, "operations were not counted")
+
+	fs.Inject(Fault{Op: OpWrite, N: 2})
+	err = world.Write(1, 0, Data(anvil.ChunkPos{X: 1}, 100))
+	is(errors.Is(err, ErrInjected), "incorrect error returned: %s", err)
+	// the data and the header are written, and the previous header is written back
+	is(fs.Count(OpWrite) == writes+4, "incorrect number of writes: %d", fs.Count(OpWrite))
+
+	fs.Reset()
+	is(world.Write(1, 0, Data(anvil.ChunkPos{X: 1}, 100)) == nil, "unexpected error")
+	a.check(is, world, anvil.ChunkPos{X: 1}, 100)
+
+	// the file must be grown to fit the entry
+	errTruncate := errors.New("truncate")
+	fs.Inject(Fault{Op: OpTruncate, Err: errTruncate})
+	err = world.Write(2, 0, Data(anvil.ChunkPos{X: 2}, 50000))
+	is(errors.Is(err, errTruncate), "incorrect error returned: %s", err)
+	fs.Reset()
+
+	fs.FullDisk()
+	err = world.Write(3, 0, Data(anvil.ChunkPos{X: 3}, 100))
+	is(errors.Is(err, ErrNoSpace), "incorrect error returned: %s", err)
+	err = world.Write(3, 0, Data(anvil.ChunkPos{X: 3}, 100))
+	is(errors.Is(err, ErrNoSpace), "incorrect error returned: %s", err)
+}
+
+func (a *anviltestTest) TestHeaderFault(is is.Is) {
+	fs := NewFS(afero.NewMemMapFs())
+	world, err := anvil.OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+	for x := int32(0); x < 3; x++ {
+		is(world.Write(x, 0, Data(anvil.ChunkPos{X: x}, 100)) == nil, "unexpected error")
+	}
+	// leave a free section between the first and the last entry
+	hole, _, err := world.Info(1, 0)
+	is(err == nil, "unexpected error: %s", err)
+	is(world.Remove(1, 0) == nil, "unexpected error")
+
+	// the data is synced, but the sync after the header is updated fails
+	fs.Inject(Fault{Op: OpSync, N: 2})
+	err = world.Write(3, 0, Data(anvil.ChunkPos{X: 3}, 100))
+	is(errors.Is(err, ErrInjected), "incorrect error returned: %s", err)
+	fs.Reset()
+
+	_, exists, err := world.Info(3, 0)
+	is(err == nil && !exists, "failed write was committed: %s", err)
+
+	// the space reserved by the failed write is reused
+	is(world.Write(4, 0, Data(anvil.ChunkPos{X: 4}, 100)) == nil, "unexpected error")
+	entry, _, err := world.Info(4, 0)
+	is(err == nil && entry.Offset() == hole.Offset(), "space was not freed: %d != %d", entry.Offset(), hole.Offset())
+	a.check(is, world, anvil.ChunkPos{X: 4}, 100)
+}
+
+func (a *anviltestTest) TestCrash(is is.Is) {
+	fs := NewFS(afero.NewMemMapFs())
+	world, err := anvil.OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+	is(world.Write(0, 0, Data(anvil.ChunkPos{}, 100)) == nil, "unexpected error")
+
+	// the data is synced, but the sync after the header is updated fails
+	fs.Inject(Fault{Op: OpSync, N: 2})
+	err = world.Write(1, 0, Data(anvil.ChunkPos{X: 1}, 100))
+	is(errors.Is(err, ErrInjected), "incorrect error returned: %s", err)
+
+	// a torn write of the data of an entry
+	fs.Inject(Fault{Op: OpWrite, Torn: 10})
+	err = world.Write(2, 0, Data(anvil.ChunkPos{X: 2}, 100))
+	is(errors.Is(err, ErrInjected), "incorrect error returned: %s", err)
+
+	crashed, err := fs.Crash()
+	is(err == nil, "unexpected error: %s", err)
+
+	world, err = anvil.OpenFs(crashed, anvil.Settings{ReadOnly: true})
+	is(err == nil, "unexpected error: %s", err)
+	a.check(is, world, anvil.ChunkPos{}, 100)
+	for x := int32(1); x < 3; x++ {
+		_, exists, err := world.Info(x, 0)
+		is(err == nil && !exists, "entry (%d,0) survived the crash", x)
+	}
+
+	// the crashed filesystem does not change
+	fs.Reset()
+	is(fs.Remove("r.0.0.mca") == nil, "unexpected error")
+	_, err = crashed.Stat("r.0.0.mca")
+	is(err == nil, "unexpected error: %s", err)
+}
@@ -0,0 +1,308 @@
+// Package anviltest provides utilities for testing code that uses anvil.
+// [FS] injects faults into file operations and simulates crashes,
+// and [Region] builds anvil files with specific layouts, corruptions and external entries.
+package anviltest
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/errors"
+)
+
+const (
+	// ErrInjected the default error returned by operations that fail because of a [Fault].
+	ErrInjected = errors.Const("anviltest: injected fault")
+	// ErrNoSpace the error returned by writes after [FS.FullDisk] is called.
+	ErrNoSpace = errors.Const("anviltest: no space left on device")
+)
+
+// Op an operation that faults can be injected into.
+type Op uint8
+
+// operations
+const (
+	// OpWrite calls to Write, WriteAt and WriteString.
+	OpWrite Op = 1 + iota
+	// OpSync calls to Sync.
+	OpSync
+	// OpTruncate calls to Truncate.
+	OpTruncate
+
+	opCount
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpWrite:
+		return "write"
+	case OpSync:
+		return "sync"
+	case OpTruncate:
+		return "truncate"
+	default:
+		return "unknown"
+	}
+}
+
+// Fault a fault injected into an operation.
+type Fault struct {
+	Op Op
+	// N the operation that fails, counting from 1 since the fault was injected.
+	// If this is 0, the next operation fails.
+	N int
+	// Sticky if every operation after the Nth operation also fails (e.g. a full disk).
+	Sticky bool
+	// Torn the number of bytes written by a failing write before the error is returned.
+	// If Torn is larger than the data being written, the whole write succeeds before the error is returned.
+	// This is ignored for other operations.
+	Torn int
+	// Err the error returned by the failing operation.
+	// Default: [ErrInjected]
+	Err error
+}
+
+// FS an [afero.Fs] that injects faults into writes, syncs and truncates of files opened through it.
+// FS also tracks the content of every file that was opened for writing as of the last successful sync,
+// which is used by [FS.Crash] to simulate a crash.
+// Files opened using [os.O_SYNC] are synced after every write.
+// All methods can be called concurrently.
+type FS struct {
+	afero.Fs
+
+	mux    sync.Mutex
+	counts [opCount]int
+	faults []*fault
+	// durable the content of files as of the last sync.
+	durable map[string][]byte
+}
+
+type fault struct {
+	Fault
+	// start the number of operations when the fault was injected.
+	start int
+}
+
+var _ afero.Fs = &FS{}
+
+// NewFS returns a new [FS] that wraps the given filesystem.
+func NewFS(fs afero.Fs) *FS { return &FS{Fs: fs, durable: map[string][]byte{}} }
+
+// Inject injects the given faults.
+// Faults are matched in the order they are injected.
+func (f *FS) Inject(faults ...Fault) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	for _, fl := range faults {
+		if fl.N <= 0 {
+			fl.N = 1
+		}
+		if fl.Err == nil {
+			fl.Err = ErrInjected
+		}
+		f.faults = append(f.faults, &fault{Fault: fl, start: f.counts[fl.Op]})
+	}
+}
+
+// FullDisk makes every following write and truncate fail with [ErrNoSpace].
+func (f *FS) FullDisk() {
+	f.Inject(Fault{Op: OpWrite, Sticky: true, Err: ErrNoSpace}, Fault{Op: OpTruncate, Sticky: true, Err: ErrNoSpace})
+}
+
+// Reset removes all injected faults.
+func (f *FS) Reset() {
+	f.mux.Lock()
+	f.faults = nil
+	f.mux.Unlock()
+}
+
+// Count returns the number of operations of the given kind performed by files opened through this FS.
+// Operations that failed because of an injected fault are included.
+func (f *FS) Count(op Op) int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.counts[op]
+}
+
+// check counts an operation and returns the fault for it, if any.
+func (f *FS) check(op Op) *Fault {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.counts[op]++
+	for _, fl := range f.faults {
+		if fl.Op != op {
+			continue
+		}
+
+		if n := f.counts[op] - fl.start; n == fl.N || (fl.Sticky && n > fl.N) {
+			return &fl.Fault
+		}
+	}
+	return nil
+}
+
+// Crash returns a copy of the filesystem as it would be after a crash.
+// Files that were opened for writing through this FS only contain the data
+// they contained when they were last synced, or when they were first opened if they were never synced.
+// The returned filesystem is independent of this FS.
+func (f *FS) Crash() (afero.Fs, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	crashed := afero.NewMemMapFs()
+	err := afero.Walk(f.Fs, "", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if info.IsDir() {
+			return crashed.MkdirAll(path, info.Mode().Perm())
+		}
+
+		data, ok := f.durable[filepath.Clean(path)]
+		if !ok {
+			if data, err = afero.ReadFile(f.Fs, path); err != nil {
+				return err
+			}
+		}
+		return afero.WriteFile(crashed, path, data, info.Mode().Perm())
+	})
+	return crashed, err
+}
+
+// sync records the current content of the given file as durable.
+func (f *FS) sync(name string) error {
+	data, err := afero.ReadFile(f.Fs, name)
+	if err == nil {
+		f.mux.Lock()
+		f.durable[name] = data
+		f.mux.Unlock()
+	}
+	return err
+}
+
+// Create implements [afero.Fs].
+func (f *FS) Create(name string) (afero.File, error) {
+	return f.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Open implements [afero.Fs].
+func (f *FS) Open(name string) (afero.File, error) { return f.OpenFile(name, os.O_RDONLY, 0) }
+
+// OpenFile implements [afero.Fs].
+func (f *FS) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	name = filepath.Clean(name)
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		// record the content of the file before it is modified
+		f.mux.Lock()
+		if _, ok := f.durable[name]; !ok {
+			data, err := afero.ReadFile(f.Fs, name)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				f.mux.Unlock()
+				return nil, err
+			}
+			f.durable[name] = data
+		}
+		f.mux.Unlock()
+	}
+
+	file, err := f.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f, name: name, sync: flag&os.O_SYNC != 0}, nil
+}
+
+// Remove implements [afero.Fs].
+func (f *FS) Remove(name string) error {
+	err := f.Fs.Remove(name)
+	if err == nil {
+		f.mux.Lock()
+		delete(f.durable, filepath.Clean(name))
+		f.mux.Unlock()
+	}
+	return err
+}
+
+// Rename implements [afero.Fs].
+func (f *FS) Rename(oldname, newname string) error {
+	err := f.Fs.Rename(oldname, newname)
+	if err == nil {
+		oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+		f.mux.Lock()
+		if data, ok := f.durable[oldname]; ok {
+			f.durable[newname] = data
+			delete(f.durable, oldname)
+		} else {
+			delete(f.durable, newname)
+		}
+		f.mux.Unlock()
+	}
+	return err
+}
+
+// Name implements [afero.Fs].
+func (f *FS) Name() string { return "anviltest.FS" }
+
+// faultFile a file opened by [FS].
+type faultFile struct {
+	afero.File
+	fs   *FS
+	name string
+	// sync if the file was opened using [os.O_SYNC].
+	sync bool
+}
+
+func (f *faultFile) Write(p []byte) (n int, err error) {
+	return f.write(p, func(p []byte) (int, error) { return f.File.Write(p) })
+}
+
+func (f *faultFile) WriteAt(p []byte, off int64) (n int, err error) {
+	return f.write(p, func(p []byte) (int, error) { return f.File.WriteAt(p, off) })
+}
+
+func (f *faultFile) WriteString(s string) (n int, err error) { return f.Write([]byte(s)) }
+
+// write writes `p` using `fn` unless a fault is injected.
+func (f *faultFile) write(p []byte, fn func([]byte) (int, error)) (n int, err error) {
+	fl := f.fs.check(OpWrite)
+	if fl != nil {
+		if fl.Torn <= 0 {
+			return 0, fl.Err
+		}
+		p = p[:min(fl.Torn, len(p))]
+	}
+
+	if n, err = fn(p); err == nil && fl != nil {
+		err = fl.Err
+	}
+
+	if f.sync && n > 0 {
+		if syncErr := f.fs.sync(f.name); err == nil {
+			err = syncErr
+		}
+	}
+	return n, err
+}
+
+func (f *faultFile) Sync() (err error) {
+	if fl := f.fs.check(OpSync); fl != nil {
+		return fl.Err
+	}
+	if err = f.File.Sync(); err == nil {
+		err = f.fs.sync(f.name)
+	}
+	return err
+}
+
+func (f *faultFile) Truncate(size int64) (err error) {
+	if fl := f.fs.check(OpTruncate); fl != nil {
+		return fl.Err
+	}
+	if err = f.File.Truncate(size); err == nil && f.sync {
+		err = f.fs.sync(f.name)
+	}
+	return err
+}
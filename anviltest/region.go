@@ -0,0 +1,250 @@
+package anviltest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/afero"
+	"github.com/yehan2002/errors"
+)
+
+// the file names used by [anvil.Settings] by default.
+const (
+	anvilFmt = "r.%d.%d.mca"
+	chunkFmt = "c.%d.%d.mcc"
+)
+
+// Entry an entry in a [Region].
+// Fields other than X, Z and Data can be used to create corrupted entries.
+type Entry struct {
+	// X, Z the position of the entry in the anvil file. These must be less than 32.
+	X, Z uint8
+	// Data the decompressed data of the entry.
+	Data []byte
+	// Method the compression method used to compress Data.
+	// Methods that use a dictionary are only supported if Raw is set.
+	// Default: [anvil.CompressionZlib]
+	Method anvil.CompressMethod
+	// Raw if Data is stored without compressing it.
+	// This can be used to store invalid compressed data.
+	Raw bool
+	// External if the data is stored in an external file.
+	External bool
+	// Timestamp the modification time stored in the header.
+	// If this is zero, the timestamp in the header is 0.
+	Timestamp time.Time
+
+	// Offset the section the entry starts at.
+	// If this is 0, the entry is stored in the first section after the previous entry.
+	Offset uint32
+	// Sections the number of sections stored in the header for the entry.
+	// If this is 0, the number of sections needed to store the entry is used.
+	Sections uint8
+	// Length the length stored in the entry header, which includes the compression byte.
+	// If this is 0, the correct length is used.
+	Length uint32
+}
+
+// Region builds an anvil file.
+type Region struct {
+	// X, Z the position of the anvil file.
+	X, Z int32
+	// Entries the entries stored in the anvil file in the order they are stored.
+	Entries []Entry
+	// Size the size of the anvil file in bytes.
+	// This can be used to truncate the file or to add free space at the end of it.
+	// If this is 0, the file ends after the last section used by an entry.
+	Size int64
+}
+
+// Build returns the content of the anvil file and the external files
+// by the position of the entries stored in them.
+func (r *Region) Build() (file []byte, external map[anvil.ChunkPos][]byte, err error) {
+	file = make([]byte, anvil.SectionSize*2)
+	external = map[anvil.ChunkPos][]byte{}
+
+	next := uint32(2)
+	for _, e := range r.Entries {
+		if e.X > 31 || e.Z > 31 {
+			return nil, nil, fmt.Errorf("anviltest: invalid entry position (%d,%d)", e.X, e.Z)
+		}
+
+		data := e.Data
+		if !e.Raw {
+			if data, err = compress(e.Method, data); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		method := e.Method
+		if method == 0 {
+			method = anvil.CompressionZlib
+		}
+
+		if e.External {
+			external[anvil.ChunkPos{X: r.X<<5 | int32(e.X), Z: r.Z<<5 | int32(e.Z)}] = data
+			data = nil
+			method |= 0x80
+		}
+
+		length := e.Length
+		if length == 0 {
+			length = uint32(len(data)) + 1
+		}
+
+		// the length and compression method are followed by the data
+		entry := binary.BigEndian.AppendUint32(nil, length)
+		entry = append(entry, byte(method))
+		entry = append(entry, data...)
+
+		needed := (len(entry) + anvil.SectionSize - 1) / anvil.SectionSize
+		if needed > 255 {
+			return nil, nil, fmt.Errorf("anviltest: entry (%d,%d) does not fit in an anvil file, set External", e.X, e.Z)
+		}
+
+		offset, sections := e.Offset, e.Sections
+		if offset == 0 {
+			offset = next
+		}
+		if sections == 0 {
+			sections = uint8(needed)
+		}
+
+		end := int(offset+uint32(needed)) * anvil.SectionSize
+		if end > len(file) {
+			file = append(file, make([]byte, end-len(file))...)
+		}
+		copy(file[int(offset)*anvil.SectionSize:], entry)
+		next = max(next, offset+uint32(needed))
+
+		index := int(e.X)<<2 | int(e.Z)<<7
+		binary.BigEndian.PutUint32(file[index:], offset<<8|uint32(sections))
+		binary.BigEndian.PutUint32(file[anvil.SectionSize+index:], uint32(timestamp(e.Timestamp)))
+	}
+
+	if r.Size > 0 {
+		if r.Size < int64(len(file)) {
+			file = file[:r.Size]
+		} else {
+			file = append(file, make([]byte, r.Size-int64(len(file)))...)
+		}
+	}
+	return file, external, nil
+}
+
+// Write writes the anvil file and its external files to `fs`
+// using the default file names of [anvil.Settings].
+func (r *Region) Write(fs afero.Fs) error {
+	file, external, err := r.Build()
+	if err != nil {
+		return err
+	}
+
+	if err = afero.WriteFile(fs, fmt.Sprintf(anvilFmt, r.X, r.Z), file, 0666); err != nil {
+		return errors.Wrap("anviltest: unable to write anvil file", err)
+	}
+
+	for pos, data := range external {
+		if err = afero.WriteFile(fs, fmt.Sprintf(chunkFmt, pos.X, pos.Z), data, 0666); err != nil {
+			return errors.Wrap("anviltest: unable to write external file", err)
+		}
+	}
+	return nil
+}
+
+// World builds a world containing the given anvil files in an in-memory filesystem.
+// The returned filesystem can be opened using [anvil.OpenFs].
+func World(regions ...Region) (afero.Fs, error) {
+	fs := afero.NewMemMapFs()
+	for i := range regions {
+		if err := regions[i].Write(fs); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+// Packed returns an anvil file containing `count` entries of `size` bytes
+// stored one after the other in the order of their position.
+// The entries contain the data returned by [Data].
+func Packed(rgX, rgZ int32, count, size int) Region {
+	return Sparse(rgX, rgZ, count, size, 0)
+}
+
+// Sparse is the same as [Packed] but leaves at least `gap` free sections after each entry.
+func Sparse(rgX, rgZ int32, count, size, gap int) Region {
+	r := Region{X: rgX, Z: rgZ}
+
+	next := uint32(2)
+	for i := 0; i < count && i < anvil.Entries; i++ {
+		x, z := uint8(i&31), uint8(i>>5)
+		e := Entry{X: x, Z: z, Data: Data(anvil.ChunkPos{X: rgX<<5 | int32(x), Z: rgZ<<5 | int32(z)}, size)}
+
+		if gap > 0 {
+			// the size of the compressed data is not known, so reserve space for the uncompressed data
+			e.Offset = next
+			next += uint32((size+5+anvil.SectionSize-1)/anvil.SectionSize + gap)
+		}
+		r.Entries = append(r.Entries, e)
+	}
+	return r
+}
+
+// Data returns `size` bytes of data for the entry at the given position.
+// The same data is returned for the same position and size.
+// Like the data of real entries, the returned data is compressible.
+func Data(pos anvil.ChunkPos, size int) []byte {
+	rng := rand.New(rand.NewSource(int64(pos.X)<<32 | int64(uint32(pos.Z))))
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = "anvil-test-data "[rng.Intn(16)]
+	}
+	return data
+}
+
+// compress compresses data using the given compression method.
+func compress(method anvil.CompressMethod, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+
+	switch method {
+	case 0, anvil.CompressionZlib:
+		w = zlib.NewWriter(&buf)
+	case anvil.CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case anvil.CompressionNone:
+		return data, nil
+	case anvil.CompressionZstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("anviltest: unsupported compression method %s, set Raw to store compressed data", method)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// timestamp returns the timestamp stored in the header for the given time.
+func timestamp(t time.Time) int32 {
+	if t.IsZero() {
+		return 0
+	}
+	return int32(t.Unix())
+}
@@ -0,0 +1,341 @@
+// Command anvil exports and imports chunks, archives worlds and manages compression.
+//
+// Usage:
+//
+//	anvil export [-format snbt|json] [-o file] <dir> <x> <z>
+//	anvil import [-format snbt|json] [-i file] <dir> <x> <z>
+//	anvil duplicates [-n count] <dir>
+//	anvil archive [-o file] <dir>
+//	anvil extract [-i file] <dir>
+//	anvil train [-id id] [-size bytes] [-samples count] <dir>
+//	anvil recompress [-method method] <dir>
+//
+// <dir> is the directory containing the anvil files (e.g. the `region` directory of a world)
+// and <x> <z> are the chunk coordinates.
+// export and import convert a chunk to and from SNBT or JSON.
+// duplicates reports chunks with identical content, and archive and extract
+// create and extract an archive that stores identical chunks once.
+// train trains a zstd dictionary from the chunks in <dir> and stores it in <dir>,
+// and recompress rewrites every chunk using the given compression method
+// (gzip, zlib, none, zstd or zstd:<id> to use a dictionary).
+// Dictionaries stored in <dir> are loaded by every command.
+// Output is written to stdout and input is read from stdin unless -o or -i is given.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/FireworkMC/anvil/dedup"
+	"github.com/FireworkMC/anvil/dump"
+	"github.com/spf13/afero"
+)
+
+const usage = `usage:
+  anvil export [-format snbt|json] [-o file] <dir> <x> <z>
+  anvil import [-format snbt|json] [-i file] <dir> <x> <z>
+  anvil duplicates [-n count] <dir>
+  anvil archive [-o file] <dir>
+  anvil extract [-i file] <dir>
+  anvil train [-id id] [-size bytes] [-samples count] <dir>
+  anvil recompress [-method method] <dir>
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = export(os.Args[2:])
+	case "import":
+		err = importChunk(os.Args[2:])
+	case "duplicates":
+		err = duplicates(os.Args[2:])
+	case "archive":
+		err = archive(os.Args[2:])
+	case "extract":
+		err = extract(os.Args[2:])
+	case "train":
+		err = train(os.Args[2:])
+	case "recompress":
+		err = recompress(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func export(args []string) (err error) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "snbt", "the output format (snbt or json)")
+	output := flags.String("o", "", "the output file (default stdout)")
+
+	dir, x, z, f, err := parseArgs(flags, args, format)
+	if err != nil {
+		return err
+	}
+
+	world, err := openDir(dir, anvil.Settings{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer closeWorld(world, &err)
+
+	w, closeFn, err := create(*output)
+	if err != nil {
+		return err
+	}
+	defer closeFn(&err)
+
+	return dump.Export(w, world, x, z, f)
+}
+
+func importChunk(args []string) (err error) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "snbt", "the input format (snbt or json)")
+	input := flags.String("i", "", "the input file (default stdin)")
+
+	dir, x, z, f, err := parseArgs(flags, args, format)
+	if err != nil {
+		return err
+	}
+
+	world, err := openDir(dir, anvil.Settings{})
+	if err != nil {
+		return err
+	}
+	defer closeWorld(world, &err)
+
+	r, closeFn, err := open(*input)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	return dump.Import(r, world, x, z, f)
+}
+
+func duplicates(args []string) (err error) {
+	flags := flag.NewFlagSet("duplicates", flag.ExitOnError)
+	count := flags.Int("n", 10, "the number of duplicate sets to list")
+
+	world, err := openWorld(flags, args, anvil.Settings{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer closeWorld(world, &err)
+
+	report, err := dedup.Find(context.Background(), world, 0)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d chunks, %d unique (%d of %d bytes)\n", report.Chunks, report.Unique, report.UniqueSize, report.Size)
+	for i, set := range report.Duplicates {
+		if i == *count {
+			fmt.Printf("... and %d more sets\n", len(report.Duplicates)-i)
+			break
+		}
+		first := set.Chunks[0]
+		fmt.Printf("%s: %d chunks of %d bytes, first at (%d,%d)\n", set.Hash, len(set.Chunks), set.Size, first.X, first.Z)
+	}
+	return nil
+}
+
+func archive(args []string) (err error) {
+	flags := flag.NewFlagSet("archive", flag.ExitOnError)
+	output := flags.String("o", "", "the output file (default stdout)")
+
+	world, err := openWorld(flags, args, anvil.Settings{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer closeWorld(world, &err)
+
+	w, closeFn, err := create(*output)
+	if err != nil {
+		return err
+	}
+	defer closeFn(&err)
+
+	report, err := dedup.Create(context.Background(), w, world, 0)
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "archived %d chunks, %d unique\n", report.Chunks, report.Unique)
+	}
+	return err
+}
+
+func extract(args []string) (err error) {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	input := flags.String("i", "", "the input file (default stdin)")
+
+	world, err := openWorld(flags, args, anvil.Settings{})
+	if err != nil {
+		return err
+	}
+	defer closeWorld(world, &err)
+
+	r, closeFn, err := open(*input)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	return dedup.Extract(context.Background(), r, world)
+}
+
+func train(args []string) (err error) {
+	flags := flag.NewFlagSet("train", flag.ExitOnError)
+	id := flags.Uint("id", 1, "the ID of the dictionary")
+	size := flags.Int("size", anvil.DefaultDictionarySize, "the maximum size of the dictionary in bytes")
+	samples := flags.Int("samples", anvil.DefaultDictionarySamples, "the maximum number of chunks used to train the dictionary")
+
+	world, err := openWorld(flags, args, anvil.Settings{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer closeWorld(world, &err)
+
+	if *id < 1 || *id > anvil.MaxDictionaryID {
+		return fmt.Errorf("anvil: the dictionary ID must be between 1 and %d", anvil.MaxDictionaryID)
+	}
+
+	options := anvil.TrainOptions{ID: uint8(*id), Size: *size, Samples: *samples}
+	dict, err := anvil.TrainDictionary(context.Background(), world, options)
+	if err != nil {
+		return err
+	}
+
+	if err = anvil.WriteDictionary(afero.NewBasePathFs(afero.NewOsFs(), flags.Arg(0)), dict); err == nil {
+		fmt.Fprintf(os.Stderr, "trained a %d byte dictionary, use it with: anvil recompress -method %s %s\n", len(dict.Bytes()), dict.Method(), flags.Arg(0))
+	}
+	return err
+}
+
+func recompress(args []string) (err error) {
+	flags := flag.NewFlagSet("recompress", flag.ExitOnError)
+	name := flags.String("method", "zlib", "the compression method (gzip, zlib, none, zstd or zstd:<id>)")
+
+	world, err := openWorld(flags, args, anvil.Settings{})
+	if err != nil {
+		return err
+	}
+	defer closeWorld(world, &err)
+
+	method, err := anvil.ParseCompressMethod(*name)
+	if err != nil {
+		return err
+	}
+	return anvil.Recompress(context.Background(), world, method, 0)
+}
+
+// openDir opens the given directory and loads the dictionaries stored in it.
+func openDir(dir string, settings anvil.Settings) (world *anvil.Anvil, err error) {
+	if settings.Dictionaries, err = anvil.ReadDictionaries(afero.NewBasePathFs(afero.NewOsFs(), dir)); err != nil {
+		return nil, err
+	}
+	return anvil.Open(dir, settings)
+}
+
+// closeWorld closes the world and sets *err if closing failed.
+func closeWorld(world *anvil.Anvil, err *error) {
+	if closeErr := world.Close(); *err == nil {
+		*err = closeErr
+	}
+}
+
+// openWorld parses the flags and opens the directory given as the only positional argument.
+func openWorld(flags *flag.FlagSet, args []string, settings anvil.Settings) (*anvil.Anvil, error) {
+	setUsage(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if !settings.ReadOnly {
+		if err := os.MkdirAll(flags.Arg(0), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return openDir(flags.Arg(0), settings)
+}
+
+// create creates the given file or returns stdout if name is empty.
+// closeFn closes the file and sets *err if closing failed.
+func create(name string) (w io.Writer, closeFn func(err *error), err error) {
+	if name == "" {
+		return os.Stdout, func(*error) {}, nil
+	}
+
+	var file *os.File
+	if file, err = os.Create(name); err != nil {
+		return nil, nil, err
+	}
+	return file, func(err *error) {
+		if closeErr := file.Close(); *err == nil {
+			*err = closeErr
+		}
+	}, nil
+}
+
+// open opens the given file or returns stdin if name is empty.
+func open(name string) (r io.Reader, closeFn func() error, err error) {
+	if name == "" {
+		return os.Stdin, func() error { return nil }, nil
+	}
+
+	var file *os.File
+	if file, err = os.Open(name); err != nil {
+		return nil, nil, err
+	}
+	return file, file.Close, nil
+}
+
+// setUsage sets the usage function of the given flag set.
+func setUsage(flags *flag.FlagSet) {
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+}
+
+// parseArgs parses the flags and the positional arguments of the export and import commands.
+func parseArgs(flags *flag.FlagSet, args []string, format *string) (dir string, x, z int32, f dump.Format, err error) {
+	setUsage(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 3 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if f, err = dump.ParseFormat(*format); err != nil {
+		return
+	}
+
+	var pos [2]int32
+	for i, arg := range flags.Args()[1:] {
+		var v int64
+		if v, err = strconv.ParseInt(arg, 10, 32); err != nil {
+			return "", 0, 0, 0, fmt.Errorf("anvil: invalid chunk coordinate %q", arg)
+		}
+		pos[i] = int32(v)
+	}
+	return flags.Arg(0), pos[0], pos[1], f, nil
+}
@@ -1,11 +1,15 @@
 package anvil
 
 import (
+	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/klauspost/compress/gzip"
 	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
 	"github.com/yehan2002/errors"
 )
 
@@ -21,22 +25,83 @@ const (
 	CompressionZlib
 	CompressionNone
 
+	// CompressionZstd compresses data using zstd without a dictionary.
+	// Use [CompressionZstdDict] to compress data using a dictionary.
+	// Entries compressed using zstd cannot be read by Minecraft.
+	CompressionZstd CompressMethod = 0x40
+
 	externalMask = 0x80
+	// dictMask the bits of a zstd compression method that hold the dictionary ID.
+	dictMask = 0x3f
 )
 
+// CompressionZstdDict returns the compression method that compresses data using zstd
+// with the dictionary with the given ID.
+// The ID is stored in the header of each entry, so the dictionary must be in
+// [Settings.Dictionaries] to read or write entries using this method.
+// `id` must be between 1 and [MaxDictionaryID].
+func CompressionZstdDict(id uint8) CompressMethod {
+	return CompressionZstd | CompressMethod(id&dictMask)
+}
+
+// ParseCompressMethod parses a compression method returned by [CompressMethod.String].
+func ParseCompressMethod(name string) (CompressMethod, error) {
+	switch name {
+	case "gzip":
+		return CompressionGzip, nil
+	case "zlib":
+		return CompressionZlib, nil
+	case "none":
+		return CompressionNone, nil
+	case "zstd":
+		return CompressionZstd, nil
+	}
+
+	if id, ok := strings.CutPrefix(name, "zstd:"); ok {
+		if v, err := strconv.ParseUint(id, 10, 8); err == nil && v >= 1 && v <= MaxDictionaryID {
+			return CompressionZstdDict(uint8(v)), nil
+		}
+	}
+	return 0, fmt.Errorf("anvil: unknown compression method %q", name)
+}
+
 func (c CompressMethod) String() string {
-	switch c {
-	case CompressionGzip:
+	switch {
+	case c == CompressionGzip:
 		return "gzip"
-	case CompressionZlib:
+	case c == CompressionZlib:
 		return "zlib"
-	case CompressionNone:
+	case c == CompressionNone:
 		return "none"
+	case c == CompressionZstd:
+		return "zstd"
+	case c.supported():
+		return "zstd:" + strconv.Itoa(int(c.Dictionary()))
 	default:
 		return "unsupported"
 	}
 }
 
+// Dictionary returns the ID of the zstd dictionary used by the compression method.
+// This returns 0 if the method does not use a dictionary.
+func (c CompressMethod) Dictionary() uint8 {
+	if c&^dictMask != CompressionZstd {
+		return 0
+	}
+	return uint8(c & dictMask)
+}
+
+// supported returns if the compression method is supported.
+func (c CompressMethod) supported() bool {
+	switch {
+	case c == CompressionGzip || c == CompressionZlib || c == CompressionNone:
+		return true
+	case c&^dictMask == CompressionZstd:
+		return c.Dictionary() <= MaxDictionaryID
+	}
+	return false
+}
+
 var (
 	gzipDecompressPool = decompressorPool{new: func(src io.ReadCloser) (readCloseResetter, error) {
 		return gzip.NewReader(src)
@@ -48,8 +113,20 @@ var (
 		}
 		return &zlibReadResetWrapper{t.(zlibReader)}, err
 	}}
+	zstdDecompressPool = newZstdDecompressPool(nil)
 )
 
+// newZstdDecompressPool returns a pool of zstd decoders that can use the given dictionaries.
+func newZstdDecompressPool(dicts [][]byte) decompressorPool {
+	return decompressorPool{new: func(src io.ReadCloser) (readCloseResetter, error) {
+		d, err := zstd.NewReader(src, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true), zstd.WithDecoderDicts(dicts...))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReadResetWrapper{d}, nil
+	}}
+}
+
 // decompressorPool a pool of readCloseResetters that can be used to decompress data
 type decompressorPool struct {
 	sync.Pool
@@ -68,38 +145,104 @@ func (d *decompressorPool) Get(src io.ReadCloser) (dec *decompressor, err error)
 }
 
 // decompressor returns a decompressor for the compression method.
+// `dicts` holds the dictionaries available to zstd compression methods and may be nil.
 // Callers must close the returned reader after use for it to be reused.
 // Trying to use the reader after calling Close will cause a panic.
-func (c CompressMethod) decompressor(src io.ReadCloser) (reader io.ReadCloser, err error) {
-	switch c {
-	case CompressionGzip:
+func (c CompressMethod) decompressor(src io.ReadCloser, dicts *dictionaries) (reader io.ReadCloser, err error) {
+	switch {
+	case c == CompressionGzip:
 		reader, err = gzipDecompressPool.Get(src)
-	case CompressionZlib:
+	case c == CompressionZlib:
 		reader, err = zlibDecompressPool.Get(src)
-	case CompressionNone:
+	case c == CompressionNone:
 		reader = io.NopCloser(src)
+	case c == CompressionZstd:
+		reader, err = zstdDecompressPool.Get(src)
+	case c.supported():
+		if dicts.get(c.Dictionary()) == nil {
+			return nil, dictionaryErr(c.Dictionary())
+		}
+		reader, err = dicts.decompress.Get(src)
 	default:
 		err = errors.New("unsupported compression method")
 	}
 	return reader, errors.Wrap("anvil: unable to decompress", err)
 }
 
-// compressor returns a compressor for the compression method.
-// Callers should reuse the returned compressor and should only
-// create a new one when the compression method changes.
-func (c CompressMethod) compressor() (compressor, error) {
-	switch c {
-	case CompressionGzip:
-		return gzip.NewWriter(io.Discard), nil
-	case CompressionZlib:
-		return zlib.NewWriter(io.Discard), nil
-	case CompressionNone:
-		return &noopCompressor{}, nil
+var (
+	gzipCompressPool = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+	zlibCompressPool = sync.Pool{New: func() interface{} { return zlib.NewWriter(io.Discard) }}
+	noneCompressPool = sync.Pool{New: func() interface{} { return &noopCompressor{} }}
+	zstdCompressPool = newZstdCompressPool(nil)
+)
+
+// newZstdCompressPool returns a pool of zstd encoders that use the given dictionary.
+// If the encoder cannot be created, the pool returns nil.
+func newZstdCompressPool(dict []byte) *sync.Pool {
+	return &sync.Pool{New: func() interface{} {
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true)}
+		if dict != nil {
+			opts = append(opts, zstd.WithEncoderDict(dict))
+		}
+
+		if e, err := zstd.NewWriter(io.Discard, opts...); err == nil {
+			return e
+		}
+		return nil
+	}}
+}
+
+// compressPool returns the pool of compressors for the compression method.
+// `dicts` holds the dictionaries available to zstd compression methods and may be nil.
+// Compressors returned by the pool must be put back into it after use.
+func (c CompressMethod) compressPool(dicts *dictionaries) (*sync.Pool, error) {
+	switch {
+	case c == CompressionGzip:
+		return &gzipCompressPool, nil
+	case c == CompressionZlib:
+		return &zlibCompressPool, nil
+	case c == CompressionNone:
+		return &noneCompressPool, nil
+	case c == CompressionZstd:
+		return zstdCompressPool, nil
+	case c.supported():
+		if dicts.get(c.Dictionary()) == nil {
+			return nil, dictionaryErr(c.Dictionary())
+		}
+		return dicts.compress[c.Dictionary()], nil
 	default:
 		return nil, errors.New("anvil: unsupported compression method")
 	}
 }
 
+// compress compresses `b` using the compression method and returns a buffer containing the compressed data.
+// This can be called concurrently.
+func (c CompressMethod) compress(b []byte, dicts *dictionaries) (buf *buffer, err error) {
+	var pool *sync.Pool
+	if pool, err = c.compressPool(dicts); err != nil {
+		return nil, err
+	}
+
+	w, ok := pool.Get().(compressor)
+	if !ok {
+		return nil, errors.New("anvil: unable to create compressor")
+	}
+	defer pool.Put(w)
+
+	buf = &buffer{}
+	buf.CompressMethod(c)
+	w.Reset(buf)
+
+	if _, err = w.Write(b); err == nil {
+		if err = w.Close(); err == nil {
+			return buf, nil
+		}
+	}
+
+	buf.Reset()
+	return nil, err
+}
+
 type compressor interface {
 	io.WriteCloser
 	Reset(io.Writer)
@@ -134,6 +277,12 @@ type zlibReadResetWrapper struct{ zlibReader }
 
 func (z *zlibReadResetWrapper) Reset(r io.Reader) error { return z.zlibReader.Reset(r, nil) }
 
+// zstdReadResetWrapper a wrapper around zstd.Decoder to make it implement the readResetCloser interface.
+// Close does nothing since the decoder cannot be used after it is closed.
+type zstdReadResetWrapper struct{ *zstd.Decoder }
+
+func (z *zstdReadResetWrapper) Close() error { return nil }
+
 type readCloseResetter interface {
 	io.Reader
 	io.Closer
@@ -142,6 +291,7 @@ type readCloseResetter interface {
 
 var _ readCloseResetter = &zlibReadResetWrapper{}
 var _ readCloseResetter = &gzip.Reader{}
+var _ readCloseResetter = &zstdReadResetWrapper{}
 
 // noopCompressor a compressor that does nothing.
 type noopCompressor struct{ dst io.Writer }
@@ -0,0 +1,160 @@
+// Package dataversion reads the data version of chunks and upgrades chunks
+// saved by older versions of the game.
+package dataversion
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/FireworkMC/anvil/nbt"
+	"github.com/yehan2002/errors"
+)
+
+// ErrMissing returned if a chunk does not have a data version.
+// Chunks saved before 1.9 do not store their data version.
+const ErrMissing = errors.Const("dataversion: chunk does not have a data version")
+
+// The data versions of some releases.
+const (
+	V1_16 int32 = 2566
+	V1_17 int32 = 2724
+	V1_18 int32 = 2860
+	V1_19 int32 = 3105
+	V1_20 int32 = 3463
+	V1_21 int32 = 3953
+)
+
+// Read reads the data version from the given uncompressed chunk data.
+// Only the tags before the `DataVersion` tag are read, and they are not decoded.
+func Read(r io.Reader) (version int32, err error) {
+	var v any
+	if v, err = nbt.Find(r, "DataVersion"); err != nil {
+		if errors.Is(err, nbt.ErrNotFound) {
+			err = ErrMissing
+		}
+		return 0, err
+	}
+
+	if version, ok := v.(int32); ok {
+		return version, nil
+	}
+	return 0, errors.CauseStr(nbt.ErrInvalid, "DataVersion is not an int")
+}
+
+// Get reads the data version of the chunk at x,z.
+func Get(a *anvil.Anvil, x, z int32) (version int32, err error) {
+	err = a.ReadFn(x, z, func(r io.Reader) (err error) {
+		version, err = Read(r)
+		return
+	})
+	return
+}
+
+// Histogram counts the number of chunks in the world for each data version.
+// Chunks without a data version are counted as version 0.
+// See [anvil.Walk] for the meaning of `concurrency`.
+func Histogram(ctx context.Context, a *anvil.Anvil, concurrency int) (map[int32]int, error) {
+	var mux sync.Mutex
+	histogram := map[int32]int{}
+
+	err := anvil.Walk(ctx, a, concurrency, func(_ anvil.ChunkPos, r io.Reader) error {
+		version, err := Read(r)
+		if err != nil && !errors.Is(err, ErrMissing) {
+			return err
+		}
+
+		mux.Lock()
+		histogram[version]++
+		mux.Unlock()
+		return nil
+	})
+
+	return histogram, err
+}
+
+// Upgrade upgrades a chunk to the data version it was registered with.
+// The `DataVersion` tag is updated after the upgrade returns.
+type Upgrade func(chunk nbt.Compound) (nbt.Compound, error)
+
+// Registry a list of upgrades.
+type Registry struct {
+	mux      sync.RWMutex
+	upgrades []upgrade
+}
+
+type upgrade struct {
+	version int32
+	fn      Upgrade
+}
+
+// Register registers an upgrade that upgrades chunks to the given version.
+// The upgrade is applied to every chunk with a data version lower than `version`.
+func (r *Registry) Register(version int32, fn Upgrade) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.upgrades = append(r.upgrades, upgrade{version: version, fn: fn})
+	sort.SliceStable(r.upgrades, func(i, j int) bool { return r.upgrades[i].version < r.upgrades[j].version })
+}
+
+// Upgrade applies every registered upgrade for versions newer than the chunk's
+// data version in order of their versions.
+// This returns if any upgrades were applied.
+func (r *Registry) Upgrade(chunk nbt.Compound) (_ nbt.Compound, upgraded bool, err error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	version, _ := chunk.Int("DataVersion")
+	for _, u := range r.upgrades {
+		if int64(u.version) <= version {
+			continue
+		}
+
+		if chunk, err = u.fn(chunk); err != nil {
+			return nil, false, errors.Wrap(fmt.Sprintf("dataversion: unable to upgrade chunk to %d", u.version), err)
+		}
+
+		chunk = setVersion(chunk, u.version)
+		version, upgraded = int64(u.version), true
+	}
+	return chunk, upgraded, nil
+}
+
+// Apply upgrades every chunk in the world.
+// Chunks are only written back if an upgrade was applied.
+// See [anvil.WalkModify] for the meaning of `concurrency`.
+func (r *Registry) Apply(ctx context.Context, a *anvil.Anvil, concurrency int) error {
+	return anvil.WalkModify(ctx, a, concurrency, func(_ anvil.ChunkPos, src io.Reader) ([]byte, error) {
+		name, chunk, err := nbt.Read(src)
+		if err != nil {
+			return nil, err
+		}
+
+		var upgraded bool
+		if chunk, upgraded, err = r.Upgrade(chunk); err != nil || !upgraded {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err = nbt.Write(&buf, name, chunk); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	})
+}
+
+// setVersion sets the `DataVersion` tag in the given chunk.
+func setVersion(chunk nbt.Compound, version int32) nbt.Compound {
+	for i, f := range chunk {
+		if f.Name == "DataVersion" {
+			chunk[i].Value = version
+			return chunk
+		}
+	}
+	return append(chunk, nbt.Field{Name: "DataVersion", Value: version})
+}
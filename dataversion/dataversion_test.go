@@ -0,0 +1,110 @@
+package dataversion
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/FireworkMC/anvil/nbt"
+	"github.com/spf13/afero"
+	"github.com/yehan2002/errors"
+	"github.com/yehan2002/is/v2"
+)
+
+type versionTest struct{}
+
+func TestDataVersion(t *testing.T) { is.SuiteP(t, &versionTest{}) }
+
+func encode(is is.Is, root nbt.Compound) []byte {
+	var buf bytes.Buffer
+	err := nbt.Write(&buf, "", root)
+	is(err == nil, "unexpected error: %s", err)
+	return buf.Bytes()
+}
+
+// oldChunk creates a chunk in the format used before 1.18.
+func oldChunk(version int32) nbt.Compound {
+	return nbt.Compound{
+		{Name: "Level", Value: nbt.Compound{
+			{Name: "xPos", Value: int32(0)},
+			{Name: "Sections", Value: nbt.List{Type: nbt.TagCompound, Values: []any{}}},
+		}},
+		{Name: "DataVersion", Value: version},
+	}
+}
+
+func (*versionTest) world(is is.Is) *anvil.Anvil {
+	world, err := anvil.OpenFs(afero.NewMemMapFs())
+	is(err == nil, "unexpected error: %s", err)
+
+	chunks := map[anvil.ChunkPos]nbt.Compound{
+		{X: 0, Z: 0}:  oldChunk(V1_16),
+		{X: 1, Z: 0}:  oldChunk(V1_17),
+		{X: 40, Z: 0}: oldChunk(V1_17),
+		{X: 2, Z: 0}:  {{Name: "DataVersion", Value: V1_20}},
+		{X: 3, Z: 0}:  {{Name: "Level", Value: nbt.Compound{}}},
+	}
+	for pos, c := range chunks {
+		err = world.Write(pos.X, pos.Z, encode(is, c))
+		is(err == nil, "unexpected error: %s", err)
+	}
+	return world
+}
+
+func (v *versionTest) TestRead(is is.Is) {
+	world := v.world(is)
+
+	version, err := Get(world, 1, 0)
+	is(err == nil, "unexpected error: %s", err)
+	is(version == V1_17, "incorrect version: %d", version)
+
+	_, err = Get(world, 3, 0)
+	is(errors.Is(err, ErrMissing), "incorrect error: %s", err)
+
+	_, err = Read(bytes.NewReader(encode(is, nbt.Compound{{Name: "DataVersion", Value: "1"}})))
+	is(errors.Is(err, nbt.ErrInvalid), "incorrect error: %s", err)
+}
+
+func (v *versionTest) TestHistogram(is is.Is) {
+	histogram, err := Histogram(context.Background(), v.world(is), 0)
+	is(err == nil, "unexpected error: %s", err)
+	is.Equal(histogram, map[int32]int{V1_16: 1, V1_17: 2, V1_20: 1, 0: 1}, "incorrect histogram")
+}
+
+func (v *versionTest) TestUpgrade(is is.Is) {
+	world := v.world(is)
+
+	var registry Registry
+	var calls []int32
+	// moves the contents of the `Level` tag to the root tag, similar to the change made in 1.18.
+	registry.Register(V1_18, func(chunk nbt.Compound) (nbt.Compound, error) {
+		calls = append(calls, V1_18)
+		level, _ := chunk.Compound("Level")
+		version, _ := chunk.Get("DataVersion")
+		return append(level, nbt.Field{Name: "DataVersion", Value: version}), nil
+	})
+	registry.Register(V1_17, func(chunk nbt.Compound) (nbt.Compound, error) {
+		calls = append(calls, V1_17)
+		return chunk, nil
+	})
+
+	err := registry.Apply(context.Background(), world, 1)
+	is(err == nil, "unexpected error: %s", err)
+
+	var chunk nbt.Compound
+	err = world.ReadFn(0, 0, func(r io.Reader) (err error) { _, chunk, err = nbt.Read(r); return })
+	is(err == nil, "unexpected error: %s", err)
+
+	version, _ := chunk.Int("DataVersion")
+	is(version == int64(V1_18), "incorrect version: %d", version)
+	_, ok := chunk.List("Sections")
+	is(ok, "chunk was not upgraded")
+
+	histogram, err := Histogram(context.Background(), world, 0)
+	is(err == nil, "unexpected error: %s", err)
+	is.Equal(histogram, map[int32]int{V1_18: 4, V1_20: 1}, "incorrect histogram")
+	// chunks without a data version are treated as version 0
+	is.Equal(calls, []int32{V1_17, V1_18, V1_18, V1_17, V1_18, V1_18}, "upgrades were called in the wrong order")
+}
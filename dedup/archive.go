@@ -0,0 +1,281 @@
+package dedup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/klauspost/compress/zstd"
+	"github.com/yehan2002/errors"
+)
+
+const (
+	// ErrInvalidArchive returned if an archive is invalid or corrupted.
+	ErrInvalidArchive = errors.Const("dedup: invalid archive")
+	// ErrModified returned by [Create] if a chunk was modified while the archive was being created.
+	ErrModified = errors.Const("dedup: chunk was modified while creating the archive")
+)
+
+// archiveMagic the magic bytes at the start of an archive.
+const archiveMagic = "ANVILDEDUP\x01"
+
+// MaxChunkSize the maximum size of the decompressed data of a chunk in an archive.
+const MaxChunkSize = 256 << 20
+
+// record kinds
+const (
+	recordEnd = iota
+	// recordData a chunk followed by its data.
+	recordData
+	// recordRef a chunk with the same content as an earlier data record.
+	recordRef
+)
+
+// flagRetain set on data records that are referenced by later records.
+const flagRetain = 1
+
+// Create writes every chunk in the world to `w` as an archive that stores
+// the content of identical chunks once.
+// The archive is compressed using zstd and preserves the timestamps of the chunks.
+// The world is read twice: once to find duplicates and once to write the chunks.
+// If a chunk is modified while the archive is created, this returns [ErrModified].
+// See [anvil.Walk] for the meaning of `concurrency`.
+func Create(ctx context.Context, w io.Writer, a *anvil.Anvil, concurrency int) (report *Report, err error) {
+	var hashes map[anvil.ChunkPos]chunkHash
+	if hashes, err = hashWorld(ctx, a, concurrency); err != nil {
+		return nil, err
+	}
+	report = newReport(hashes)
+
+	// the content of chunks with duplicates must be retained while extracting
+	retain := map[Hash]bool{}
+	for _, set := range report.Duplicates {
+		retain[set.Hash] = true
+	}
+
+	var chunks []anvil.ChunkPos
+	if chunks, err = allChunks(a); err != nil {
+		return nil, err
+	} else if len(chunks) != len(hashes) {
+		return nil, ErrModified
+	}
+
+	var enc *zstd.Encoder
+	if enc, err = zstd.NewWriter(w); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := enc.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	aw := &archiveWriter{w: bufio.NewWriter(enc)}
+	aw.w.WriteString(archiveMagic)
+
+	// the index of the data record for the content with the given hash
+	blobs := map[Hash]uint64{}
+	for _, pos := range chunks {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var entry anvil.Entry
+		var data []byte
+		if entry, _, err = a.Info(pos.X, pos.Z); err == nil {
+			data, err = a.Read(pos.X, pos.Z)
+		}
+		if err != nil {
+			return nil, errors.Wrap(fmt.Sprintf("dedup: unable to read chunk (%d,%d)", pos.X, pos.Z), err)
+		}
+
+		hash := Hash(sha256.Sum256(data))
+		if h, ok := hashes[pos]; !ok || h.hash != hash {
+			return nil, ErrModified
+		}
+
+		if index, ok := blobs[hash]; ok {
+			aw.ref(pos, entry.Modified(), index)
+			continue
+		}
+
+		flags := uint64(0)
+		if retain[hash] {
+			flags = flagRetain
+		}
+		blobs[hash] = uint64(len(blobs))
+		aw.data(pos, entry.Modified(), flags, data)
+	}
+
+	aw.w.WriteByte(recordEnd)
+	if err = aw.w.Flush(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// allChunks returns the position of every chunk in the world in the order they are stored.
+func allChunks(a *anvil.Anvil) (chunks []anvil.ChunkPos, err error) {
+	var regions []anvil.RegionPos
+	if regions, err = a.Regions(); err != nil {
+		return nil, err
+	}
+
+	for _, rg := range regions {
+		var f anvil.File
+		if f, err = a.File(rg.X, rg.Z); err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < anvil.Entries; i++ {
+			x, z := uint8(i&0x1f), uint8(i>>5)
+			if _, exists := f.Info(x, z); exists {
+				chunks = append(chunks, anvil.ChunkPos{X: rg.X<<5 | int32(x), Z: rg.Z<<5 | int32(z)})
+			}
+		}
+
+		if err = f.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	sortChunks(chunks)
+	return chunks, nil
+}
+
+type archiveWriter struct {
+	w   *bufio.Writer
+	tmp []byte
+}
+
+func (a *archiveWriter) header(kind byte, pos anvil.ChunkPos, modified time.Time) {
+	a.tmp = append(a.tmp[:0], kind)
+	a.tmp = binary.AppendVarint(a.tmp, int64(pos.X))
+	a.tmp = binary.AppendVarint(a.tmp, int64(pos.Z))
+	a.tmp = binary.AppendVarint(a.tmp, modified.Unix())
+}
+
+func (a *archiveWriter) data(pos anvil.ChunkPos, modified time.Time, flags uint64, data []byte) {
+	a.header(recordData, pos, modified)
+	a.tmp = binary.AppendUvarint(a.tmp, flags)
+	a.tmp = binary.AppendUvarint(a.tmp, uint64(len(data)))
+	a.w.Write(a.tmp)
+	a.w.Write(data)
+}
+
+func (a *archiveWriter) ref(pos anvil.ChunkPos, modified time.Time, index uint64) {
+	a.header(recordRef, pos, modified)
+	a.tmp = binary.AppendUvarint(a.tmp, index)
+	a.w.Write(a.tmp)
+}
+
+// Extract writes every chunk in the archive to `dst` using [anvil.Anvil.WriteWithOptions].
+// The timestamps of the chunks are preserved.
+// Only the content of chunks that have duplicates is kept in memory while extracting.
+func Extract(ctx context.Context, r io.Reader, dst *anvil.Anvil) error {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+
+	br := bufio.NewReader(dec)
+	magic := make([]byte, len(archiveMagic))
+	if _, err = io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, []byte(archiveMagic)) {
+		return archiveErr(err, "invalid magic")
+	}
+
+	retained := map[uint64][]byte{}
+	var blobCount uint64
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		var kind byte
+		if kind, err = br.ReadByte(); err != nil {
+			return archiveErr(err, "missing end of archive")
+		}
+
+		if kind == recordEnd {
+			return nil
+		} else if kind != recordData && kind != recordRef {
+			return archiveErr(nil, fmt.Sprintf("unknown record %d", kind))
+		}
+
+		var x, z, modified int64
+		if x, err = binary.ReadVarint(br); err == nil {
+			if z, err = binary.ReadVarint(br); err == nil {
+				modified, err = binary.ReadVarint(br)
+			}
+		}
+		if err != nil {
+			return archiveErr(err, "invalid record")
+		} else if x < math.MinInt32 || x > math.MaxInt32 || z < math.MinInt32 || z > math.MaxInt32 {
+			return archiveErr(nil, fmt.Sprintf("invalid chunk position (%d,%d)", x, z))
+		}
+
+		var data []byte
+		if kind == recordData {
+			if data, err = readData(br, blobCount, retained); err != nil {
+				return err
+			}
+			blobCount++
+		} else {
+			var index uint64
+			if index, err = binary.ReadUvarint(br); err != nil {
+				return archiveErr(err, "invalid record")
+			}
+			var ok bool
+			if data, ok = retained[index]; !ok {
+				return archiveErr(nil, fmt.Sprintf("reference to unknown data %d", index))
+			}
+		}
+
+		opts := anvil.WriteOptions{Timestamp: time.Unix(modified, 0)}
+		if err = dst.WriteWithOptions(int32(x), int32(z), data, opts); err != nil {
+			return errors.Wrap(fmt.Sprintf("dedup: unable to write chunk (%d,%d)", x, z), err)
+		}
+	}
+}
+
+// readData reads the data of a data record.
+func readData(br *bufio.Reader, index uint64, retained map[uint64][]byte) (data []byte, err error) {
+	var flags, size uint64
+	if flags, err = binary.ReadUvarint(br); err == nil {
+		size, err = binary.ReadUvarint(br)
+	}
+	if err != nil {
+		return nil, archiveErr(err, "invalid record")
+	}
+
+	if size == 0 || size > MaxChunkSize {
+		return nil, archiveErr(nil, fmt.Sprintf("invalid chunk size %d", size))
+	}
+
+	data = make([]byte, size)
+	if _, err = io.ReadFull(br, data); err != nil {
+		return nil, archiveErr(err, "truncated chunk data")
+	}
+
+	if flags&flagRetain != 0 {
+		retained[index] = data
+	}
+	return data, nil
+}
+
+// archiveErr returns an error that wraps [ErrInvalidArchive].
+// I/O errors other than unexpected EOFs are returned as is.
+func archiveErr(err error, msg string) error {
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	return errors.CauseStr(ErrInvalidArchive, msg)
+}
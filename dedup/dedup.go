@@ -0,0 +1,137 @@
+// Package dedup finds chunks with identical content and stores worlds
+// in an archive that contains each unique chunk once.
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/FireworkMC/anvil"
+)
+
+// Hash the SHA-256 hash of the decompressed data of a chunk.
+type Hash [sha256.Size]byte
+
+func (h Hash) String() string { return hex.EncodeToString(h[:]) }
+
+// Set a set of chunks with identical content.
+type Set struct {
+	Hash Hash
+	// Size the size of the decompressed data of each chunk.
+	Size int64
+	// Chunks the positions of the chunks sorted by their position.
+	Chunks []anvil.ChunkPos
+}
+
+// Wasted returns the number of decompressed bytes used by the duplicate chunks in the set.
+func (s *Set) Wasted() int64 { return s.Size * int64(len(s.Chunks)-1) }
+
+// Report the result of [Find].
+type Report struct {
+	// Chunks the number of chunks in the world.
+	Chunks int
+	// Unique the number of chunks with unique content.
+	Unique int
+	// Size the total size of the decompressed data of all chunks.
+	Size int64
+	// UniqueSize the total size of the decompressed data of the unique chunks.
+	UniqueSize int64
+	// Duplicates the sets of chunks that contain more than one chunk,
+	// sorted by the number of wasted bytes in descending order.
+	Duplicates []Set
+}
+
+// Find hashes the decompressed data of every chunk in the world and reports chunks with identical content.
+// See [anvil.Walk] for the meaning of `concurrency`.
+func Find(ctx context.Context, a *anvil.Anvil, concurrency int) (*Report, error) {
+	hashes, err := hashWorld(ctx, a, concurrency)
+	if err != nil {
+		return nil, err
+	}
+	return newReport(hashes), nil
+}
+
+// newReport creates a report from the hashes of every chunk in a world.
+func newReport(hashes map[anvil.ChunkPos]chunkHash) *Report {
+	sets := map[Hash]*Set{}
+	report := &Report{Chunks: len(hashes)}
+	for pos, h := range hashes {
+		set, ok := sets[h.hash]
+		if !ok {
+			set = &Set{Hash: h.hash, Size: h.size}
+			sets[h.hash] = set
+			report.Unique++
+			report.UniqueSize += h.size
+		}
+		set.Chunks = append(set.Chunks, pos)
+		report.Size += h.size
+	}
+
+	for _, set := range sets {
+		if len(set.Chunks) > 1 {
+			sortChunks(set.Chunks)
+			report.Duplicates = append(report.Duplicates, *set)
+		}
+	}
+
+	sort.Slice(report.Duplicates, func(i, j int) bool {
+		a, b := &report.Duplicates[i], &report.Duplicates[j]
+		if a.Wasted() != b.Wasted() {
+			return a.Wasted() > b.Wasted()
+		}
+		return bytes.Compare(a.Hash[:], b.Hash[:]) < 0
+	})
+	return report
+}
+
+type chunkHash struct {
+	hash Hash
+	size int64
+}
+
+// hashWorld hashes every chunk in the world.
+func hashWorld(ctx context.Context, a *anvil.Anvil, concurrency int) (map[anvil.ChunkPos]chunkHash, error) {
+	var mux sync.Mutex
+	hashes := map[anvil.ChunkPos]chunkHash{}
+
+	err := anvil.Walk(ctx, a, concurrency, func(pos anvil.ChunkPos, r io.Reader) error {
+		h := sha256.New()
+		n, err := io.Copy(h, r)
+		if err != nil {
+			return err
+		}
+
+		var c chunkHash
+		h.Sum(c.hash[:0])
+		c.size = n
+
+		mux.Lock()
+		hashes[pos] = c
+		mux.Unlock()
+		return nil
+	})
+	return hashes, err
+}
+
+// sortChunks sorts the given positions by region and then by their position in the region,
+// which is the order entries are stored in the header of an anvil file.
+func sortChunks(chunks []anvil.ChunkPos) {
+	sort.Slice(chunks, func(i, j int) bool {
+		a, b := chunks[i], chunks[j]
+		if ra, rb := a.Region(), b.Region(); ra != rb {
+			if ra.X != rb.X {
+				return ra.X < rb.X
+			}
+			return ra.Z < rb.Z
+		}
+		if a.Z != b.Z {
+			return a.Z < b.Z
+		}
+		return a.X < b.X
+	})
+}
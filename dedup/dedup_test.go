@@ -0,0 +1,131 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/afero"
+	"github.com/yehan2002/errors"
+	"github.com/yehan2002/is/v2"
+)
+
+type dedupTest struct{}
+
+func TestDedup(t *testing.T) { is.SuiteP(t, &dedupTest{}) }
+
+var (
+	void   = bytes.Repeat([]byte{0}, 100)
+	plains = bytes.Repeat([]byte{1}, 50)
+)
+
+// chunks the content of the chunks in the test world.
+var chunks = map[anvil.ChunkPos][]byte{
+	{X: 0, Z: 0}: void, {X: 1, Z: 0}: void, {X: 40, Z: -3}: void, {X: -100, Z: 7}: void,
+	{X: 2, Z: 0}: plains, {X: 2, Z: 1}: plains,
+	{X: 3, Z: 0}: []byte("unique"),
+}
+
+func (*dedupTest) world(is is.Is) *anvil.Anvil {
+	world, err := anvil.OpenFs(afero.NewMemMapFs())
+	is(err == nil, "unexpected error: %s", err)
+
+	for pos, data := range chunks {
+		opts := anvil.WriteOptions{Timestamp: time.Unix(int64(1000+pos.X), 0)}
+		err = world.WriteWithOptions(pos.X, pos.Z, data, opts)
+		is(err == nil, "unexpected error: %s", err)
+	}
+	return world
+}
+
+func (d *dedupTest) TestFind(is is.Is) {
+	report, err := Find(context.Background(), d.world(is), 0)
+	is(err == nil, "unexpected error: %s", err)
+
+	is(report.Chunks == 7 && report.Unique == 3, "incorrect report: %+v", report)
+	is(report.Size == 4*100+2*50+6 && report.UniqueSize == 100+50+6, "incorrect sizes: %+v", report)
+	is(len(report.Duplicates) == 2, "incorrect number of duplicates: %d", len(report.Duplicates))
+
+	set := report.Duplicates[0]
+	is(set.Size == 100 && set.Wasted() == 300, "incorrect set: %+v", set)
+	is.Equal(set.Chunks, []anvil.ChunkPos{{X: -100, Z: 7}, {X: 0, Z: 0}, {X: 1, Z: 0}, {X: 40, Z: -3}}, "incorrect chunks in set")
+	is(report.Duplicates[1].Size == 50, "incorrect set: %+v", report.Duplicates[1])
+}
+
+func (d *dedupTest) TestArchive(is is.Is) {
+	var archive bytes.Buffer
+	report, err := Create(context.Background(), &archive, d.world(is), 2)
+	is(err == nil, "unexpected error: %s", err)
+	is(report.Unique == 3, "incorrect report: %+v", report)
+
+	dst, err := anvil.OpenFs(afero.NewMemMapFs())
+	is(err == nil, "unexpected error: %s", err)
+	err = Extract(context.Background(), bytes.NewReader(archive.Bytes()), dst)
+	is(err == nil, "unexpected error: %s", err)
+
+	for pos, data := range chunks {
+		read, err := dst.Read(pos.X, pos.Z)
+		is(err == nil, "unexpected error: %s", err)
+		is(bytes.Equal(read, data), "incorrect data at (%d,%d)", pos.X, pos.Z)
+
+		entry, _, err := dst.Info(pos.X, pos.Z)
+		is(err == nil, "unexpected error: %s", err)
+		is(entry.Modified().Unix() == int64(1000+pos.X), "incorrect timestamp at (%d,%d)", pos.X, pos.Z)
+	}
+
+	regions, err := dst.Regions()
+	is(err == nil, "unexpected error: %s", err)
+	is(len(regions) == 3, "incorrect number of regions: %d", len(regions))
+}
+
+func (d *dedupTest) TestInvalid(is is.Is) {
+	var archive bytes.Buffer
+	_, err := Create(context.Background(), &archive, d.world(is), 0)
+	is(err == nil, "unexpected error: %s", err)
+
+	dst, err := anvil.OpenFs(afero.NewMemMapFs())
+	is(err == nil, "unexpected error: %s", err)
+
+	// truncate the archive by re-encoding a prefix of its content
+	var content bytes.Buffer
+	_, err = content.ReadFrom(mustDecode(is, archive.Bytes()))
+	is(err == nil, "unexpected error: %s", err)
+	for _, size := range []int{0, 5, content.Len() - 1} {
+		err = Extract(context.Background(), bytes.NewReader(mustEncode(is, content.Bytes()[:size])), dst)
+		is(errors.Is(err, ErrInvalidArchive), "incorrect error for size %d: %s", size, err)
+	}
+
+	err = Extract(context.Background(), bytes.NewReader([]byte("not an archive")), dst)
+	is(err != nil, "invalid archive was accepted")
+
+	// positions outside the range of a chunk position are not truncated
+	for _, pos := range [][2]int64{{math.MaxInt32 + 1, 0}, {0, math.MinInt32 - 1}, {1 << 40, 3}} {
+		record := append([]byte(archiveMagic), recordData)
+		record = binary.AppendVarint(record, pos[0])
+		record = binary.AppendVarint(record, pos[1])
+		record = binary.AppendVarint(record, 0)
+		record = binary.AppendUvarint(record, 0)
+		record = binary.AppendUvarint(record, 1)
+		record = append(record, 1, recordEnd)
+
+		err = Extract(context.Background(), bytes.NewReader(mustEncode(is, record)), dst)
+		is(errors.Is(err, ErrInvalidArchive), "incorrect error for position %v: %s", pos, err)
+	}
+}
+
+func mustDecode(is is.Is, b []byte) *zstd.Decoder {
+	dec, err := zstd.NewReader(bytes.NewReader(b))
+	is(err == nil, "unexpected error: %s", err)
+	return dec
+}
+
+func mustEncode(is is.Is, b []byte) []byte {
+	enc, err := zstd.NewWriter(nil)
+	is(err == nil, "unexpected error: %s", err)
+	return enc.EncodeAll(b, nil)
+}
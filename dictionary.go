@@ -0,0 +1,326 @@
+package anvil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/afero"
+	"github.com/yehan2002/errors"
+)
+
+// ErrDictionary returned if an entry uses a zstd dictionary that is not in [Settings.Dictionaries].
+const ErrDictionary = errors.Const("anvil: zstd dictionary not found")
+
+const (
+	// MaxDictionaryID the maximum ID of a zstd dictionary.
+	MaxDictionaryID = dictMask - 1
+	// DefaultDictionarySize the default value for [TrainOptions.Size].
+	DefaultDictionarySize = 110 << 10
+	// DefaultDictionarySamples the default value for [TrainOptions.Samples].
+	DefaultDictionarySamples = 2000
+
+	// dictionaryFmt the formatting string used to generate the file name for a dictionary.
+	dictionaryFmt = "zstd.%d.dict"
+)
+
+// Dictionary a zstd dictionary used by the compression methods returned by [CompressionZstdDict].
+type Dictionary struct {
+	id   uint8
+	data []byte
+}
+
+// NewDictionary parses the given zstd dictionary.
+// The ID stored in the dictionary must be between 1 and [MaxDictionaryID].
+// Dictionaries created using `zstd --train` must set the ID using `--dictID`.
+func NewDictionary(b []byte) (*Dictionary, error) {
+	info, err := zstd.InspectDictionary(b)
+	if err != nil {
+		return nil, errors.Wrap("anvil: invalid dictionary", err)
+	}
+
+	if id := info.ID(); id < 1 || id > MaxDictionaryID {
+		return nil, fmt.Errorf("anvil: invalid dictionary ID %d", id)
+	}
+	return &Dictionary{id: uint8(info.ID()), data: b}, nil
+}
+
+// ID returns the ID of the dictionary.
+func (d *Dictionary) ID() uint8 { return d.id }
+
+// Method returns the compression method that uses this dictionary.
+func (d *Dictionary) Method() CompressMethod { return CompressionZstdDict(d.id) }
+
+// Bytes returns the encoded dictionary. The returned slice must not be modified.
+func (d *Dictionary) Bytes() []byte { return d.data }
+
+// TrainOptions options for [TrainDictionary].
+type TrainOptions struct {
+	// ID the ID of the dictionary. This must be between 1 and [MaxDictionaryID].
+	// Default: 1
+	ID uint8
+	// Size the maximum size of the dictionary in bytes.
+	// Default: [DefaultDictionarySize]
+	Size int
+	// Samples the maximum number of entries used to train the dictionary.
+	// Entries are sampled evenly from every anvil file in the world.
+	// Default: [DefaultDictionarySamples]
+	Samples int
+	// Concurrency see [Walk].
+	Concurrency int
+}
+
+// TrainDictionary trains a zstd dictionary using the decompressed data of entries in the world.
+// The returned dictionary can be saved next to the world using [WriteDictionary].
+func TrainDictionary(ctx context.Context, a *Anvil, opt ...TrainOptions) (*Dictionary, error) {
+	var options TrainOptions
+	if len(opt) == 1 {
+		options = opt[0]
+	}
+	if options.ID == 0 {
+		options.ID = 1
+	}
+	if options.Size <= 0 {
+		options.Size = DefaultDictionarySize
+	}
+	if options.Samples <= 0 {
+		options.Samples = DefaultDictionarySamples
+	}
+
+	if options.ID > MaxDictionaryID {
+		return nil, fmt.Errorf("anvil: invalid dictionary ID %d", options.ID)
+	}
+
+	regions, err := a.Regions()
+	if err != nil {
+		return nil, err
+	}
+	if len(regions) == 0 {
+		return nil, errors.New("anvil: no entries to train the dictionary")
+	}
+
+	// the maximum number of samples taken from each anvil file
+	perRegion := (options.Samples + len(regions) - 1) / len(regions)
+
+	var mux sync.Mutex
+	var samples [][]byte
+	var taken int
+	samplers := map[RegionPos]*sampler{}
+
+	err = a.walk(ctx, regions, options.Concurrency, func(f *file, pos ChunkPos, x, z uint8) error {
+		mux.Lock()
+		s := samplers[pos.Region()]
+		if s == nil {
+			s = newSampler(f, perRegion)
+			samplers[pos.Region()] = s
+		}
+		skip := !s.next() || taken >= options.Samples
+		if !skip {
+			taken++
+		}
+		mux.Unlock()
+		if skip {
+			return nil
+		}
+
+		data, err := f.Read(x, z)
+		if err != nil {
+			return err
+		}
+
+		mux.Lock()
+		samples = append(samples, data)
+		mux.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(samples) == 0 {
+		return nil, errors.New("anvil: no entries to train the dictionary")
+	}
+
+	b, err := buildDictionary(samples, dict.Options{MaxDictSize: options.Size, HashBytes: 6, ZstdDictID: uint32(options.ID)})
+	if err != nil {
+		return nil, errors.Wrap("anvil: unable to train dictionary", err)
+	}
+	return NewDictionary(b)
+}
+
+// sampler selects entries evenly spaced across an anvil file.
+// Entries in an anvil file are walked in order, so the entries are counted when the file is first walked.
+type sampler struct {
+	// entries the number of entries in the file.
+	entries int
+	// seen the number of entries that were walked.
+	seen int
+	// n the number of entries to select.
+	n int
+}
+
+// newSampler returns a sampler that selects `n` entries from the given file.
+func newSampler(f *file, n int) *sampler {
+	s := &sampler{n: n}
+	for i := 0; i < Entries; i++ {
+		if _, exists := f.Info(uint8(i&0x1f), uint8(i>>5)); exists {
+			s.entries++
+		}
+	}
+	return s
+}
+
+// next reports if the next entry in the file should be selected.
+func (s *sampler) next() bool {
+	k := s.seen
+	s.seen++
+	if s.entries <= s.n {
+		return true
+	}
+	return k*s.n/s.entries < (k+1)*s.n/s.entries
+}
+
+// buildDictionary builds a zstd dictionary from the given samples.
+// The dictionary builder panics if the samples are too small or too similar,
+// so the panic is returned as an error.
+func buildDictionary(samples [][]byte, opt dict.Options) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("not enough distinct data in the sampled entries: %v", r)
+		}
+	}()
+	return dict.BuildZstdDict(samples, opt)
+}
+
+// Recompress rewrites every entry in the world that is not compressed using the given method.
+// The timestamps of the entries are preserved.
+// If `method` uses a dictionary, it must be in [Settings.Dictionaries].
+// See [Walk] for the meaning of `concurrency` and the returned errors.
+func Recompress(ctx context.Context, a *Anvil, method CompressMethod, concurrency int) error {
+	if !method.supported() {
+		return errors.New("anvil: unsupported compression method")
+	} else if id := method.Dictionary(); id != 0 && a.settings.dicts.get(id) == nil {
+		return dictionaryErr(id)
+	}
+
+	regions, err := a.Regions()
+	if err != nil {
+		return err
+	}
+
+	return a.walk(ctx, regions, concurrency, func(f *file, pos ChunkPos, x, z uint8) error {
+		f.waitQueued(x, z)
+		entry, _ := f.Info(x, z)
+
+		raw, current, err := f.ReadRaw(x, z)
+		if err != nil || current == method {
+			return err
+		}
+
+		var src io.ReadCloser
+		if src, err = current.decompressor(io.NopCloser(bytes.NewReader(raw)), f.settings.dicts); err != nil {
+			return err
+		}
+		src = f.limit(src, pos)
+		data, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			return errors.Wrap("anvil: unable to decompress", err)
+		}
+
+		return f.WriteWithOptions(x, z, data, WriteOptions{Timestamp: entry.Modified(), Compression: method})
+	})
+}
+
+// ReadDictionaries reads the dictionaries stored in the given directory using [WriteDictionary].
+// The returned dictionaries can be used as [Settings.Dictionaries].
+func ReadDictionaries(fs afero.Fs) (dicts []*Dictionary, err error) {
+	var files []os.FileInfo
+	if files, err = afero.ReadDir(fs, "."); err != nil {
+		return nil, errors.Wrap("anvil: unable to list dictionaries", err)
+	}
+
+	for _, info := range files {
+		var id uint8
+		if info.IsDir() {
+			continue
+		}
+
+		// Sscanf ignores any trailing characters, so check if the name matches exactly
+		if _, err := fmt.Sscanf(info.Name(), dictionaryFmt, &id); err != nil || fmt.Sprintf(dictionaryFmt, id) != info.Name() {
+			continue
+		}
+
+		var b []byte
+		if b, err = afero.ReadFile(fs, info.Name()); err != nil {
+			return nil, errors.Wrap("anvil: unable to read dictionary", err)
+		}
+
+		var d *Dictionary
+		if d, err = NewDictionary(b); err != nil {
+			return nil, err
+		} else if d.id != id {
+			return nil, fmt.Errorf("anvil: dictionary %s has ID %d", info.Name(), d.id)
+		}
+		dicts = append(dicts, d)
+	}
+	return dicts, nil
+}
+
+// WriteDictionary writes the dictionary to the given directory so that it can be read by [ReadDictionaries].
+// Any existing dictionary with the same ID is overwritten.
+func WriteDictionary(fs afero.Fs, d *Dictionary) error {
+	if err := afero.WriteFile(fs, fmt.Sprintf(dictionaryFmt, d.id), d.data, 0644); err != nil {
+		return errors.Wrap("anvil: unable to write dictionary", err)
+	}
+	return nil
+}
+
+// dictionaries the dictionaries available to zstd compression methods.
+// A nil *dictionaries contains no dictionaries.
+type dictionaries struct {
+	dicts map[uint8]*Dictionary
+	// decompress decompresses data using any of the dictionaries.
+	decompress decompressorPool
+	// compress the pools of compressors for each dictionary by ID.
+	compress map[uint8]*sync.Pool
+}
+
+// newDictionaries returns the given dictionaries or nil if there are none.
+// If multiple dictionaries have the same ID, the last one is used.
+func newDictionaries(list []*Dictionary) *dictionaries {
+	if len(list) == 0 {
+		return nil
+	}
+
+	d := &dictionaries{dicts: map[uint8]*Dictionary{}, compress: map[uint8]*sync.Pool{}}
+	for _, dictionary := range list {
+		d.dicts[dictionary.id] = dictionary
+	}
+
+	data := make([][]byte, 0, len(d.dicts))
+	for id, dictionary := range d.dicts {
+		data = append(data, dictionary.data)
+		d.compress[id] = newZstdCompressPool(dictionary.data)
+	}
+	d.decompress = newZstdDecompressPool(data)
+	return d
+}
+
+// get returns the dictionary with the given ID or nil if it does not exist.
+func (d *dictionaries) get(id uint8) *Dictionary {
+	if d == nil {
+		return nil
+	}
+	return d.dicts[id]
+}
+
+// dictionaryErr returns an error that wraps [ErrDictionary].
+func dictionaryErr(id uint8) error {
+	return errors.CauseStr(ErrDictionary, fmt.Sprintf("dictionary %d", id))
+}
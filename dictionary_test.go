@@ -0,0 +1,164 @@
+package anvil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type dictionaryTest struct{}
+
+func TestDictionary(t *testing.T) { is.SuiteP(t, &dictionaryTest{}) }
+
+// chunk returns repetitive data similar to the NBT data of a chunk.
+func (*dictionaryTest) chunk(rng *rand.Rand, pos ChunkPos) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "xPos:%d zPos:%d DataVersion:3465 Status:minecraft:full ", pos.X, pos.Z)
+	blocks := []string{"minecraft:stone", "minecraft:dirt", "minecraft:grass_block", "minecraft:deepslate", "minecraft:water"}
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&b, "sections:{Y:%d,block_states:{palette:[{Name:%q}],data:[L;%d]}} ", i%24-4, blocks[rng.Intn(len(blocks))], rng.Int63())
+	}
+	return b.Bytes()
+}
+
+func (d *dictionaryTest) world(is is.Is, fs afero.Fs) (*Anvil, map[ChunkPos][]byte) {
+	world, err := OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+
+	rng := rand.New(rand.NewSource(1))
+	chunks := map[ChunkPos][]byte{}
+	for x := int32(-8); x < 8; x++ {
+		for z := int32(-8); z < 8; z++ {
+			pos := ChunkPos{X: x * 3, Z: z * 3}
+			chunks[pos] = d.chunk(rng, pos)
+			err = world.WriteWithOptions(pos.X, pos.Z, chunks[pos], WriteOptions{Timestamp: time.Unix(int64(x*100+z), 0)})
+			is(err == nil, "unexpected error: %s", err)
+		}
+	}
+	return world, chunks
+}
+
+// size returns the total compressed size of all entries.
+func (*dictionaryTest) size(is is.Is, world *Anvil, chunks map[ChunkPos][]byte, method CompressMethod) (size int) {
+	for pos, data := range chunks {
+		raw, m, err := world.ReadRaw(pos.X, pos.Z)
+		is(err == nil, "unexpected error: %s", err)
+		is(m == method, "incorrect compression method for (%d,%d): %s", pos.X, pos.Z, m)
+		size += len(raw)
+
+		read, err := world.Read(pos.X, pos.Z)
+		is(err == nil, "unexpected error: %s", err)
+		is(bytes.Equal(read, data), "incorrect data for (%d,%d)", pos.X, pos.Z)
+	}
+	return size
+}
+
+func (d *dictionaryTest) TestTrain(is is.Is) {
+	fs := afero.NewMemMapFs()
+	world, chunks := d.world(is, fs)
+	zlibSize := d.size(is, world, chunks, CompressionZlib)
+
+	dict, err := TrainDictionary(context.Background(), world, TrainOptions{ID: 5, Size: 16 << 10})
+	is(err == nil, "unexpected error: %s", err)
+	is(dict.ID() == 5, "incorrect dictionary ID: %d", dict.ID())
+	is(dict.Method() == CompressionZstdDict(5), "incorrect method: %s", dict.Method())
+
+	err = Recompress(context.Background(), world, dict.Method(), 0)
+	is(errors.Is(err, ErrDictionary), "incorrect error returned: %s", err)
+
+	err = WriteDictionary(fs, dict)
+	is(err == nil, "unexpected error: %s", err)
+	dicts, err := ReadDictionaries(fs)
+	is(err == nil, "unexpected error: %s", err)
+	is(len(dicts) == 1 && bytes.Equal(dicts[0].Bytes(), dict.Bytes()), "incorrect dictionaries read")
+
+	world, err = OpenFs(fs, Settings{Dictionaries: dicts})
+	is(err == nil, "unexpected error: %s", err)
+	err = Recompress(context.Background(), world, dict.Method(), 0)
+	is(err == nil, "unexpected error: %s", err)
+
+	dictSize := d.size(is, world, chunks, dict.Method())
+	is(dictSize < zlibSize, "dictionary did not reduce the size: %d >= %d", dictSize, zlibSize)
+
+	entry, _, err := world.Info(-24, 21)
+	is(err == nil, "unexpected error: %s", err)
+	is(entry.Modified().Unix() == -800+7, "timestamp was not preserved: %d", entry.Modified().Unix())
+
+	// entries cannot be read or written without the dictionary
+	world, err = OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+	_, err = world.Read(0, 0)
+	is(errors.Is(err, ErrDictionary), "incorrect error returned: %s", err)
+	err = world.WriteWithOptions(0, 0, chunks[ChunkPos{}], WriteOptions{Compression: dict.Method()})
+	is(errors.Is(err, ErrDictionary), "incorrect error returned: %s", err)
+
+	// raw data can be copied without the dictionary
+	raw, method, err := world.ReadRaw(3, 3)
+	is(err == nil, "unexpected error: %s", err)
+	err = world.WriteRaw(0, 0, method, raw)
+	is(err == nil, "unexpected error: %s", err)
+}
+
+func (d *dictionaryTest) TestZstd(is is.Is) {
+	world, chunks := d.world(is, afero.NewMemMapFs())
+
+	err := Recompress(context.Background(), world, CompressionZstd, 2)
+	is(err == nil, "unexpected error: %s", err)
+	d.size(is, world, chunks, CompressionZstd)
+
+	f, err := world.File(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+	defer f.Close()
+
+	err = f.CompressionMethod(CompressionZstd)
+	is(err == nil, "unexpected error: %s", err)
+	err = f.Write(1, 1, []byte("zstd"))
+	is(err == nil, "unexpected error: %s", err)
+
+	data, method, err := f.(RawReadWriter).ReadRaw(1, 1)
+	is(err == nil, "unexpected error: %s", err)
+	is(method == CompressionZstd && len(data) > 0, "incorrect compression method: %s", method)
+}
+
+func (*dictionaryTest) TestMethods(is is.Is) {
+	for _, m := range []CompressMethod{CompressionGzip, CompressionZlib, CompressionNone, CompressionZstd, CompressionZstdDict(1), CompressionZstdDict(MaxDictionaryID)} {
+		is(m.supported(), "method %s is not supported", m)
+		parsed, err := ParseCompressMethod(m.String())
+		is(err == nil, "unexpected error: %s", err)
+		is(parsed == m, "incorrect method parsed: %s != %s", parsed, m)
+	}
+
+	is(CompressionZstdDict(7).Dictionary() == 7, "incorrect dictionary ID")
+	is(CompressionZlib.Dictionary() == 0 && CompressionZstd.Dictionary() == 0, "incorrect dictionary ID")
+	is(!CompressMethod(0x7f).supported(), "0x7f should not be supported")
+
+	for _, name := range []string{"", "lz4", "zstd:0", "zstd:63", "zstd:x"} {
+		_, err := ParseCompressMethod(name)
+		is(err != nil, "expected an error for %q", name)
+	}
+
+	_, err := NewDictionary([]byte("not a dictionary"))
+	is(err != nil, "expected an error")
+}
+
+func (*dictionaryTest) TestSample(is is.Is) {
+	// entries are selected evenly instead of from the start of the file
+	s := &sampler{entries: 10, n: 3}
+	var selected []int
+	for i := 0; i < 10; i++ {
+		if s.next() {
+			selected = append(selected, i)
+		}
+	}
+	is.Equal(selected, []int{3, 6, 9}, "incorrect entries selected")
+
+	s = &sampler{entries: 2, n: 3}
+	is(s.next() && s.next(), "entries were skipped")
+}
@@ -0,0 +1,273 @@
+package anvil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/yehan2002/errors"
+)
+
+// ErrStalePatch returned by [Patch.Apply] if the data of a change has to be copied from the new world,
+// but the entry was modified after the patch was created.
+const ErrStalePatch = errors.Const("anvil: entry was modified after the patch was created")
+
+// ChangeKind the kind of change made to an entry.
+type ChangeKind byte
+
+// supported kinds
+const (
+	// ChangeAdded the entry only exists in the new world.
+	ChangeAdded ChangeKind = 1 + iota
+	// ChangeRemoved the entry only exists in the old world.
+	ChangeRemoved
+	// ChangeModified the entry exists in both worlds but is different.
+	ChangeModified
+)
+
+func (c ChangeKind) String() string {
+	switch c {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Change a change made to a single entry.
+type Change struct {
+	ChunkPos
+	Kind ChangeKind
+	// Old the header entry in the old world.
+	// This is empty if Kind is [ChangeAdded].
+	Old Entry
+	// New the header entry in the new world.
+	// This is empty if Kind is [ChangeRemoved].
+	New Entry
+
+	// Data the compressed data of the entry in the new world, compressed using Method.
+	// This is read when the change is created, so that the patch can be applied even if the
+	// new world is modified later.
+	// This is nil if Kind is [ChangeRemoved], or if the file passed to [DiffFile]
+	// does not implement [RawReadWriter].
+	Data []byte
+	// Method the compression method used to compress Data.
+	Method CompressMethod
+}
+
+// DiffOptions options for [Diff] and [DiffFile].
+type DiffOptions struct {
+	// Content if the decompressed content of entries should be compared.
+	// If this is set, entries that exist in both worlds are only reported as modified
+	// if their content is different, regardless of their timestamp and size.
+	Content bool
+}
+
+// Patch a list of changes returned by [Diff].
+type Patch []Change
+
+// Apply applies the changes to `dst`.
+// Entries are written using the data stored in the changes without being decompressed and keep their timestamp.
+// Changes that do not contain the data of the entry are copied from `src`, which must be the new world
+// that was passed to [Diff]; [ErrStalePatch] is returned if the entry in `src` was modified since the change was created.
+func (p Patch) Apply(dst, src *Anvil) (err error) {
+	for _, c := range p {
+		switch {
+		case c.Kind == ChangeRemoved:
+			err = dst.Remove(c.X, c.Z)
+		case c.Data != nil:
+			err = dst.writeRaw(c.X, c.Z, c.Method, c.Data, c.New.Modified())
+		default:
+			var buf []byte
+			var method CompressMethod
+			var entry Entry
+			if buf, method, entry, err = src.ReadRawEntry(c.X, c.Z); err == nil {
+				if entry != c.New {
+					err = ErrStalePatch
+				} else {
+					err = dst.writeRaw(c.X, c.Z, method, buf, c.New.Modified())
+				}
+			}
+		}
+
+		if err != nil {
+			return errors.Wrap(fmt.Sprintf("anvil: Patch: unable to apply change to (%d,%d)", c.X, c.Z), err)
+		}
+	}
+	return nil
+}
+
+// Diff returns the changes needed to turn the world `old` into `cur`.
+// The returned changes contain the compressed data of the entries that were added or modified,
+// so the patch can be applied even if `cur` is modified later.
+func Diff(old, cur *Anvil, opt ...DiffOptions) (p Patch, err error) {
+	var options DiffOptions
+	if len(opt) == 1 {
+		options = opt[0]
+	}
+
+	var oldRegions, curRegions []RegionPos
+	if oldRegions, err = old.Regions(); err != nil {
+		return nil, err
+	}
+	if curRegions, err = cur.Regions(); err != nil {
+		return nil, err
+	}
+
+	// regions[rg][0] is set if the region exists in `old`, regions[rg][1] if it exists in `cur`
+	regions := map[RegionPos]*[2]bool{}
+	order := make([]RegionPos, 0, len(oldRegions)+len(curRegions))
+	for i, list := range [2][]RegionPos{oldRegions, curRegions} {
+		for _, rg := range list {
+			if regions[rg] == nil {
+				regions[rg] = &[2]bool{}
+				order = append(order, rg)
+			}
+			regions[rg][i] = true
+		}
+	}
+
+	for _, rg := range order {
+		if p, err = diffRegion(p, old, cur, rg, *regions[rg], options); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// diffRegion appends the changes made to the given region to `p`.
+// Regions that do not exist are treated as empty.
+func diffRegion(p Patch, old, cur *Anvil, rg RegionPos, exists [2]bool, options DiffOptions) (_ Patch, err error) {
+	var files [2]*file
+	for i, a := range [2]*Anvil{old, cur} {
+		if !exists[i] {
+			continue
+		}
+
+		if files[i], err = a.getScan(rg.X, rg.Z); err != nil {
+			return nil, err
+		}
+
+		defer func(a *Anvil, f *file) {
+			if closeErr := a.free(f); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}(a, files[i])
+	}
+
+	var oldFile, curFile File
+	if files[0] != nil {
+		oldFile = files[0]
+	}
+	if files[1] != nil {
+		curFile = files[1]
+	}
+
+	start := len(p)
+	if p, err = diffFile(p, oldFile, curFile, options); err != nil {
+		return nil, err
+	}
+
+	// convert the positions to world coordinates
+	for i := start; i < len(p); i++ {
+		p[i].X, p[i].Z = rg.X<<5|p[i].X, rg.Z<<5|p[i].Z
+	}
+
+	return p, nil
+}
+
+// DiffFile returns the changes needed to turn the anvil file `old` into `cur`.
+// The positions in the returned changes are relative to the anvil file.
+func DiffFile(old, cur File, opt ...DiffOptions) (p Patch, err error) {
+	var options DiffOptions
+	if len(opt) == 1 {
+		options = opt[0]
+	}
+	return diffFile(nil, old, cur, options)
+}
+
+// diffFile appends the changes between the given files to `p`.
+// If either file is nil, it is treated as an empty file.
+func diffFile(p Patch, old, cur File, options DiffOptions) (Patch, error) {
+	for i := 0; i < Entries; i++ {
+		x, z := uint8(i&0x1f), uint8(i>>5)
+
+		var oldEntry, curEntry Entry
+		var oldExists, curExists bool
+		if old != nil {
+			oldEntry, oldExists = old.Info(x, z)
+		}
+		if cur != nil {
+			curEntry, curExists = cur.Info(x, z)
+		}
+
+		change := Change{ChunkPos: ChunkPos{X: int32(x), Z: int32(z)}, Old: oldEntry, New: curEntry}
+
+		switch {
+		case !oldExists && !curExists:
+			continue
+		case !oldExists:
+			change.Kind = ChangeAdded
+		case !curExists:
+			change.Kind = ChangeRemoved
+		case options.Content:
+			equal, err := equalContent(old, cur, x, z)
+			if err != nil {
+				return nil, errors.Wrap(fmt.Sprintf("anvil: Diff: unable to compare (%d,%d)", x, z), err)
+			}
+			if equal {
+				continue
+			}
+			change.Kind = ChangeModified
+		case oldEntry.timestamp != curEntry.timestamp || oldEntry.size != curEntry.size:
+			change.Kind = ChangeModified
+		default:
+			continue
+		}
+
+		if change.Kind != ChangeRemoved {
+			if err := change.capture(cur, x, z); err != nil {
+				return nil, errors.Wrap(fmt.Sprintf("anvil: Diff: unable to read (%d,%d)", x, z), err)
+			}
+		}
+
+		p = append(p, change)
+	}
+	return p, nil
+}
+
+// entryReader is implemented by the files returned by this package.
+type entryReader interface {
+	readEntry(x, z uint8, raw bool) (buf []byte, method CompressMethod, entry Entry, err error)
+}
+
+// capture reads the compressed data of the entry at x,z in `f` into the change.
+// The header entry is updated to match the data if `f` was returned by this package.
+func (c *Change) capture(f File, x, z uint8) (err error) {
+	switch f := f.(type) {
+	case entryReader:
+		c.Data, c.Method, c.New, err = f.readEntry(x, z, true)
+	case RawReadWriter:
+		c.Data, c.Method, err = f.ReadRaw(x, z)
+	}
+	return err
+}
+
+// equalContent checks if the decompressed content of the entry at x,z is the same in both files.
+func equalContent(old, cur File, x, z uint8) (bool, error) {
+	var hashes [2][]byte
+	for i, f := range [2]File{old, cur} {
+		h := sha256.New()
+		if err := f.ReadWith(x, z, func(r io.Reader) (err error) { _, err = io.Copy(h, r); return }); err != nil {
+			return false, err
+		}
+		hashes[i] = h.Sum(nil)
+	}
+	return bytes.Equal(hashes[0], hashes[1]), nil
+}
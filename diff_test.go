@@ -0,0 +1,113 @@
+package anvil
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/yehan2002/is/v2"
+)
+
+type diffTest struct{}
+
+func TestDiff(t *testing.T) { is.SuiteP(t, &diffTest{}) }
+
+func (*diffTest) sorted(p Patch) Patch {
+	sort.Slice(p, func(i, j int) bool {
+		if p[i].X != p[j].X {
+			return p[i].X < p[j].X
+		}
+		return p[i].Z < p[j].Z
+	})
+	return p
+}
+
+func (d *diffTest) TestDiff(is is.Is) {
+	old := makeWorld(is, map[[2]int32]int64{{0, 0}: 1, {1, 0}: 2, {2, 0}: 3, {-40, 3}: 4})
+	cur := makeWorld(is, map[[2]int32]int64{{0, 0}: 1, {1, 0}: 5, {3, 0}: 6, {70, 70}: 7})
+
+	p, err := Diff(old, cur)
+	is(err == nil, "unexpected error: %s", err)
+	p = d.sorted(p)
+
+	expected := []struct {
+		pos  ChunkPos
+		kind ChangeKind
+	}{
+		{ChunkPos{-40, 3}, ChangeRemoved},
+		{ChunkPos{1, 0}, ChangeModified},
+		{ChunkPos{2, 0}, ChangeRemoved},
+		{ChunkPos{3, 0}, ChangeAdded},
+		{ChunkPos{70, 70}, ChangeAdded},
+	}
+
+	is(len(p) == len(expected), "incorrect number of changes: %v", p)
+	for i, e := range expected {
+		is(p[i].ChunkPos == e.pos && p[i].Kind == e.kind, "incorrect change: %v, expected %v %s", p[i], e.pos, e.kind)
+	}
+
+	// apply the patch to a copy of the old world
+	third := makeWorld(is, map[[2]int32]int64{{0, 0}: 1, {1, 0}: 2, {2, 0}: 3, {-40, 3}: 4})
+	err = p.Apply(third, cur)
+	is(err == nil, "unexpected error: %s", err)
+
+	p, err = Diff(third, cur)
+	is(err == nil, "unexpected error: %s", err)
+	is(len(p) == 0, "patch was not applied correctly: %v", p)
+}
+
+func (d *diffTest) TestContent(is is.Is) {
+	old := makeWorld(is, map[[2]int32]int64{{0, 0}: 1, {1, 0}: 2})
+	cur := makeWorld(is, nil)
+
+	// same content with a different timestamp
+	err := cur.WriteWithOptions(0, 0, []byte{1, 0, 0}, WriteOptions{Timestamp: time.Unix(100, 0)})
+	is(err == nil, "unexpected error: %s", err)
+	// different content with the same timestamp
+	err = cur.WriteWithOptions(1, 0, []byte{3, 1, 0}, WriteOptions{Timestamp: time.Unix(2, 0)})
+	is(err == nil, "unexpected error: %s", err)
+
+	p, err := Diff(old, cur)
+	is(err == nil, "unexpected error: %s", err)
+	is(len(p) == 1 && p[0].ChunkPos == ChunkPos{0, 0}, "incorrect changes: %v", p)
+
+	p, err = Diff(old, cur, DiffOptions{Content: true})
+	is(err == nil, "unexpected error: %s", err)
+	is(len(p) == 1 && p[0].ChunkPos == ChunkPos{1, 0}, "incorrect changes: %v", p)
+}
+
+func (d *diffTest) TestApplyModified(is is.Is) {
+	old := makeWorld(is, nil)
+	cur := makeWorld(is, map[[2]int32]int64{{0, 0}: 1, {1, 0}: 2})
+
+	p, err := Diff(old, cur)
+	is(err == nil, "unexpected error: %s", err)
+	is(len(p) == 2 && p[0].Data != nil && p[1].Data != nil, "data was not captured: %v", p)
+
+	// the patch contains the data as it was when it was created
+	is(cur.Write(0, 0, []byte{9}) == nil, "unexpected error")
+	is(cur.Remove(1, 0) == nil, "unexpected error")
+	dst := makeWorld(is, nil)
+	is(p.Apply(dst, cur) == nil, "unexpected error")
+	data, err := dst.Read(0, 0)
+	is(err == nil && bytes.Equal(data, []byte{1, 0, 0}), "incorrect data applied: %v %s", data, err)
+	data, err = dst.Read(1, 0)
+	is(err == nil && bytes.Equal(data, []byte{2, 1, 0}), "incorrect data applied: %v %s", data, err)
+
+	// changes without data are only copied if the entry was not modified
+	for i := range p {
+		p[i].Data = nil
+	}
+	dst = makeWorld(is, nil)
+	err = p.Apply(dst, cur)
+	is(errors.Is(err, ErrStalePatch), "incorrect error returned: %s", err)
+
+	p, err = Diff(old, cur)
+	is(err == nil && len(p) == 1, "unexpected error: %s", err)
+	p[0].Data = nil
+	is(p.Apply(dst, cur) == nil, "unexpected error")
+	data, err = dst.Read(0, 0)
+	is(err == nil && bytes.Equal(data, []byte{9}), "incorrect data applied: %v %s", data, err)
+}
@@ -0,0 +1,105 @@
+// Package dump exports chunks as human-readable SNBT or JSON and imports them back.
+// Importing an exported chunk writes the same uncompressed bytes that were exported.
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/FireworkMC/anvil/nbt"
+	"github.com/yehan2002/errors"
+)
+
+// ErrTrailingData returned by [Export] if the chunk contains data after the root tag.
+// The data would be lost if the chunk is imported again.
+const ErrTrailingData = errors.Const("dump: chunk contains data after the root tag")
+
+// Format a text format.
+type Format uint8
+
+const (
+	// SNBT stringified NBT. See [nbt.WriteSNBT].
+	SNBT Format = iota
+	// JSON see [nbt.WriteJSON].
+	JSON
+)
+
+func (f Format) String() string {
+	switch f {
+	case SNBT:
+		return "snbt"
+	case JSON:
+		return "json"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	for _, f := range []Format{SNBT, JSON} {
+		if f.String() == name {
+			return f, nil
+		}
+	}
+	return 0, errors.New("dump: unknown format " + name)
+}
+
+// Export writes the chunk at x,z to `w` in the given format.
+func Export(w io.Writer, a *anvil.Anvil, x, z int32, format Format) error {
+	return a.ReadFn(x, z, func(r io.Reader) error { return Encode(w, r, format) })
+}
+
+// Encode converts the uncompressed NBT data read from `r` to the given format.
+func Encode(w io.Writer, r io.Reader, format Format) error {
+	br := bufio.NewReader(r)
+	name, root, err := nbt.Read(br)
+	if err != nil {
+		return err
+	}
+
+	if _, err = br.Peek(1); err == nil {
+		return ErrTrailingData
+	} else if err != io.EOF {
+		return err
+	}
+
+	switch format {
+	case SNBT:
+		return nbt.WriteSNBT(w, name, root)
+	case JSON:
+		return nbt.WriteJSON(w, name, root)
+	default:
+		return errors.New("dump: unknown format")
+	}
+}
+
+// Import reads a chunk in the given format from `r` and writes it to the chunk at x,z.
+func Import(r io.Reader, a *anvil.Anvil, x, z int32, format Format) error {
+	var buf bytes.Buffer
+	if err := Decode(&buf, r, format); err != nil {
+		return err
+	}
+	return a.Write(x, z, buf.Bytes())
+}
+
+// Decode converts a value in the given format read from `r` to uncompressed NBT data.
+func Decode(w io.Writer, r io.Reader, format Format) (err error) {
+	var name string
+	var root nbt.Compound
+	switch format {
+	case SNBT:
+		name, root, err = nbt.ReadSNBT(r)
+	case JSON:
+		name, root, err = nbt.ReadJSON(r)
+	default:
+		err = errors.New("dump: unknown format")
+	}
+
+	if err != nil {
+		return err
+	}
+	return nbt.Write(w, name, root)
+}
@@ -0,0 +1,73 @@
+package dump
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/FireworkMC/anvil/nbt"
+	"github.com/spf13/afero"
+	"github.com/yehan2002/errors"
+	"github.com/yehan2002/is/v2"
+)
+
+type dumpTest struct{}
+
+func TestDump(t *testing.T) { is.SuiteP(t, &dumpTest{}) }
+
+func (*dumpTest) world(is is.Is) (*anvil.Anvil, []byte) {
+	world, err := anvil.OpenFs(afero.NewMemMapFs())
+	is(err == nil, "unexpected error: %s", err)
+
+	var buf bytes.Buffer
+	err = nbt.Write(&buf, "", nbt.Compound{
+		{Name: "DataVersion", Value: int32(3953)},
+		{Name: "sections", Value: nbt.List{Type: nbt.TagCompound, Values: []any{
+			nbt.Compound{{Name: "Y", Value: int8(-4)}, {Name: "data", Value: []int64{1, 2, 3}}},
+		}}},
+		{Name: "Status", Value: "minecraft:full"},
+		{Name: "InhabitedTime", Value: int64(1200)},
+	})
+	is(err == nil, "unexpected error: %s", err)
+
+	err = world.Write(0, 0, buf.Bytes())
+	is(err == nil, "unexpected error: %s", err)
+	return world, buf.Bytes()
+}
+
+func (d *dumpTest) TestRoundtrip(is is.Is) {
+	for _, format := range []Format{SNBT, JSON} {
+		world, data := d.world(is)
+
+		var text bytes.Buffer
+		err := Export(&text, world, 0, 0, format)
+		is(err == nil, "unexpected error: %s", err)
+		is(strings.Contains(text.String(), "minecraft:full"), "incorrect %s output: %s", format, text.String())
+
+		err = Import(&text, world, 40, 2, format)
+		is(err == nil, "unexpected error: %s", err)
+
+		imported, err := world.Read(40, 2)
+		is(err == nil, "unexpected error: %s", err)
+		is(bytes.Equal(imported, data), "imported %s chunk is different", format)
+	}
+}
+
+func (d *dumpTest) TestErrors(is is.Is) {
+	world, data := d.world(is)
+
+	err := world.Write(1, 0, append(data, 0))
+	is(err == nil, "unexpected error: %s", err)
+	err = Export(&bytes.Buffer{}, world, 1, 0, SNBT)
+	is(errors.Is(err, ErrTrailingData), "incorrect error returned: %s", err)
+
+	err = Export(&bytes.Buffer{}, world, 2, 0, SNBT)
+	is(errors.Is(err, anvil.ErrNotExist), "incorrect error returned: %s", err)
+
+	err = Import(strings.NewReader("{a: "), world, 2, 0, SNBT)
+	is(errors.Is(err, nbt.ErrInvalid), "incorrect error returned: %s", err)
+
+	_, err = ParseFormat("xml")
+	is(err != nil, "unknown format was accepted")
+}
@@ -0,0 +1,196 @@
+package anvil
+
+import (
+	"container/list"
+	"unsafe"
+)
+
+// EvictionPolicy chooses which anvil files are closed when the cache of an [Anvil] is full.
+// The cache only contains files that are not in use; files that are in use are removed from the
+// cache until they are no longer used. Pinned files and files only used by scans, such as [Walk],
+// are never added to the cache.
+//
+// The methods of a policy are never called concurrently.
+// A policy keeps track of the files in the cache, so it must not be used by more than one [Anvil].
+type EvictionPolicy interface {
+	// Add adds an anvil file that is no longer in use to the cache.
+	Add(entry CacheEntry)
+	// Remove removes an anvil file from the cache because it is used again.
+	Remove(rg RegionPos)
+	// Evict removes the anvil file that should be closed next from the cache and returns it.
+	// This is called after every call to Add until it returns false.
+	Evict() (rg RegionPos, ok bool)
+}
+
+// CacheEntry an anvil file added to the cache.
+type CacheEntry struct {
+	Region RegionPos
+	// Size the size of the anvil file in bytes.
+	Size int64
+	// Memory the approximate number of bytes used by the header of the anvil file.
+	Memory int64
+}
+
+// NewLRUPolicy returns a policy that keeps the `size` most recently used anvil files.
+// This is the policy used if [Settings.Eviction] is not set.
+func NewLRUPolicy(size int) EvictionPolicy { return NewCostPolicy(size, -1) }
+
+// NewCostPolicy returns a policy that closes the least recently used anvil files while the cache
+// contains more than `maxFiles` files or while the headers of the cached files use more than `maxMemory` bytes.
+// This can be used to limit the number of open file descriptors and the memory used by the cache.
+// If either limit is -1, it is not checked.
+func NewCostPolicy(maxFiles int, maxMemory int64) EvictionPolicy {
+	return &lruPolicy{maxFiles: maxFiles, maxMemory: maxMemory, items: map[RegionPos]*list.Element{}}
+}
+
+// lruPolicy the policy returned by [NewLRUPolicy] and [NewCostPolicy].
+type lruPolicy struct {
+	maxFiles  int
+	maxMemory int64
+
+	// order the cached entries. The front of the list is the most recently used entry.
+	order  list.List
+	items  map[RegionPos]*list.Element
+	memory int64
+}
+
+func (l *lruPolicy) Add(entry CacheEntry) {
+	l.Remove(entry.Region)
+	l.items[entry.Region] = l.order.PushFront(entry)
+	l.memory += entry.Memory
+}
+
+func (l *lruPolicy) Remove(rg RegionPos) {
+	if e, ok := l.items[rg]; ok {
+		l.remove(e)
+	}
+}
+
+func (l *lruPolicy) Evict() (rg RegionPos, ok bool) {
+	files := l.maxFiles >= 0 && l.order.Len() > l.maxFiles
+	memory := l.maxMemory >= 0 && l.memory > l.maxMemory
+
+	if e := l.order.Back(); e != nil && (files || memory) {
+		return l.remove(e).Region, true
+	}
+	return RegionPos{}, false
+}
+
+// remove removes the given element and returns its entry.
+func (l *lruPolicy) remove(e *list.Element) CacheEntry {
+	entry := l.order.Remove(e).(CacheEntry)
+	delete(l.items, entry.Region)
+	l.memory -= entry.Memory
+	return entry
+}
+
+const (
+	// twoQueueRecentRatio the fraction of the cache used for files that were only used once.
+	twoQueueRecentRatio = 0.25
+	// twoQueueGhostRatio the number of evicted files that are remembered, as a fraction of the size of the cache.
+	twoQueueGhostRatio = 0.5
+)
+
+// New2QPolicy returns a policy that keeps up to `size` anvil files using the 2Q algorithm.
+// Files that were only used once are kept separately from files that were used repeatedly,
+// and are closed first. Files that are used again after they were closed are treated as used repeatedly.
+// This keeps frequently used files, such as the files around the spawn, open while many other
+// files are used once.
+func New2QPolicy(size int) EvictionPolicy {
+	return &twoQueuePolicy{
+		size:       size,
+		recentSize: int(float64(size) * twoQueueRecentRatio),
+		ghostSize:  int(float64(size) * twoQueueGhostRatio),
+		items:      map[RegionPos]*list.Element{},
+		ghosts:     map[RegionPos]*list.Element{},
+	}
+}
+
+// twoQueuePolicy the policy returned by [New2QPolicy].
+type twoQueuePolicy struct {
+	size, recentSize, ghostSize int
+
+	// recent the files that were used once. The front of the list is the most recently used file.
+	recent list.List
+	// frequent the files that were used repeatedly. The front of the list is the most recently used file.
+	frequent list.List
+	items    map[RegionPos]*list.Element
+
+	// ghost the files that were recently evicted from `recent` or removed from the cache since they were used again.
+	// The front of the list is the most recently evicted file. This keeps at most `ghostSize` files.
+	ghost  list.List
+	ghosts map[RegionPos]*list.Element
+}
+
+func (t *twoQueuePolicy) Add(entry CacheEntry) {
+	rg := entry.Region
+	t.remove(rg)
+
+	if g, ghost := t.ghosts[rg]; ghost {
+		t.ghost.Remove(g)
+		delete(t.ghosts, rg)
+		t.items[rg] = t.frequent.PushFront(rg)
+		return
+	}
+	t.items[rg] = t.recent.PushFront(rg)
+}
+
+func (t *twoQueuePolicy) Remove(rg RegionPos) {
+	if t.remove(rg) {
+		t.addGhost(rg)
+	}
+}
+
+func (t *twoQueuePolicy) Evict() (rg RegionPos, ok bool) {
+	if t.recent.Len()+t.frequent.Len() <= t.size {
+		return RegionPos{}, false
+	}
+
+	// evict files that were used once first, unless they use less than their share of the cache
+	if t.recent.Len() > t.recentSize || t.frequent.Len() == 0 {
+		rg = t.recent.Remove(t.recent.Back()).(RegionPos)
+		delete(t.items, rg)
+
+		t.addGhost(rg)
+		return rg, true
+	}
+
+	rg = t.frequent.Remove(t.frequent.Back()).(RegionPos)
+	delete(t.items, rg)
+	return rg, true
+}
+
+// addGhost remembers the given file so that it is treated as frequently used if it is used again.
+// The oldest file is forgotten if `ghost` is full.
+func (t *twoQueuePolicy) addGhost(rg RegionPos) {
+	if t.ghostSize <= 0 {
+		return
+	}
+	if t.ghost.Len() >= t.ghostSize {
+		delete(t.ghosts, t.ghost.Remove(t.ghost.Back()).(RegionPos))
+	}
+	t.ghosts[rg] = t.ghost.PushFront(rg)
+}
+
+// remove removes the given file from `recent` or `frequent`.
+// This returns false if the file is not cached.
+func (t *twoQueuePolicy) remove(rg RegionPos) bool {
+	e, ok := t.items[rg]
+	if ok {
+		// the element is in exactly one of the lists; list.Remove ignores elements of other lists.
+		t.recent.Remove(e)
+		t.frequent.Remove(e)
+		delete(t.items, rg)
+	}
+	return ok
+}
+
+// memory returns the approximate number of bytes used by the header of the file.
+// Callers must hold the lock.
+func (a *file) memory() int64 {
+	m := int64(unsafe.Sizeof(Entry{})) * Entries
+	if a.header != nil && a.header.used != nil {
+		m += int64(len(a.header.used.Bytes())) * 8
+	}
+	return m
+}
@@ -0,0 +1,116 @@
+package anvil
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type evictTest struct{}
+
+func TestEvict(t *testing.T) { is.SuiteP(t, &evictTest{}) }
+
+// evictAll returns the files evicted by the given policy.
+func evictAll(p EvictionPolicy) (evicted []RegionPos) {
+	for rg, ok := p.Evict(); ok; rg, ok = p.Evict() {
+		evicted = append(evicted, rg)
+	}
+	return
+}
+
+func (*evictTest) TestLRU(is is.Is) {
+	p := NewLRUPolicy(2)
+	for x := int32(0); x < 3; x++ {
+		p.Add(CacheEntry{Region: RegionPos{X: x}})
+	}
+	evicted := evictAll(p)
+	is(len(evicted) == 1 && evicted[0] == RegionPos{X: 0}, "incorrect files evicted: %v", evicted)
+
+	// used files are removed from the cache and added again once they are no longer used
+	p.Remove(RegionPos{X: 1})
+	p.Add(CacheEntry{Region: RegionPos{X: 1}})
+	p.Add(CacheEntry{Region: RegionPos{X: 3}})
+	evicted = evictAll(p)
+	is(len(evicted) == 1 && evicted[0] == RegionPos{X: 2}, "incorrect files evicted: %v", evicted)
+}
+
+func (*evictTest) TestCost(is is.Is) {
+	p := NewCostPolicy(-1, 100)
+	p.Add(CacheEntry{Region: RegionPos{X: 0}, Memory: 60})
+	p.Add(CacheEntry{Region: RegionPos{X: 1}, Memory: 30})
+	is(len(evictAll(p)) == 0, "files were evicted while under the limit")
+
+	p.Add(CacheEntry{Region: RegionPos{X: 2}, Memory: 20})
+	evicted := evictAll(p)
+	is(len(evicted) == 1 && evicted[0] == RegionPos{X: 0}, "incorrect files evicted: %v", evicted)
+
+	p.Add(CacheEntry{Region: RegionPos{X: 3}, Memory: 200})
+	evicted = evictAll(p)
+	is(len(evicted) == 3, "incorrect files evicted: %v", evicted)
+}
+
+func (*evictTest) Test2Q(is is.Is) {
+	p := New2QPolicy(4)
+	hot := RegionPos{X: -1}
+	p.Add(CacheEntry{Region: hot})
+	p.Remove(hot)
+	p.Add(CacheEntry{Region: hot})
+
+	// files used once are evicted before files that were used repeatedly
+	for x := int32(0); x < 100; x++ {
+		p.Add(CacheEntry{Region: RegionPos{X: x}})
+		for _, rg := range evictAll(p) {
+			is(rg != hot, "frequently used file was evicted")
+		}
+	}
+
+	// files that are used again after they were evicted are treated as used repeatedly
+	p.Add(CacheEntry{Region: RegionPos{X: 96}})
+	evictAll(p)
+	for x := int32(100); x < 200; x++ {
+		p.Add(CacheEntry{Region: RegionPos{X: x}})
+		for _, rg := range evictAll(p) {
+			is(rg != RegionPos{X: 96} && rg != hot, "file that was used again was evicted")
+		}
+	}
+
+	// the files that were removed from the cache are forgotten like evicted files
+	for x := int32(200); x < 300; x++ {
+		p.Add(CacheEntry{Region: RegionPos{X: x}})
+		p.Remove(RegionPos{X: x})
+	}
+	q := p.(*twoQueuePolicy)
+	is(len(q.ghosts) == 2 && q.ghost.Len() == 2, "removed files were not forgotten: %d", len(q.ghosts))
+	_, ok := q.ghosts[RegionPos{X: 299}]
+	is(ok, "the most recently removed file was forgotten")
+}
+
+func (*evictTest) TestScan(is is.Is) {
+	observer := &evictObserver{}
+	fs := afero.NewMemMapFs()
+	a, err := OpenFs(fs, Settings{CacheSize: 2, Observer: observer})
+	is(err == nil, "unexpected error: %s", err)
+	for x := int32(0); x < 8; x++ {
+		is(a.Write(x*32, 0, []byte{byte(x + 1)}) == nil, "unexpected error")
+	}
+	is(len(observer.evicted) == 6, "incorrect files evicted: %v", observer.evicted)
+
+	// walking uses the cached files without evicting them
+	err = Walk(context.Background(), a, 2, func(ChunkPos, io.Reader) error { return nil })
+	is(err == nil, "unexpected error: %s", err)
+	is(len(observer.evicted) == 6, "walking evicted files: %v", observer.evicted)
+	is(a.cached(pos{6, 0}) && a.cached(pos{7, 0}), "cached files were closed")
+	is(!a.cached(pos{0, 0}), "walked file was cached")
+
+	// files used by a scan and another caller are cached
+	f, err := a.getScan(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+	data, err := a.Read(0, 0)
+	is(err == nil && data[0] == 1, "incorrect data: %v %s", data, err)
+	is(a.free(f) == nil, "unexpected error")
+	is(a.cached(pos{0, 0}), "file was not cached")
+	is(a.Close() == nil, "unexpected error")
+}
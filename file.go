@@ -1,6 +1,7 @@
 package anvil
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -52,11 +53,54 @@ type File interface {
 	Close() (err error)
 }
 
+// OptionsWriter is implemented by files that can write entries using [WriteOptions].
+// The files returned by this package implement OptionsWriter; other [File] implementations
+// may not, so callers should check for it using a type assertion.
+type OptionsWriter interface {
+	// WriteWithOptions is the same as [File.Write] but uses the given options
+	// to set the timestamp and the compression method used for this entry.
+	WriteWithOptions(x, z uint8, b []byte, opts WriteOptions) (err error)
+}
+
+var _ OptionsWriter = &file{}
+var _ OptionsWriter = &cachedFile{}
+
+// RawReadWriter is implemented by files that can read and write compressed data without recompressing it.
+// The files returned by this package implement RawReadWriter; other [File] implementations
+// may not, so callers should check for it using a type assertion.
+type RawReadWriter interface {
+	// ReadRaw reads the compressed data for the entry at x,z without decompressing it.
+	// This also returns the compression method used to compress the data.
+	ReadRaw(x, z uint8) (buf []byte, method CompressMethod, err error)
+
+	// WriteRaw writes data that was already compressed using the given method
+	// to the entry at x,z without recompressing it.
+	// If the data is larger than 1MB, the data is stored externally.
+	WriteRaw(x, z uint8, method CompressMethod, b []byte) (err error)
+}
+
+var _ RawReadWriter = &file{}
+var _ RawReadWriter = &cachedFile{}
+
+// WriteOptions options for writing an entry.
+type WriteOptions struct {
+	// Timestamp the modification time stored in the header for the entry.
+	// If this is zero, the current time is used.
+	Timestamp time.Time
+	// Compression the compression method used to compress the entry.
+	// If this is zero, the method set by [File.CompressionMethod] is used.
+	Compression CompressMethod
+}
+
 // file is a single anvil file.
 // All functions can be called concurrently from multiple goroutines.
 type file struct {
-	mux    sync.RWMutex
-	header *Header
+	mux sync.RWMutex
+	// headerMux is held while the header is updated, so that updates to the header are written,
+	// synced and committed in order while `mux` is released for the sync.
+	// This must be acquired before `mux`.
+	headerMux sync.Mutex
+	header    *Header
 
 	pos pos
 
@@ -66,7 +110,7 @@ type file struct {
 	writer writer
 	reader reader
 
-	c  compressor
+	// cm the compression method set by [file.CompressionMethod].
 	cm CompressMethod
 
 	// This is nil unless this was opened by Anvil
@@ -76,6 +120,15 @@ type file struct {
 	// This should only be modified while holding read or write lock of `cache`.
 	// This is unused if `cache` is nil
 	useCount atomic.Int32
+	// cached if the file is in the cache of `cache`.
+	// Files in the cache that are in use are only used by scans.
+	// scan if the file is only used by scans.
+	// These must only be modified while holding the write lock of `cache`.
+	cached, scan bool
+
+	// captures the states of this file captured by live snapshots.
+	// This must only be modified while holding the write lock.
+	captures []*capture
 }
 
 // OpenFile opens the given anvil file.
@@ -86,6 +139,11 @@ type file struct {
 func OpenFile(path string, opt ...Settings) (f File, err error) {
 	settings := getSettings(opt, filesystem)
 
+	var start time.Time
+	if settings.Observer != nil {
+		start = time.Now()
+	}
+
 	var read reader
 	var size int64
 	if path, err = filepath.Abs(path); err == nil {
@@ -93,6 +151,10 @@ func OpenFile(path string, opt ...Settings) (f File, err error) {
 			f, err = newAnvil(0, 0, read, size, settings)
 		}
 	}
+
+	if settings.Observer != nil {
+		settings.Observer.Open(OpenEvent{Start: start, Duration: time.Since(start), Err: err})
+	}
 	return
 }
 
@@ -110,6 +172,10 @@ func newAnvil(rgx, rgz int32, r io.ReaderAt, fileSize int64, settings Settings)
 		return nil, ErrSize
 	}
 
+	if settings.Allocation > AllocSegregated {
+		return nil, errors.New("anvil: unsupported allocation strategy")
+	}
+
 	anvil := &file{settings: settings, pos: pos{x: rgx, z: rgz}, size: fileSize}
 
 	if closer, ok := r.(reader); ok {
@@ -133,6 +199,7 @@ func newAnvil(rgx, rgz int32, r io.ReaderAt, fileSize int64, settings Settings)
 		anvil.header = newHeader()
 		anvil.header.clear()
 		anvil.header.used = bitset.New(Entries)
+		anvil.header.SetStrategy(settings.Allocation)
 		return anvil, nil
 	}
 
@@ -140,6 +207,7 @@ func newAnvil(rgx, rgz int32, r io.ReaderAt, fileSize int64, settings Settings)
 	if anvil.header, err = ReadHeader(r, maxSection); err != nil {
 		return
 	}
+	anvil.header.SetStrategy(settings.Allocation)
 
 	return anvil, nil
 }
@@ -149,8 +217,13 @@ func newAnvil(rgx, rgz int32, r io.ReaderAt, fileSize int64, settings Settings)
 func (a *file) Read(x, z uint8) (buf []byte, err error) {
 	a.mux.RLock()
 	defer a.mux.RUnlock()
+	return a.readBytes(x, z, nil)
+}
 
-	src, length, err := a.read(x, z)
+// readBytes reads the entry at x,z as it is in `c` or in the current header if `c` is nil.
+// Callers must hold the read lock.
+func (a *file) readBytes(x, z uint8, c *capture) (buf []byte, err error) {
+	src, length, err := a.read(x, z, c)
 	if err != nil {
 		return nil, err
 	}
@@ -194,8 +267,13 @@ func (a *file) ReadWith(x, z uint8, readFn func(io.Reader) error) (err error) {
 func (a *file) ReadTo(x, z uint8, reader io.ReaderFrom) (n int64, err error) {
 	a.mux.RLock()
 	defer a.mux.RUnlock()
+	return a.readTo(x, z, reader, nil)
+}
 
-	src, _, err := a.read(x, z)
+// readTo reads the entry at x,z as it is in `c` or in the current header if `c` is nil.
+// Callers must hold the read lock.
+func (a *file) readTo(x, z uint8, reader io.ReaderFrom, c *capture) (n int64, err error) {
+	src, _, err := a.read(x, z, c)
 	if err != nil {
 		return 0, err
 	}
@@ -209,35 +287,118 @@ func (a *file) ReadTo(x, z uint8, reader io.ReaderFrom) (n int64, err error) {
 	return 0, err
 }
 
-func (a *file) read(x, z uint8) (src io.ReadCloser, length int64, err error) {
+func (a *file) read(x, z uint8, c *capture) (src io.ReadCloser, length int64, err error) {
+	event := ReadEvent{Chunk: a.pos.chunk(x, z), Start: a.now()}
+
+	var method CompressMethod
+	if src, method, length, event.External, err = a.readRaw(x, z, c); err == nil {
+		var raw *countingReader
+		if a.settings.Observer != nil {
+			raw = &countingReader{ReadCloser: src}
+			src = raw
+		}
+
+		if src, err = method.decompressor(src, a.settings.dicts); err == nil {
+			src = a.limit(src, event.Chunk)
+			if raw != nil {
+				// the event is reported when the reader is closed
+				src = &observedReader{countingReader: countingReader{ReadCloser: src}, raw: raw, event: event, observer: a.settings.Observer}
+			}
+			return src, length, nil
+		}
+	}
+
+	a.observeRead(event, err)
+	return nil, 0, err
+}
+
+// readRaw returns a reader that reads the compressed data for the entry at x,z.
+// If `c` is not nil, the entry is read as it was when `c` was captured.
+// The returned length is only valid if the entry is not stored externally.
+func (a *file) readRaw(x, z uint8, c *capture) (src io.ReadCloser, method CompressMethod, length int64, external bool, err error) {
 	if x > 31 || z > 31 {
-		return nil, 0, fmt.Errorf("anvil: invalid chunk position")
+		return nil, 0, 0, false, fmt.Errorf("anvil: invalid chunk position")
 	}
 
 	if a.header == nil {
-		return nil, 0, ErrClosed
+		return nil, 0, 0, false, ErrClosed
 	}
 
 	entry := a.header.Get(x, z)
+	if c != nil {
+		entry = c.Get(x, z)
+	}
 
 	if !entry.Exists() {
-		return nil, 0, ErrNotExist
+		return nil, 0, 0, false, ErrNotExist
 	}
 
 	offset := entry.Offset() * SectionSize
-	var method CompressMethod
-	var external bool
 
 	if length, method, external, err = a.readEntryHeader(entry); err == nil {
-		var src io.ReadCloser
+		if data, ok := c.overwritten(x, z); ok && external {
+			return io.NopCloser(bytes.NewReader(data)), method, length, external, nil
+		}
 		if src, err = a.readerForEntry(x, z, offset, length, external); err == nil {
-			if src, err = method.decompressor(src); err == nil {
-				return src, length, nil
-			}
+			return src, method, length, external, nil
 		}
 	}
 
-	return nil, 0, err
+	return nil, 0, 0, false, err
+}
+
+// ReadRaw reads the compressed data for the entry at x,z without decompressing it.
+// This also returns the compression method used to compress the data.
+func (a *file) ReadRaw(x, z uint8) (buf []byte, method CompressMethod, err error) {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	return a.readRawBytes(x, z, nil)
+}
+
+// readRawBytes reads the compressed data for the entry at x,z as it is in `c`
+// or in the current header if `c` is nil.
+// Callers must hold the read lock.
+func (a *file) readRawBytes(x, z uint8, c *capture) (buf []byte, method CompressMethod, err error) {
+	event := ReadEvent{Chunk: a.pos.chunk(x, z), Raw: true, Start: a.now()}
+	defer func() {
+		event.Compressed = int64(len(buf))
+		a.observeRead(event, err)
+	}()
+
+	var src io.ReadCloser
+	if src, method, _, event.External, err = a.readRaw(x, z, c); err != nil {
+		return nil, 0, err
+	}
+
+	buf, err = io.ReadAll(src)
+	closeErr := src.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return buf, method, nil
+}
+
+// readEntry reads the entry at x,z and returns the header entry for the data that was read.
+// The compressed data is read if `raw` is set. The returned method is only set if `raw` is set.
+func (a *file) readEntry(x, z uint8, raw bool) (buf []byte, method CompressMethod, entry Entry, err error) {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+
+	if raw {
+		buf, method, err = a.readRawBytes(x, z, nil)
+	} else {
+		buf, err = a.readBytes(x, z, nil)
+	}
+
+	if err != nil {
+		return nil, 0, Entry{}, err
+	}
+	return buf, method, *a.header.Get(x, z), nil
 }
 
 // Write updates the data for the entry at x,z to the given buffer.
@@ -246,90 +407,253 @@ func (a *file) read(x, z uint8) (src io.ReadCloser, length int64, err error) {
 // If the data is larger than 1MB after compression, the data is stored externally.
 // Calling this function with an empty buffer is the equivalent of calling `Remove(x,z)`.
 func (a *file) Write(x, z uint8, b []byte) (err error) {
+	return a.WriteWithOptions(x, z, b, WriteOptions{})
+}
+
+// WriteWithOptions is the same as [file.Write] but uses the given options
+// to set the timestamp and the compression method used for this entry.
+func (a *file) WriteWithOptions(x, z uint8, b []byte, opts WriteOptions) (err error) {
 	if len(b) == 0 {
 		return a.Remove(x, z)
 	}
 
-	a.mux.Lock()
-	defer a.mux.Unlock()
+	event := a.writeEvent(x, z)
+	event.Uncompressed = int64(len(b))
+	defer func() { a.observeWrite(&event, err) }()
 
 	// check if the write is valid and if the file is open
-	if err = a.checkWrite(x, z); err != nil {
+	var method CompressMethod
+	if method, err = a.method(x, z, opts.Compression); err != nil {
 		return err
 	}
 
-	// compress the given buffer
+	// compress the given buffer without holding the lock,
+	// so that other entries can be read and written while compressing.
 	var buf *buffer
-	if buf, err = a.compress(b); err != nil {
+	if buf, err = method.compress(b, a.settings.dicts); err != nil {
 		return errors.Wrap("anvil: error compressing data", err)
 	}
 	defer buf.Reset()
 
+	return a.writeBuffer(x, z, buf, opts.Timestamp, &event)
+}
+
+// WriteRaw writes data that was already compressed using the given method
+// to the entry at x,z without recompressing it.
+// If the data is larger than 1MB, the data is stored externally.
+func (a *file) WriteRaw(x, z uint8, method CompressMethod, b []byte) (err error) {
+	return a.writeRaw(x, z, method, b, time.Time{})
+}
+
+// writeRaw is the same as [file.WriteRaw] but also sets the timestamp for the entry.
+// If timestamp is zero, the current time is used.
+func (a *file) writeRaw(x, z uint8, method CompressMethod, b []byte, timestamp time.Time) (err error) {
+	if !method.supported() {
+		return errors.New("anvil: unsupported compression method")
+	}
+
+	if len(b) == 0 {
+		return a.Remove(x, z)
+	}
+
+	event := a.writeEvent(x, z)
+	event.Raw = true
+	defer func() { a.observeWrite(&event, err) }()
+
+	buf := &buffer{}
+	defer buf.Reset()
+	buf.AppendBytes(b)
+	buf.CompressMethod(method)
+
+	return a.writeBuffer(x, z, buf, timestamp, &event)
+}
+
+// writeBuffer writes the given buffer to the entry at x,z.
+// If the buffer is larger than 1MB, the data is stored externally.
+// If timestamp is zero, the current time is used.
+// The size of the data and if it was stored externally is set in `event`.
+//
+// The write lock is not held while the data and the header are synced, so syncs run concurrently with reads
+// and writes of other entries. The data is written while holding the lock since not every [afero.File] supports
+// concurrent reads and writes at different offsets.
+// The data of entries stored externally is written and synced while holding the write lock.
+func (a *file) writeBuffer(x, z uint8, buf *buffer, timestamp time.Time, event *WriteEvent) (err error) {
 	size := sections(uint(buf.Len()))
+	event.Compressed = max(int64(buf.Len())-entryHeaderSize, 0)
+
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
 
 	if size > 255 {
-		if a.settings.fs == nil {
-			return ErrExternal
+		// the data would not be readable, see [file.readerForEntry]
+		if limit := a.settings.MaxExternalSize; limit > 0 && event.Compressed > limit {
+			return &LimitError{Chunk: a.pos.chunk(x, z), External: true, Limit: limit}
 		}
+		return a.writeExternal(x, z, buf, timestamp, event)
+	}
+
+	var offset uint
+	a.mux.Lock()
+	// check if the write is valid and if the file is open
+	if err = a.checkWrite(x, z); err == nil {
+		offset, err = a.writeData(buf, size)
+	}
+	a.mux.Unlock()
 
-		cx, cz := a.pos.External(x, z)
+	if err != nil {
+		return err
+	}
 
-		var f afero.File
+	if err = a.sync(event); err != nil {
+		err = errors.Wrap("anvil: unable to write entry data", err)
+	}
 
-		filename := fmt.Sprintf(a.settings.ChunkFmt, cx, cz)
-		if f, err = a.settings.fs.Create(filename); err != nil {
-			return errors.Wrap("anvil: unable to create external file", err)
-		}
+	a.headerMux.Lock()
+	defer a.headerMux.Unlock()
+	var n *Notification
+	defer func() { a.notify(n) }()
+	a.mux.Lock()
+	defer a.mux.Unlock()
 
-		if err = buf.WriteTo(f, false); err != nil {
-			return errors.Wrap("anvil: unable to write external file", err)
-		}
+	// the file may have been closed while the data was written
+	if a.header == nil {
+		return ErrClosed
+	}
+
+	entry := Entry{offset: uint32(offset), size: uint8(size), timestamp: int32(timestamp.Unix())}
+	if err != nil {
+		a.header.unreserve(entry)
+		return err
+	}
+
+	defer a.freeze()()
+	n, err = a.updateHeader(x, z, entry, event)
+	return err
+}
+
+// writeExternal writes the given buffer to the external file for the entry at x,z
+// and updates the entry to point to the external file.
+func (a *file) writeExternal(x, z uint8, buf *buffer, timestamp time.Time, event *WriteEvent) (err error) {
+	a.headerMux.Lock()
+	defer a.headerMux.Unlock()
+	var n *Notification
+	defer func() { a.notify(n) }()
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	// check if the write is valid and if the file is open
+	if err = a.checkWrite(x, z); err != nil {
+		return err
+	}
+
+	if a.settings.fs == nil {
+		return ErrExternal
+	}
+	defer a.freeze()()
 
-		method := buf.compress
-		buf.Reset()
+	event.External = true
+	if err = a.spill(x, z, buf); err != nil {
+		return err
+	}
+
+	method := buf.compress
+	buf.Reset()
+
+	buf.AppendBytes([]byte{0})
+	buf.CompressMethod(method | externalMask)
+
+	var offset uint
+	if offset, err = a.writeData(buf, 1); err != nil {
+		return err
+	}
 
-		buf.AppendBytes([]byte{0})
-		buf.CompressMethod(method | externalMask)
-		size = 1
+	if err = a.sync(event); err != nil {
+		a.header.unreserve(Entry{offset: uint32(offset), size: 1})
+		return errors.Wrap("anvil: unable to write entry data", err)
 	}
 
+	n, err = a.updateHeader(x, z, Entry{offset: uint32(offset), size: 1, timestamp: int32(timestamp.Unix())}, event)
+	return err
+}
+
+// writeData finds free space to store `size` sections, growing the file if needed,
+// and writes the given buffer to it without syncing the file.
+// The space is reserved using [Header.reserve] and must be committed using [file.updateHeader]
+// or freed using [Header.unreserve].
+// Callers must hold the write lock.
+func (a *file) writeData(buf *buffer, size uint) (offset uint, err error) {
 	// try to find space to store the data
 	offset, hasSpace := a.header.FindSpace(size)
 
 	// If we don't have enough space, grow the file to to make space
 	if !hasSpace {
 		if offset, err = a.growFile(size); err != nil {
-			return errors.Wrap("anvil: unable to grow file", err)
+			return 0, errors.Wrap("anvil: unable to grow file", err)
 		}
 	}
 
+	entry := Entry{offset: uint32(offset), size: uint8(size)}
+	if err = a.header.reserve(entry); err != nil {
+		return 0, err
+	}
+
 	if err = buf.WriteAt(a.writer, int64(offset)*SectionSize, true); err != nil {
-		return errors.Wrap("anvil: unable to write entry data", err)
+		a.header.unreserve(entry)
+		return 0, errors.Wrap("anvil: unable to write entry data", err)
 	}
-	if err = a.writer.Sync(); err != nil {
-		return errors.Wrap("anvil: unable to write entry data", err)
+	return offset, nil
+}
+
+// spill writes the given buffer to the external file for the entry at x,z.
+func (a *file) spill(x, z uint8, buf *buffer) (err error) {
+	cx, cz := a.pos.External(x, z)
+
+	if a.settings.Observer != nil {
+		defer func() {
+			a.settings.Observer.Spill(SpillEvent{Chunk: a.pos.chunk(x, z), Size: int64(buf.Len()) - entryHeaderSize, Err: err})
+		}()
 	}
 
-	return a.updateHeader(x, z, offset, uint8(size))
+	var f afero.File
+
+	filename := fmt.Sprintf(a.settings.ChunkFmt, cx, cz)
+	if err = a.preserveExternal(x, z, filename); err != nil {
+		return err
+	}
+
+	if f, err = a.settings.fs.Create(filename); err != nil {
+		return errors.Wrap("anvil: unable to create external file", err)
+	}
+
+	if err = buf.WriteTo(f, false); err != nil {
+		return errors.Wrap("anvil: unable to write external file", err)
+	}
+	return nil
 }
 
 // Remove removes the given entry from the file.
 func (a *file) Remove(x, z uint8) (err error) {
+	a.headerMux.Lock()
+	defer a.headerMux.Unlock()
+	var n *Notification
+	defer func() { a.notify(n) }()
 	a.mux.Lock()
 	defer a.mux.Unlock()
 
+	event := a.writeEvent(x, z)
+	event.Removed = true
+	defer func() { a.observeWrite(&event, err) }()
+
 	// check if the write is valid and if the file is open
 	if err = a.checkWrite(x, z); err != nil {
 		return
 	}
-
-	if err = a.header.Remove(x, z); err != nil {
-		return
-	}
+	defer a.freeze()()
 
 	// grow the file so that it has at least enough space to fit the header
 	if _, err = a.growFile(0); err == nil {
-		err = a.updateHeader(x, z, 0, 0)
+		n, err = a.updateHeader(x, z, Entry{timestamp: int32(time.Now().Unix())}, &event)
 	}
 
 	return
@@ -344,9 +668,8 @@ func (a *file) CompressionMethod(m CompressMethod) (err error) {
 		return ErrClosed
 	}
 
-	var c compressor
-	if c, err = m.compressor(); err == nil {
-		a.cm, a.c = m, c
+	if _, err = m.compressPool(a.settings.dicts); err == nil {
+		a.cm = m
 	}
 	return
 }
@@ -366,6 +689,13 @@ func (a *file) Close() (err error) {
 	a.mux.Lock()
 	defer a.mux.Unlock()
 	if a.header != nil {
+		if a.settings.Observer != nil {
+			start := time.Now()
+			defer func() {
+				a.settings.Observer.Close(CloseEvent{Region: a.pos.region(), Start: start, Duration: time.Since(start), Err: err})
+			}()
+		}
+
 		a.header.Free()
 		a.header = nil
 		if a.writer != nil {
@@ -388,10 +718,21 @@ func (a *file) readerForEntry(x, z uint8, offset, length int64, external bool) (
 		entryX, entryZ := a.pos.External(x, z)
 		filename := fmt.Sprintf(a.settings.ChunkFmt, entryX, entryZ)
 
-		if src, err = a.settings.fs.Open(filename); err != nil {
+		var f afero.File
+		if f, err = a.settings.fs.Open(filename); err != nil {
 			return nil, errors.Wrap("anvil: unable to open external file", err)
 		}
-		return
+
+		if limit := a.settings.MaxExternalSize; limit > 0 {
+			limitErr := &LimitError{Chunk: a.pos.chunk(x, z), External: true, Limit: limit}
+			if info, err := f.Stat(); err == nil && info.Size() > limit {
+				f.Close()
+				return nil, limitErr
+			}
+			// the file may grow after it was checked
+			return &limitReader{ReadCloser: f, n: limit, err: limitErr}, nil
+		}
+		return f, nil
 	}
 	return nil, ErrExternal
 }
@@ -410,7 +751,8 @@ func (a *file) readEntryHeader(entry *Entry) (length int64, method CompressMetho
 		// reduce the length by 1 since we already read the compression byte
 		length--
 
-		if length/SectionSize > int64(entry.size) {
+		// the data must fit in the sections used by the entry
+		if length < 0 || length+entryHeaderSize > int64(entry.size)*SectionSize {
 			return 0, 0, false, errors.CauseStr(ErrCorrupted, "chunk size mismatch")
 		}
 	}
@@ -445,65 +787,146 @@ func (a *file) growFile(size uint) (offset uint, err error) {
 		fileSize = SectionSize * 2
 	}
 
+	oldSize := a.size
 	offset = sections(uint(fileSize))
 	a.size = int64(offset+size) * SectionSize // insure the file size is a multiple of 4096 bytes
 	err = a.writer.Truncate(a.size)
+
+	if a.settings.Observer != nil && a.size != oldSize {
+		a.settings.Observer.Grow(GrowEvent{Region: a.pos.region(), OldSize: oldSize, NewSize: a.size, Err: err})
+	}
 	return
 }
 
-// updateHeader updates the offset, size and timestamp in the main header for the entry at x,z.
-func (a *file) updateHeader(x, z uint8, offset uint, size uint8) (err error) {
+// updateHeader updates the entry at x,z in the header of the file to `entry`, syncs the header
+// and commits the entry to [Header]. The space used by the entry must have been reserved using [Header.reserve].
+// If `entry` does not exist, this removes the entry.
+//
+// Callers must hold `headerMux` and the write lock. The write lock is released while the header is synced,
+// so reads are not blocked by the sync. The entry is only committed once the sync succeeds.
+// If an error occurs, the previous entry is written back to the file and the space reserved for `entry` is freed.
+// The time spent syncing is added to `event`.
+// This returns the notification for the change, which must be sent using [file.notify] once the locks are
+// released. The notification is nil if an entry that does not exist was removed.
+func (a *file) updateHeader(x, z uint8, entry Entry, event *WriteEvent) (n *Notification, err error) {
 	if x > 31 || z > 31 {
 		panic("invalid position")
 	}
 
-	headerOffset := int64(x)<<2 | int64(z)<<7
-	entry := Entry{offset: uint32(offset), size: uint8(size), timestamp: int32(time.Now().Unix())}
+	// the entry can only be changed by callers holding `headerMux`
+	old := *a.header.Get(x, z)
+
+	if err = a.writeHeader(x, z, entry); err == nil {
+		a.mux.Unlock()
+		err = a.sync(event)
+		a.mux.Lock()
+
+		// the file may have been closed while the header was synced
+		if a.header == nil {
+			return nil, ErrClosed
+		}
+	}
 
-	if err = a.writeUint32At(uint32(offset)<<8|uint32(size), headerOffset); err != nil {
-		return errors.Wrap("anvil: unable to update header", err)
+	if err != nil {
+		// the previous entry is still committed, restore it in the file
+		a.writeHeader(x, z, old)
+		a.header.unreserve(entry)
+		return nil, errors.Wrap("anvil: unable to update header", err)
 	}
 
-	if err = a.header.Set(x, z, entry); err != nil {
-		return
+	if err = a.header.commit(x, z, entry); err != nil {
+		return nil, err
+	}
+
+	kind := NotifyWritten
+	if !entry.Exists() {
+		if !old.Exists() {
+			return nil, nil
+		}
+		kind = NotifyRemoved
 	}
+	return &Notification{ChunkPos: a.pos.chunk(x, z), Kind: kind, Timestamp: time.Unix(int64(entry.timestamp), 0)}, nil
+}
 
-	if err = a.writeUint32At(uint32(entry.timestamp), headerOffset+SectionSize); err != nil {
-		return errors.Wrap("anvil: unable to update timestamp", err)
+// notify sends the given notification to the subscribers of the [Anvil] that opened this file.
+// This must be called after the write lock is released and before `headerMux` is released,
+// so that subscribers can read the file and notifications are sent in the order the changes were made.
+func (a *file) notify(n *Notification) {
+	if n != nil && a.cache != nil {
+		a.cache.notify(*n)
 	}
-	return
 }
 
-// writeUint32 writes the given uint32 at the given position
-// and syncs the changes to disk.
-func (a *file) writeUint32At(v uint32, offset int64) (err error) {
+// writeHeader writes the location and the timestamp of the entry at x,z to the header of the file without syncing it.
+func (a *file) writeHeader(x, z uint8, entry Entry) (err error) {
+	headerOffset := int64(x)<<2 | int64(z)<<7
+
 	var tmp [4]byte
-	binary.BigEndian.PutUint32(tmp[:], v)
-	if _, err = a.writer.WriteAt(tmp[:], offset); err == nil {
-		err = a.writer.Sync()
+	binary.BigEndian.PutUint32(tmp[:], entry.offset<<8|uint32(entry.size))
+	if _, err = a.writer.WriteAt(tmp[:], headerOffset); err != nil {
+		return err
 	}
 
-	return
+	binary.BigEndian.PutUint32(tmp[:], uint32(entry.timestamp))
+	_, err = a.writer.WriteAt(tmp[:], headerOffset+SectionSize)
+	return err
 }
 
-// compress compresses the given byte slice and writes it to a buffer.
-func (a *file) compress(b []byte) (buf *buffer, err error) {
-	if a.cm == 0 || a.c == nil {
-		a.cm = DefaultCompression
-		if a.c, err = a.cm.compressor(); err != nil {
-			return nil, err
-		}
+// method checks if the write is valid and returns the compression method to use for it.
+// If method is zero, the method set by [file.CompressionMethod] is used.
+func (a *file) method(x, z uint8, method CompressMethod) (CompressMethod, error) {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+
+	if err := a.checkWrite(x, z); err != nil {
+		return 0, err
 	}
 
-	buf = &buffer{}
-	buf.CompressMethod(a.cm)
-	a.c.Reset(buf)
+	if method == 0 {
+		method = a.cm
+	}
+	if method == 0 {
+		method = DefaultCompression
+	}
+	return method, nil
+}
 
-	if _, err = a.c.Write(b); err == nil {
-		if err = a.c.Close(); err == nil {
-			return buf, nil
-		}
+// sync syncs the file to disk.
+// If [Settings.Observer] is set, the time spent is added to `event`.
+func (a *file) sync(event *WriteEvent) error {
+	if a.settings.Observer == nil {
+		return a.writer.Sync()
 	}
 
-	return nil, err
+	start := time.Now()
+	err := a.writer.Sync()
+	event.Sync += time.Since(start)
+	return err
+}
+
+// now returns the current time if [Settings.Observer] is set.
+func (a *file) now() (t time.Time) {
+	if a.settings.Observer != nil {
+		t = time.Now()
+	}
+	return
+}
+
+func (a *file) observeRead(event ReadEvent, err error) {
+	if a.settings.Observer != nil {
+		event.Duration, event.Err = time.Since(event.Start), err
+		a.settings.Observer.Read(event)
+	}
+}
+
+// writeEvent returns the event for a write to the entry at x,z.
+func (a *file) writeEvent(x, z uint8) WriteEvent {
+	return WriteEvent{Chunk: a.pos.chunk(x, z), Start: a.now()}
+}
+
+func (a *file) observeWrite(event *WriteEvent, err error) {
+	if a.settings.Observer != nil {
+		event.Duration, event.Err = time.Since(event.Start), err
+		a.settings.Observer.Write(*event)
+	}
 }
@@ -78,9 +78,49 @@ func (c *cachedFile) Write(x, z uint8, b []byte) (err error) {
 		return ErrClosed
 	}
 
+	c.file.discardQueued(x, z)
 	return c.file.Write(x, z, b)
 }
 
+// WriteWithOptions is the same as [cachedFile.Write] but uses the given options
+// to set the timestamp and the compression method used for this entry.
+func (c *cachedFile) WriteWithOptions(x, z uint8, b []byte, opts WriteOptions) (err error) {
+	c.closeMux.RLock()
+	defer c.closeMux.RUnlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	c.file.discardQueued(x, z)
+	return c.file.WriteWithOptions(x, z, b, opts)
+}
+
+// ReadRaw reads the compressed data for the entry at x,z without decompressing it.
+// This also returns the compression method used to compress the data.
+func (c *cachedFile) ReadRaw(x, z uint8) (buf []byte, method CompressMethod, err error) {
+	c.closeMux.RLock()
+	defer c.closeMux.RUnlock()
+	if c.closed {
+		return nil, 0, ErrClosed
+	}
+
+	return c.file.ReadRaw(x, z)
+}
+
+// WriteRaw writes data that was already compressed using the given method
+// to the entry at x,z without recompressing it.
+// If the data is larger than 1MB, the data is stored externally.
+func (c *cachedFile) WriteRaw(x, z uint8, method CompressMethod, b []byte) (err error) {
+	c.closeMux.RLock()
+	defer c.closeMux.RUnlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	c.file.discardQueued(x, z)
+	return c.file.WriteRaw(x, z, method, b)
+}
+
 // Remove removes the given entry from the file.
 func (c *cachedFile) Remove(x, z uint8) (err error) {
 	c.closeMux.RLock()
@@ -89,6 +129,7 @@ func (c *cachedFile) Remove(x, z uint8) (err error) {
 		return ErrClosed
 	}
 
+	c.file.discardQueued(x, z)
 	return c.file.Remove(x, z)
 }
 
@@ -5,7 +5,12 @@ import (
 	"crypto/rand"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/spf13/afero"
 	"github.com/spf13/afero/mem"
@@ -171,3 +176,172 @@ func readFnTest(is is.Is, f File, x, z uint8, buf *bytes.Buffer) {
 	buf.Reset()
 	buf.Write(data)
 }
+
+func TestWriteWithOptions(t *testing.T) {
+	is := is.New(t)
+	memFile := mem.NewFileHandle(mem.CreateFile("write-test-options.mca"))
+
+	f, err := ReadAnvil(0, 0, memFile, 0, nil, Settings{})
+	is(err == nil, "unexpected error occurred while creating anvil file: %s", err)
+
+	data := bytes.Repeat([]byte{1, 2, 3}, 1000)
+	timestamp := time.Unix(1234567890, 0)
+
+	w, ok := f.(OptionsWriter)
+	is(ok, "file does not implement OptionsWriter")
+	err = w.WriteWithOptions(1, 2, data, WriteOptions{Timestamp: timestamp, Compression: CompressionGzip})
+	is(err == nil, "unexpected error: %s", err)
+
+	entry, exists := f.Info(1, 2)
+	is(exists, "entry does not exist")
+	is(entry.Modified().Equal(timestamp), "incorrect timestamp: %s", entry.Modified())
+
+	_, method, _, err := f.(*file).readEntryHeader(&entry)
+	is(err == nil, "unexpected error: %s", err)
+	is(method == CompressionGzip, "incorrect compression method: %s", method)
+
+	var bb bytes.Buffer
+	readFnTest(is, f, 1, 2, &bb)
+	is(bytes.Equal(data, bb.Bytes()), "incorrect value read")
+
+	// the compression method set for the file should not change
+	err = f.Write(2, 2, data)
+	is(err == nil, "unexpected error: %s", err)
+	entry, _ = f.Info(2, 2)
+	_, method, _, err = f.(*file).readEntryHeader(&entry)
+	is(err == nil, "unexpected error: %s", err)
+	is(method == DefaultCompression, "incorrect compression method: %s", method)
+	is(time.Since(entry.Modified()) < time.Minute, "incorrect timestamp: %s", entry.Modified())
+}
+
+func TestRawCopy(t *testing.T) {
+	is := is.New(t)
+
+	src, err := OpenFs(afero.NewMemMapFs())
+	is(err == nil, "unexpected error: %s", err)
+	dstFs := afero.NewMemMapFs()
+	dst, err := OpenFs(dstFs)
+	is(err == nil, "unexpected error: %s", err)
+
+	small := bytes.Repeat([]byte{4, 5, 6}, 1000)
+	large := make([]byte, SectionSize*300)
+	_, err = rand.Read(large)
+	is(err == nil, "unexpected error: %s", err)
+
+	err = src.WriteWithOptions(1, 1, small, WriteOptions{Compression: CompressionGzip})
+	is(err == nil, "unexpected error: %s", err)
+	err = src.Write(2, 2, large)
+	is(err == nil, "unexpected error: %s", err)
+
+	for _, pos := range [][2]int32{{1, 1}, {2, 2}} {
+		raw, method, err := src.ReadRaw(pos[0], pos[1])
+		is(err == nil, "unexpected error: %s", err)
+		err = dst.WriteRaw(pos[0], pos[1], method, raw)
+		is(err == nil, "unexpected error: %s", err)
+
+		copied, copiedMethod, err := dst.ReadRaw(pos[0], pos[1])
+		is(err == nil, "unexpected error: %s", err)
+		is(copiedMethod == method, "incorrect compression method")
+		is(bytes.Equal(copied, raw), "raw data was modified")
+	}
+
+	data, err := dst.Read(1, 1)
+	is(err == nil, "unexpected error: %s", err)
+	is(bytes.Equal(data, small), "incorrect value read")
+
+	data, err = dst.Read(2, 2)
+	is(err == nil, "unexpected error: %s", err)
+	is(bytes.Equal(data, large), "incorrect value read")
+
+	_, err = dstFs.Stat("c.2.2.mcc")
+	is(err == nil, "external entry was not stored externally: %s", err)
+
+	err = dst.WriteRaw(3, 3, CompressionZlib|externalMask, small)
+	is(err != nil, "invalid compression method was accepted")
+}
+
+func TestConcurrentWrite(t *testing.T) {
+	is := is.New(t)
+
+	fs := afero.NewMemMapFs()
+	f, err := ReadAnvil(0, 0, mem.NewFileHandle(mem.CreateFile("concurrent")), 0, fs)
+	is(err == nil, "unexpected error: %s", err)
+
+	// each goroutine writes to its own entries, overwriting them several times
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				for x := uint8(g * 4); x < uint8(g*4+4); x++ {
+					data := bytes.Repeat([]byte{x, byte(i)}, 1000*(1+i%5))
+					if err := f.Write(x, uint8(i%2), data); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for x := uint8(0); x < 32; x++ {
+		for z := uint8(0); z < 2; z++ {
+			i := 18 + int(z)
+			data, err := f.Read(x, z)
+			is(err == nil, "unexpected error: %s", err)
+			is(bytes.Equal(data, bytes.Repeat([]byte{x, byte(i)}, 1000*(1+i%5))), "incorrect data at (%d,%d)", x, z)
+		}
+	}
+
+	// the space used by the entries must match the header
+	a := f.(*file)
+	used := a.header.used.Clone()
+	used.ClearAll()
+	for _, entry := range a.header.entries {
+		for i := uint(0); i < uint(entry.size); i++ {
+			used.Set(uint(entry.offset) + i)
+		}
+	}
+	is(used.Equal(a.header.used), "space used by the entries does not match the header")
+}
+
+// BenchmarkConcurrentWrite writes to different entries of the same anvil file from multiple goroutines.
+func BenchmarkConcurrentWrite(b *testing.B) {
+	payload := bytes.Repeat([]byte("anvil concurrent write benchmark "), 1000)
+
+	for _, goroutines := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprint(goroutines), func(b *testing.B) {
+			path := filepath.Join(b.TempDir(), "r.0.0.mca")
+			osFile, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			f, err := ReadAnvil(0, 0, osFile, 0, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+
+			var next atomic.Int64
+			var wg sync.WaitGroup
+			b.SetBytes(int64(len(payload)))
+			b.ResetTimer()
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := next.Add(1); i <= int64(b.N); i = next.Add(1) {
+						if err := f.Write(uint8(i&31), uint8(i>>5&31), payload); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package anvil
 
 import (
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 
 	"github.com/spf13/afero"
+	"github.com/spf13/afero/mem"
 	"github.com/yehan2002/errors"
 )
 
@@ -52,3 +55,63 @@ func openFile(path string, settings Settings) (r reader, size int64, err error)
 
 	return f, info.Size(), nil
 }
+
+// ioFS an [afero.Fs] that reads files from an [fs.FS].
+// Files that do not implement [io.ReaderAt] (e.g. compressed files in a zip archive)
+// are read into memory when they are opened.
+type ioFS struct {
+	afero.FromIOFS
+	// maxExternal the maximum size of external files, see [Settings.MaxExternalSize].
+	maxExternal int64
+	// chunkFmt the format of the names of external files, see [Settings.ChunkFmt].
+	chunkFmt string
+}
+
+func (f ioFS) Open(name string) (afero.File, error) { return f.OpenFile(name, os.O_RDONLY, 0) }
+
+func (f ioFS) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_APPEND|os.O_TRUNC) != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if _, ok := file.(io.ReaderAt); ok || err != nil || info.IsDir() {
+		file.Close()
+		return f.FromIOFS.Open(name)
+	}
+	defer file.Close()
+
+	// the file is not validated before it is read, so it must not be read into memory without a limit
+	var src io.Reader = file
+	limit := f.limit(name)
+	if limit > 0 {
+		src = io.LimitReader(file, limit+1)
+	}
+
+	data := mem.CreateFile(name)
+	n, err := io.Copy(mem.NewFileHandle(data), src)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	} else if limit > 0 && n > limit {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: ErrTooLarge}
+	}
+	mem.SetModTime(data, info.ModTime())
+	return mem.NewReadOnlyFileHandle(data), nil
+}
+
+// limit returns the maximum size of the given file.
+// External files are limited to `maxExternal` and all other files to the size of the largest valid anvil file.
+// This returns a value less than 1 if the size is not limited.
+func (f ioFS) limit(name string) int64 {
+	var x, z int32
+	// Sscanf ignores any trailing characters, so check if the name matches exactly
+	if _, err := fmt.Sscanf(name, f.chunkFmt, &x, &z); err == nil && fmt.Sprintf(f.chunkFmt, x, z) == name {
+		return f.maxExternal
+	}
+	return MaxFileSections * SectionSize
+}
@@ -0,0 +1,124 @@
+package anvil
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type fsTest struct{}
+
+func TestFS(t *testing.T) { is.SuiteP(t, &fsTest{}) }
+
+var fsEntries = map[[2]int32]int64{{0, 0}: 1, {1, 0}: 2, {40, 2}: 3, {-3, -70}: 4}
+
+// files returns the anvil files of a world containing [fsEntries].
+func (*fsTest) files(is is.Is) map[string][]byte {
+	world := makeWorld(is, fsEntries)
+	regions, err := world.Regions()
+	is(err == nil, "unexpected error: %s", err)
+
+	files := map[string][]byte{}
+	for _, rg := range regions {
+		name := fmt.Sprintf(world.settings.AnvilFmt, rg.X, rg.Z)
+		files["world/region/"+name], err = afero.ReadFile(world.settings.fs, name)
+		is(err == nil, "unexpected error: %s", err)
+	}
+	return files
+}
+
+func (*fsTest) check(is is.Is, fsys fs.FS) {
+	sub, err := fs.Sub(fsys, "world/region")
+	is(err == nil, "unexpected error: %s", err)
+
+	world, err := OpenFS(sub)
+	is(err == nil, "unexpected error: %s", err)
+
+	regions, err := world.Regions()
+	is(err == nil, "unexpected error: %s", err)
+	is(len(regions) == 3, "incorrect number of regions: %d", len(regions))
+
+	for pos, value := range fsEntries {
+		data, err := world.Read(pos[0], pos[1])
+		is(err == nil, "unexpected error: %s", err)
+		is(bytes.Equal(data, []byte{byte(value), byte(pos[0]), byte(pos[1])}), "incorrect data at (%d,%d)", pos[0], pos[1])
+	}
+
+	err = world.Write(0, 0, []byte{1})
+	is(errors.Is(err, ErrReadOnly), "incorrect error returned: %s", err)
+}
+
+func (f *fsTest) TestMapFS(is is.Is) {
+	fsys := fstest.MapFS{}
+	for name, data := range f.files(is) {
+		fsys[name] = &fstest.MapFile{Data: data}
+	}
+	f.check(is, fsys)
+}
+
+func (f *fsTest) TestZip(is is.Is) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range f.files(is) {
+		fw, err := w.Create(name)
+		is(err == nil, "unexpected error: %s", err)
+		_, err = fw.Write(data)
+		is(err == nil, "unexpected error: %s", err)
+	}
+	is(w.Close() == nil, "unable to create zip archive")
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	is(err == nil, "unexpected error: %s", err)
+	f.check(is, r)
+}
+
+func (*fsTest) TestZipLimit(is is.Is) {
+	memFs := afero.NewMemMapFs()
+	world, err := OpenFs(memFs)
+	is(err == nil, "unexpected error: %s", err)
+	f, err := world.File(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+	is(f.CompressionMethod(CompressionNone) == nil, "unexpected error")
+	is(f.Write(4, 5, make([]byte, 2<<20)) == nil, "unexpected error")
+	is(f.Close() == nil, "unexpected error")
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"r.0.0.mca", "c.4.5.mcc"} {
+		data, err := afero.ReadFile(memFs, name)
+		is(err == nil, "unexpected error: %s", err)
+		fw, err := w.Create(name)
+		is(err == nil, "unexpected error: %s", err)
+		_, err = fw.Write(data)
+		is(err == nil, "unexpected error: %s", err)
+	}
+	is(w.Close() == nil, "unable to create zip archive")
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	is(err == nil, "unexpected error: %s", err)
+
+	// the oversized external file is not read into memory
+	world, err = OpenFS(r, Settings{MaxExternalSize: 1 << 20})
+	is(err == nil, "unexpected error: %s", err)
+	_, err = world.Read(4, 5)
+	is(errors.Is(err, ErrTooLarge), "incorrect error returned: %s", err)
+	var pathErr *fs.PathError
+	is(errors.As(err, &pathErr) && pathErr.Op == "read", "external file was read into memory: %s", err)
+
+	world, err = OpenFS(r, Settings{MaxExternalSize: -1})
+	is(err == nil, "unexpected error: %s", err)
+	data, err := world.Read(4, 5)
+	is(err == nil && len(data) == 2<<20, "unexpected error: %s", err)
+
+	// anvil files are limited to the size of the largest valid file
+	fsys := ioFS{maxExternal: 1 << 20, chunkFmt: defaultSettings.ChunkFmt}
+	is(fsys.limit("c.-1.2.mcc") == 1<<20, "incorrect limit for an external file")
+	is(fsys.limit("r.0.0.mca") == MaxFileSections*SectionSize, "incorrect limit for an anvil file")
+	is(fsys.limit("c.1.2.mcc.bak") == MaxFileSections*SectionSize, "incorrect limit for another file")
+}
@@ -20,6 +20,12 @@ type pos struct{ x, z int32 }
 // External gets the x and z for an entry that is stored in a separate file.
 func (r *pos) External(x, z uint8) (int32, int32) { return r.x<<5 | int32(x), r.z<<5 | int32(z) }
 
+// chunk gets the position of the entry at x,z in the world.
+func (r *pos) chunk(x, z uint8) ChunkPos { return ChunkPos{X: r.x<<5 | int32(x), Z: r.z<<5 | int32(z)} }
+
+// region returns the position as a [RegionPos].
+func (r *pos) region() RegionPos { return RegionPos{X: r.x, Z: r.z} }
+
 // sections returns the minimum number of sections to store the given number of bytes
 func sections(v uint) uint { return (v + SectionSize - 1) / SectionSize }
 
@@ -52,6 +58,20 @@ func (e *Entry) Offset() int64 { return int64(e.offset) }
 type Header struct {
 	entries *[Entries]Entry
 	used    *bitset.BitSet
+
+	// strategy the strategy used by [Header.FindSpace].
+	strategy AllocStrategy
+	// next where the next search starts when using [AllocNextFit].
+	next uint
+	// free the free lists used by [AllocSegregated].
+	// This is nil until [Header.FindSpace] first uses [AllocSegregated], and is reset when the header is
+	// loaded, cleared or found to be inconsistent. Once built, the lists are kept current by [Header.markFree] and [Header.clearFree].
+	free *freeList
+
+	// holding if space freed by [Header.Set] and [Header.Remove] is held until [Header.release] is called.
+	holding bool
+	// held the entries whose space is held.
+	held []Entry
 }
 
 // Get gets the entry at the given x,z coords.
@@ -63,7 +83,10 @@ func (h *Header) Get(x, z uint8) *Entry {
 	return &h.entries[uint16(x&0x1f)|(uint16(z&0x1f)<<5)]
 }
 
-func (h *Header) clear() { *h.entries = [Entries]Entry{}; h.used.ClearAll() }
+func (h *Header) clear() { *h.entries = [Entries]Entry{}; h.used.ClearAll(); h.free = nil }
+
+// SetStrategy sets the strategy used by [Header.FindSpace] to find free space.
+func (h *Header) SetStrategy(s AllocStrategy) { h.strategy, h.free = s, nil }
 
 // Set updates the entry at x,z and the given marks the
 // space used by the given entry in the `used` bitset as used.
@@ -107,10 +130,12 @@ func (h *Header) Remove(x, z uint8) error {
 // markSpace marks the space used by the given entry as used.
 // This panics if the entry overflows into used an area.
 func (h *Header) markSpace(c Entry) error {
+	h.markFree(c)
 	for i := uint(0); i < uint(c.size); i++ {
 		pos := uint(c.offset) + i
 
 		if h.used.Test(pos) {
+			h.free = nil
 			return fmt.Errorf("anvil: Header: entry overflows into used space")
 		}
 
@@ -126,39 +151,79 @@ func (h *Header) freeSpace(c *Entry) error {
 		return nil
 	}
 
+	if h.holding {
+		// the space stays marked as used so that it is not reused
+		h.held = append(h.held, *c)
+		return nil
+	}
+	return h.clearSpace(c)
+}
+
+// clearSpace marks the space used by the entry as unused even if space is held.
+func (h *Header) clearSpace(c *Entry) error {
 	for i := uint(0); i < uint(c.size); i++ {
 		pos := uint(c.offset) + i
 		if !h.used.Test(pos) {
+			h.free = nil
 			return fmt.Errorf("anvil: Header: inconsistent usage of space")
 		}
 		h.used.Clear(pos)
 	}
+	h.clearFree(*c)
 	return nil
 }
 
-// FindSpace finds the next free space large enough to store `size` sections
-func (h *Header) FindSpace(size uint) (offset uint, found bool) {
-	// ignore the first two section since they are used for the header
-	offset = 2
+// reserve marks the space used by the given entry as used without adding the entry to the header,
+// so that the space is not used by other entries while the data of the entry is written.
+// The entry is added to the header using [Header.commit].
+func (h *Header) reserve(c Entry) error { return h.markSpace(c) }
 
-	var hasSpace = true
-	for hasSpace {
-		var next uint
+// unreserve frees space reserved using [Header.reserve] that was not committed.
+func (h *Header) unreserve(c Entry) error { return h.clearSpace(&c) }
 
-		offset, hasSpace = h.used.NextClear(offset)
-		if !hasSpace {
-			break
-		}
+// commit updates the entry at x,z to the given entry, which must have been reserved using [Header.reserve],
+// and frees the space used by the previous entry.
+// If the given entry is empty, this removes the entry.
+func (h *Header) commit(x, z uint8, c Entry) error {
+	old := h.Get(x, z)
+	if err := h.freeSpace(old); err != nil {
+		return err
+	}
 
-		next, hasSpace = h.used.NextSet(offset)
-		if hasSpace && next-offset >= size {
-			return offset, true
-		}
+	*old = c
+	return nil
+}
 
-		offset = next
+// hold holds the space freed by [Header.Set] and [Header.Remove] until [Header.release] is called.
+// This is used to keep the sections used by the entries captured by a [Snapshot] from being reused.
+func (h *Header) hold() { h.holding = true }
+
+// release frees the space held since [Header.hold] was called.
+func (h *Header) release() (err error) {
+	h.holding = false
+	for i := range h.held {
+		if err = h.clearSpace(&h.held[i]); err != nil {
+			break
+		}
 	}
+	h.held = nil
+	return
+}
 
-	return 0, false
+// FindSpace finds the next free space large enough to store `size` sections
+// using the strategy set by [Header.SetStrategy].
+func (h *Header) FindSpace(size uint) (offset uint, found bool) {
+	switch h.strategy {
+	case AllocBestFit:
+		return h.bestFit(size)
+	case AllocNextFit:
+		return h.nextFit(size)
+	case AllocSegregated:
+		return h.segregatedFit(size)
+	default:
+		// ignore the first two section since they are used for the header
+		return h.firstFit(size, 2, 0)
+	}
 }
 
 // Free frees the header and puts it into the pool.
@@ -171,16 +236,22 @@ func (h *Header) load(size, timestamps *[Entries]uint32, fileSections uint32) (e
 	if fileSections == 0 {
 		fileSections = MaxFileSections
 	}
+	h.free = nil
 
 	for i := 0; i < Entries; i++ {
 
 		size, offset := size[i]&0xFF, size[i]>>8
 
+		// the first two sections are used by the header
+		if size != 0 && offset < 2 {
+			return errors.CauseStr(ErrCorrupted, "entry overlaps with the header")
+		}
+
 		for p := uint32(0); p < size; p++ {
 			pos := offset + p
 
 			// check if the position is within the file
-			if pos > fileSections {
+			if pos >= fileSections {
 				return errors.CauseStr(ErrCorrupted, "entry is outside the file")
 			}
 
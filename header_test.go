@@ -1,6 +1,8 @@
 package anvil
 
 import (
+	"bytes"
+	"encoding/binary"
 	"testing"
 
 	"github.com/bits-and-blooms/bitset"
@@ -78,3 +80,54 @@ func (*headerTest) TestGet(is is.Is) {
 	is.Panic(func() { header.Get(32, 0) }, "header did not panic for invalid coords")
 	is.Panic(func() { header.Get(0, 32) }, "header did not panic for invalid coords")
 }
+
+func FuzzReadHeader(f *testing.F) {
+	f.Add(fuzzRegion(f), uint(0))
+	f.Add(make([]byte, SectionSize*2), uint(2))
+
+	f.Fuzz(func(t *testing.T, data []byte, maxSection uint) {
+		h, err := ReadHeader(bytes.NewReader(data), maxSection%(MaxFileSections+1))
+		if err == nil {
+			checkHeader(t, h)
+		}
+	})
+}
+
+func FuzzLoadHeader(f *testing.F) {
+	f.Add(fuzzRegion(f)[:SectionSize*2], uint(0))
+
+	f.Fuzz(func(t *testing.T, data []byte, fileSections uint) {
+		var size, timestamps [Entries]uint32
+		for i := 0; i < Entries && (i+1)*4 <= len(data); i++ {
+			size[i] = binary.BigEndian.Uint32(data[i*4:])
+		}
+		for i := 0; i < Entries && (Entries+i+1)*4 <= len(data); i++ {
+			timestamps[i] = binary.BigEndian.Uint32(data[(Entries+i)*4:])
+		}
+
+		h, err := LoadHeader(&size, &timestamps, fileSections%(MaxFileSections+1))
+		if err == nil {
+			checkHeader(t, h)
+		}
+	})
+}
+
+// checkHeader checks that the entries in a loaded header do not overlap with the header or each other.
+func checkHeader(t *testing.T, h *Header) {
+	used := bitset.New(MaxFileSections)
+	for i := 0; i < Entries; i++ {
+		e := h.Get(uint8(i&31), uint8(i>>5))
+		if e.size == 0 {
+			continue
+		}
+		if e.offset < 2 {
+			t.Fatalf("entry %d overlaps with the header", i)
+		}
+		for p := e.offset; p < e.offset+uint32(e.size); p++ {
+			if used.Test(uint(p)) {
+				t.Fatalf("entry %d overlaps with another entry", i)
+			}
+			used.Set(uint(p))
+		}
+	}
+}
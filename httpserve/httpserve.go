@@ -0,0 +1,281 @@
+// Package httpserve serves the entries in an [anvil.Anvil] over HTTP.
+//
+// The handler serves the following routes:
+//
+//	GET    /chunk/{x}/{z}       the decompressed data of the chunk
+//	GET    /chunk/{x}/{z}?raw   the compressed data of the chunk
+//	GET    /region/{x}/{z}      the header of the region as JSON
+//	PUT    /chunk/{x}/{z}       writes the request body to the chunk
+//	PUT    /chunk/{x}/{z}?raw   same as above but the body is already compressed
+//	DELETE /chunk/{x}/{z}       removes the chunk
+//
+// PUT and DELETE are only served if [Options.AllowWrite] is set.
+// Chunk responses set Last-Modified and ETag using the chunk's timestamp
+// and support conditional requests.
+// The compression method of raw data is sent and received in the
+// X-Anvil-Compression header.
+package httpserve
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/yehan2002/errors"
+)
+
+// CompressionHeader the header used for the compression method of raw data.
+const CompressionHeader = "X-Anvil-Compression"
+
+// DefaultMaxBodySize the default value for [Options.MaxBodySize].
+const DefaultMaxBodySize = 16 << 20
+
+// Options options for [New].
+type Options struct {
+	// AllowWrite if PUT and DELETE requests should be served.
+	// Writes always fail if the world was opened in read-only mode.
+	AllowWrite bool
+	// MaxBodySize the maximum size of the body of a PUT request.
+	// Default: [DefaultMaxBodySize]
+	MaxBodySize int64
+}
+
+type handler struct {
+	world   *anvil.Anvil
+	options Options
+	mux     *http.ServeMux
+}
+
+// New returns a handler that serves the given world.
+func New(world *anvil.Anvil, opt ...Options) http.Handler {
+	h := &handler{world: world, mux: http.NewServeMux()}
+	if len(opt) == 1 {
+		h.options = opt[0]
+	}
+
+	if h.options.MaxBodySize <= 0 {
+		h.options.MaxBodySize = DefaultMaxBodySize
+	}
+
+	h.mux.HandleFunc("GET /chunk/{x}/{z}", h.getChunk)
+	h.mux.HandleFunc("GET /region/{x}/{z}", h.getRegion)
+	if h.options.AllowWrite {
+		h.mux.HandleFunc("PUT /chunk/{x}/{z}", h.putChunk)
+		h.mux.HandleFunc("DELETE /chunk/{x}/{z}", h.deleteChunk)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) { h.mux.ServeHTTP(w, r) }
+
+func (h *handler) getChunk(w http.ResponseWriter, r *http.Request) {
+	x, z, ok := position(w, r)
+	if !ok || !h.exists(w, x>>5, z>>5) {
+		return
+	}
+
+	entry, exists, err := h.world.Info(x, z)
+	if err != nil {
+		writeError(w, err)
+		return
+	} else if !exists {
+		writeError(w, anvil.ErrNotExist)
+		return
+	}
+
+	// conditional requests are checked before the entry is read
+	if notModified(r, &entry) {
+		w.Header().Set("ETag", etag(&entry))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// the entry may have been written since Info was called, the headers must match the data
+	var data []byte
+	if r.URL.Query().Has("raw") {
+		var method anvil.CompressMethod
+		if data, method, entry, err = h.world.ReadRawEntry(x, z); err == nil {
+			w.Header().Set(CompressionHeader, method.String())
+		}
+	} else {
+		data, entry, err = h.world.ReadEntry(x, z)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", etag(&entry))
+	http.ServeContent(w, r, "", entry.Modified(), bytes.NewReader(data))
+}
+
+// regionEntry an entry in the JSON response for a region.
+type regionEntry struct {
+	X        int32     `json:"x"`
+	Z        int32     `json:"z"`
+	Offset   int64     `json:"offset"`
+	Sections int64     `json:"sections"`
+	Modified time.Time `json:"modified"`
+}
+
+func (h *handler) getRegion(w http.ResponseWriter, r *http.Request) {
+	rgX, rgZ, ok := position(w, r)
+	if !ok || !h.exists(w, rgX, rgZ) {
+		return
+	}
+
+	f, err := h.world.File(rgX, rgZ)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer f.Close()
+
+	entries := []regionEntry{}
+	for x := uint8(0); x < 32; x++ {
+		for z := uint8(0); z < 32; z++ {
+			if entry, exists := f.Info(x, z); exists {
+				entries = append(entries, regionEntry{
+					X: rgX<<5 | int32(x), Z: rgZ<<5 | int32(z),
+					Offset: entry.Offset(), Sections: entry.CompressedSize(), Modified: entry.Modified(),
+				})
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		X       int32         `json:"x"`
+		Z       int32         `json:"z"`
+		Entries []regionEntry `json:"entries"`
+	}{X: rgX, Z: rgZ, Entries: entries})
+}
+
+func (h *handler) putChunk(w http.ResponseWriter, r *http.Request) {
+	x, z, ok := position(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.options.MaxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if len(data) == 0 {
+		http.Error(w, "empty body", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Has("raw") {
+		method, ok := parseMethod(r.Header.Get(CompressionHeader))
+		if !ok {
+			http.Error(w, "invalid "+CompressionHeader+" header", http.StatusBadRequest)
+			return
+		}
+		err = h.world.WriteRaw(x, z, method, data)
+	} else {
+		err = h.world.Write(x, z, data)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) deleteChunk(w http.ResponseWriter, r *http.Request) {
+	x, z, ok := position(w, r)
+	if !ok || !h.exists(w, x>>5, z>>5) {
+		return
+	}
+
+	if err := h.world.Remove(x, z); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// exists checks if the region exists and writes an error response if it does not.
+func (h *handler) exists(w http.ResponseWriter, rgX, rgZ int32) bool {
+	exists, err := h.world.RegionExists(rgX, rgZ)
+	if err != nil {
+		writeError(w, err)
+		return false
+	} else if !exists {
+		writeError(w, anvil.ErrNotExist)
+		return false
+	}
+	return true
+}
+
+// position parses the x and z path values.
+func position(w http.ResponseWriter, r *http.Request) (x, z int32, ok bool) {
+	var values [2]int32
+	for i, name := range [2]string{"x", "z"} {
+		v, err := strconv.ParseInt(r.PathValue(name), 10, 32)
+		if err != nil {
+			http.Error(w, "invalid "+name+" value", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		values[i] = int32(v)
+	}
+	return values[0], values[1], true
+}
+
+// etag returns a weak ETag for the given entry.
+// The timestamp, offset and size of an entry almost always change when the entry is written.
+func etag(e *anvil.Entry) string {
+	return fmt.Sprintf(`W/"%x-%x-%x"`, e.Modified().Unix(), e.Offset(), e.CompressedSize())
+}
+
+// notModified checks the If-None-Match and If-Modified-Since headers of the request
+// against the given entry the same way as [http.ServeContent].
+func notModified(r *http.Request, e *anvil.Entry) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		tag := strings.TrimPrefix(etag(e), "W/")
+		for _, t := range strings.Split(match, ",") {
+			if t = strings.TrimSpace(t); t == "*" || strings.TrimPrefix(t, "W/") == tag {
+				return true
+			}
+		}
+		return false
+	}
+
+	// entries without a timestamp do not have a modification time
+	if e.Modified().Unix() == 0 {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !e.Modified().After(since)
+}
+
+func parseMethod(name string) (anvil.CompressMethod, bool) {
+	m, err := anvil.ParseCompressMethod(name)
+	return m, err == nil
+}
+
+// writeError writes an error response with a status code for the given error.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, anvil.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, anvil.ErrReadOnly):
+		status = http.StatusMethodNotAllowed
+	case errors.Is(err, anvil.ErrExternal):
+		status = http.StatusNotImplemented
+	case errors.Is(err, anvil.ErrClosed):
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), status)
+}
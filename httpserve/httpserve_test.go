@@ -0,0 +1,165 @@
+package httpserve
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type serveTest struct{}
+
+func TestServe(t *testing.T) { is.SuiteP(t, &serveTest{}) }
+
+func (*serveTest) world(is is.Is, opt ...anvil.Settings) (*anvil.Anvil, afero.Fs) {
+	fs := afero.NewMemMapFs()
+	world, err := anvil.OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+	err = world.Write(1, 2, []byte("chunk"))
+	is(err == nil, "unexpected error: %s", err)
+
+	if len(opt) == 1 {
+		world, err = anvil.OpenFs(fs, opt...)
+		is(err == nil, "unexpected error: %s", err)
+	}
+	return world, fs
+}
+
+func do(h http.Handler, method, target string, body []byte, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, bytes.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func (s *serveTest) TestGet(is is.Is) {
+	world, fs := s.world(is)
+	h := New(world)
+
+	w := do(h, "GET", "/chunk/1/2", nil)
+	is(w.Code == http.StatusOK, "incorrect status: %d", w.Code)
+	is(w.Body.String() == "chunk", "incorrect body: %q", w.Body.String())
+
+	etag, modified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	is(etag != "" && modified != "", "missing cache headers")
+
+	w = do(h, "GET", "/chunk/1/2", nil, "If-None-Match", etag)
+	is(w.Code == http.StatusNotModified, "incorrect status: %d", w.Code)
+	w = do(h, "GET", "/chunk/1/2", nil, "If-Modified-Since", modified)
+	is(w.Code == http.StatusNotModified, "incorrect status: %d", w.Code)
+
+	w = do(h, "GET", "/chunk/1/2?raw", nil)
+	is(w.Code == http.StatusOK, "incorrect status: %d", w.Code)
+	is(w.Header().Get(CompressionHeader) == anvil.DefaultCompression.String(), "incorrect compression header")
+	raw, _, err := world.ReadRaw(1, 2)
+	is(err == nil, "unexpected error: %s", err)
+	is(bytes.Equal(w.Body.Bytes(), raw), "incorrect raw data")
+
+	w = do(h, "GET", "/chunk/3/2", nil)
+	is(w.Code == http.StatusNotFound, "incorrect status: %d", w.Code)
+	w = do(h, "GET", "/chunk/100/2", nil)
+	is(w.Code == http.StatusNotFound, "incorrect status: %d", w.Code)
+	w = do(h, "GET", "/chunk/a/2", nil)
+	is(w.Code == http.StatusBadRequest, "incorrect status: %d", w.Code)
+
+	exists, err := afero.Exists(fs, "r.3.0.mca")
+	is(err == nil && !exists, "region was created by GET")
+
+	w = do(h, "PUT", "/chunk/1/2", []byte("data"))
+	is(w.Code == http.StatusMethodNotAllowed, "incorrect status: %d", w.Code)
+}
+
+// readObserver counts the entries that were read.
+type readObserver struct {
+	anvil.NopObserver
+	reads atomic.Int32
+}
+
+func (o *readObserver) Read(anvil.ReadEvent) { o.reads.Add(1) }
+
+func (s *serveTest) TestConditional(is is.Is) {
+	observer := &readObserver{}
+	world, _ := s.world(is, anvil.Settings{Observer: observer})
+	h := New(world)
+
+	w := do(h, "GET", "/chunk/1/2?raw", nil)
+	is(w.Code == http.StatusOK && observer.reads.Load() == 1, "incorrect status: %d", w.Code)
+	etag, modified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+
+	// the entry is not read if it was not modified
+	w = do(h, "GET", "/chunk/1/2", nil, "If-None-Match", `"other", `+etag)
+	is(w.Code == http.StatusNotModified && w.Header().Get("ETag") == etag, "incorrect status: %d", w.Code)
+	w = do(h, "GET", "/chunk/1/2?raw", nil, "If-Modified-Since", modified)
+	is(w.Code == http.StatusNotModified, "incorrect status: %d", w.Code)
+	is(observer.reads.Load() == 1, "entry was read for a conditional request")
+
+	// If-Modified-Since is ignored if If-None-Match is set
+	w = do(h, "GET", "/chunk/1/2", nil, "If-None-Match", `"other"`, "If-Modified-Since", modified)
+	is(w.Code == http.StatusOK && w.Body.String() == "chunk", "incorrect status: %d", w.Code)
+	is(observer.reads.Load() == 2, "entry was not read")
+}
+
+func (s *serveTest) TestRegion(is is.Is) {
+	world, _ := s.world(is)
+	h := New(world)
+
+	w := do(h, "GET", "/region/0/0", nil)
+	is(w.Code == http.StatusOK, "incorrect status: %d", w.Code)
+
+	var region struct {
+		Entries []regionEntry `json:"entries"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&region)
+	is(err == nil, "unexpected error: %s", err)
+	is(len(region.Entries) == 1 && region.Entries[0].X == 1 && region.Entries[0].Z == 2, "incorrect entries: %v", region.Entries)
+
+	w = do(h, "GET", "/region/1/0", nil)
+	is(w.Code == http.StatusNotFound, "incorrect status: %d", w.Code)
+}
+
+func (s *serveTest) TestWrite(is is.Is) {
+	world, _ := s.world(is)
+	h := New(world, Options{AllowWrite: true, MaxBodySize: 64})
+
+	w := do(h, "PUT", "/chunk/40/2", []byte("data"))
+	is(w.Code == http.StatusNoContent, "incorrect status: %d", w.Code)
+	data, err := world.Read(40, 2)
+	is(err == nil && string(data) == "data", "chunk was not written")
+
+	raw, method, err := world.ReadRaw(40, 2)
+	is(err == nil, "unexpected error: %s", err)
+	w = do(h, "PUT", "/chunk/0/0?raw", raw, CompressionHeader, method.String())
+	is(w.Code == http.StatusNoContent, "incorrect status: %d", w.Code)
+	data, err = world.Read(0, 0)
+	is(err == nil && string(data) == "data", "raw chunk was not written")
+
+	w = do(h, "PUT", "/chunk/0/0?raw", raw, CompressionHeader, "lz4")
+	is(w.Code == http.StatusBadRequest, "incorrect status: %d", w.Code)
+	w = do(h, "PUT", "/chunk/0/0", bytes.Repeat([]byte{1}, 65))
+	is(w.Code == http.StatusRequestEntityTooLarge, "incorrect status: %d", w.Code)
+
+	w = do(h, "DELETE", "/chunk/40/2", nil)
+	is(w.Code == http.StatusNoContent, "incorrect status: %d", w.Code)
+	_, err = world.Read(40, 2)
+	is.Err(err, anvil.ErrNotExist, "chunk was not removed")
+}
+
+func (s *serveTest) TestReadOnly(is is.Is) {
+	world, _ := s.world(is, anvil.Settings{ReadOnly: true})
+	h := New(world, Options{AllowWrite: true})
+
+	w := do(h, "PUT", "/chunk/1/2", []byte("data"))
+	is(w.Code == http.StatusMethodNotAllowed, "incorrect status: %d", w.Code)
+	body, _ := io.ReadAll(w.Body)
+	is(bytes.Contains(body, []byte("read-only")), "incorrect error: %s", body)
+}
@@ -0,0 +1,253 @@
+// Package chunk parses the parts of chunk data shared by the tools built on top of anvil.
+// This supports the chunk format used since 1.18 and the older format that stores
+// everything in the `Level` compound.
+package chunk
+
+import (
+	"math/bits"
+
+	"github.com/FireworkMC/anvil/nbt"
+)
+
+const (
+	// minSection the lowest section y coordinate supported by Minecraft.
+	minSection = -2032 >> 4
+	// maxSection the highest section y coordinate supported by Minecraft.
+	maxSection = 2031 >> 4
+)
+
+// Air blocks that are treated as empty space.
+var Air = map[string]bool{"minecraft:air": true, "minecraft:cave_air": true, "minecraft:void_air": true}
+
+// Chunk a parsed chunk.
+type Chunk struct {
+	// MinY the lowest y coordinate in the chunk.
+	MinY int
+	// Heightmap the y coordinate above the highest non-air block for each column
+	// relative to MinY. This is nil if the chunk does not have a heightmap.
+	Heightmap []int
+	Sections  map[int]*Section
+
+	// BlockEntities the block entities in the chunk.
+	BlockEntities []nbt.Compound
+	// Entities the entities stored in the chunk.
+	// Since 1.17, entities are stored in separate files.
+	Entities []nbt.Compound
+}
+
+// Section a 16x16x16 part of a chunk.
+type Section struct {
+	Blocks Palette
+	Biomes Palette
+}
+
+// Palette a palette and the packed indexes into it.
+type Palette struct {
+	// Names the name of each entry in the palette.
+	Names []string
+	// States the block states for each entry in a block palette.
+	// This is nil for biome palettes.
+	States []nbt.Compound
+
+	data []int64
+	size int
+}
+
+// Index returns the index into the palette for the value at idx.
+func (p *Palette) Index(idx int) int {
+	if len(p.Names) <= 1 {
+		return 0
+	}
+
+	bits := bits.Len(uint(len(p.Names) - 1))
+	if p.size == 4096 {
+		// block states use at least 4 bits per entry
+		bits = max(bits, 4)
+	}
+
+	return unpack(p.data, bits, p.size, idx)
+}
+
+// Get returns the name of the value at idx.
+func (p *Palette) Get(idx int) string {
+	if v := p.Index(idx); v < len(p.Names) {
+		return p.Names[v]
+	}
+	return ""
+}
+
+// Parse parses the given chunk.
+func Parse(root nbt.Compound) *Chunk {
+	if level, ok := root.Compound("Level"); ok {
+		root = level
+	}
+
+	c := &Chunk{Sections: map[int]*Section{}}
+	if yPos, ok := root.Int("yPos"); ok && yPos >= minSection && yPos <= maxSection {
+		c.MinY = int(yPos) * 16
+	}
+
+	c.BlockEntities = compounds(root, "block_entities", "TileEntities")
+	c.Entities = compounds(root, "Entities")
+
+	for _, s := range compounds(root, "sections", "Sections") {
+		// sections outside the supported range are ignored so that corrupted chunks
+		// cannot make Top scan an arbitrarily large range.
+		y, ok := s.Int("Y")
+		if !ok || y < minSection || y > maxSection {
+			continue
+		}
+
+		sec := &Section{}
+		if states, ok := s.Compound("block_states"); ok {
+			sec.Blocks = parsePalette(states, 4096)
+		} else if list, ok := s.List("Palette"); ok {
+			sec.Blocks = Palette{size: 4096}
+			sec.Blocks.data, _ = s.Longs("BlockStates")
+			sec.Blocks.States = list.Compounds()
+			sec.Blocks.Names = blockNames(sec.Blocks.States)
+		}
+
+		if biomes, ok := s.Compound("biomes"); ok {
+			sec.Biomes = parsePalette(biomes, 64)
+		}
+
+		if len(sec.Blocks.Names) > 0 {
+			c.Sections[int(y)] = sec
+		}
+	}
+
+	if heightmaps, ok := root.Compound("Heightmaps"); ok {
+		data, ok := heightmaps.Longs("WORLD_SURFACE")
+		if !ok {
+			data, ok = heightmaps.Longs("MOTION_BLOCKING")
+		}
+		// heightmaps with an invalid size are ignored
+		if bits := packedBits(len(data), 256); ok && bits != 0 {
+			c.Heightmap = make([]int, 256)
+			for i := range c.Heightmap {
+				c.Heightmap[i] = unpack(data, bits, 256, i)
+			}
+		}
+	}
+
+	return c
+}
+
+// compounds returns the first list of compounds with one of the given names.
+func compounds(c nbt.Compound, names ...string) []nbt.Compound {
+	for _, name := range names {
+		if list, ok := c.List(name); ok {
+			return list.Compounds()
+		}
+	}
+	return nil
+}
+
+func parsePalette(c nbt.Compound, size int) Palette {
+	p := Palette{size: size}
+	list, _ := c.List("palette")
+	if list.Type == nbt.TagString {
+		for _, v := range list.Values {
+			p.Names = append(p.Names, v.(string))
+		}
+	} else {
+		p.States = list.Compounds()
+		p.Names = blockNames(p.States)
+	}
+	p.data, _ = c.Longs("data")
+	return p
+}
+
+func blockNames(states []nbt.Compound) (names []string) {
+	for _, c := range states {
+		name, _ := c.String("Name")
+		names = append(names, name)
+	}
+	return
+}
+
+// Block returns the block and biome at the given position relative to the chunk.
+func (c *Chunk) Block(x, y, z int) (block, biome string) {
+	sec := c.Sections[y>>4]
+	if sec == nil {
+		return "", ""
+	}
+
+	block = sec.Blocks.Get(BlockIndex(x, y, z))
+	biome = sec.Biomes.Get((y&15)>>2<<4 | z>>2<<2 | x>>2)
+	return
+}
+
+// BlockIndex returns the index of the block at x,y,z in a section.
+func BlockIndex(x, y, z int) int { return (y&15)<<8 | z<<4 | x }
+
+// Top returns the highest non-air block in the given column.
+// If the column is empty, this returns an empty string.
+func (c *Chunk) Top(x, z int) (block, biome string, y int) {
+	maxY := c.maxY()
+	if c.Heightmap != nil {
+		// the heightmap stores the y position above the highest block relative to the bottom of the world
+		maxY = min(c.MinY+c.Heightmap[z<<4|x]-1, maxY)
+	}
+
+	for y = maxY; y >= c.MinY; y-- {
+		if block, biome = c.Block(x, y, z); block != "" && !Air[block] {
+			return block, biome, y
+		}
+	}
+	return "", "", c.MinY
+}
+
+// maxY returns the highest y coordinate in the chunk.
+func (c *Chunk) maxY() int {
+	maxSection := c.MinY >> 4
+	for y := range c.Sections {
+		maxSection = max(maxSection, y)
+	}
+	return maxSection<<4 | 15
+}
+
+// packedBits returns the number of bits used for each value if `count` values
+// are packed into `longs` longs.
+// This returns 0 if the number of bits is not between 1 and 32.
+func packedBits(longs, count int) int {
+	// since 1.16 values are not split across longs
+	for bits := 1; bits <= 32; bits++ {
+		perLong := 64 / bits
+		if (count+perLong-1)/perLong == longs {
+			return bits
+		}
+	}
+	// older versions split values across longs
+	if bits := longs * 64 / count; bits >= 1 && bits <= 32 {
+		return bits
+	}
+	return 0
+}
+
+// unpack returns the value at `idx` from the given packed array.
+func unpack(data []int64, bits, count, idx int) int {
+	if bits < 1 || bits > 32 || len(data) == 0 {
+		return 0
+	}
+	mask := uint64(1)<<bits - 1
+	perLong := 64 / bits
+
+	if (count+perLong-1)/perLong == len(data) {
+		i := idx / perLong
+		return int(uint64(data[i]) >> (uint(idx%perLong) * uint(bits)) & mask)
+	}
+
+	// values are split across longs
+	bit := idx * bits
+	i, offset := bit/64, uint(bit%64)
+	if i >= len(data) {
+		return 0
+	}
+	v := uint64(data[i]) >> offset
+	if offset+uint(bits) > 64 && i+1 < len(data) {
+		v |= uint64(data[i+1]) << (64 - offset)
+	}
+	return int(v & mask)
+}
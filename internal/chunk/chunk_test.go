@@ -0,0 +1,54 @@
+package chunk
+
+import (
+	"testing"
+
+	"github.com/FireworkMC/anvil/nbt"
+	"github.com/yehan2002/is/v2"
+)
+
+type chunkTest struct{}
+
+func TestChunk(t *testing.T) { is.SuiteP(t, &chunkTest{}) }
+
+// stone returns a section containing only stone.
+func stone(y int8) nbt.Compound {
+	return nbt.Compound{
+		{Name: "Y", Value: y},
+		{Name: "block_states", Value: nbt.Compound{
+			{Name: "palette", Value: nbt.List{Type: nbt.TagCompound, Values: []any{nbt.Compound{{Name: "Name", Value: "minecraft:stone"}}}}},
+		}},
+	}
+}
+
+func (*chunkTest) TestInvalidHeightmap(is is.Is) {
+	for _, longs := range []int{1, 257, 300, 4096} {
+		root := nbt.Compound{
+			{Name: "Heightmaps", Value: nbt.Compound{{Name: "WORLD_SURFACE", Value: make([]int64, longs)}}},
+			{Name: "sections", Value: nbt.List{Type: nbt.TagCompound, Values: []any{stone(0)}}},
+		}
+
+		c := Parse(root)
+		is(c.Heightmap == nil, "invalid heightmap with %d longs was not ignored", longs)
+
+		block, _, y := c.Top(0, 0)
+		is(block == "minecraft:stone" && y == 15, "incorrect top block: %s at %d", block, y)
+	}
+}
+
+func (*chunkTest) TestInvalidSections(is is.Is) {
+	root := nbt.Compound{
+		{Name: "yPos", Value: int32(-1 << 30)},
+		{Name: "sections", Value: nbt.List{Type: nbt.TagCompound, Values: []any{
+			stone(0),
+			nbt.Compound{{Name: "Y", Value: int32(1 << 30)}, {Name: "block_states", Value: stone(0)[1].Value}},
+		}}},
+	}
+
+	c := Parse(root)
+	is(c.MinY == 0, "invalid yPos was not ignored: %d", c.MinY)
+	is(len(c.Sections) == 1, "invalid section was not ignored")
+
+	block, _, y := c.Top(0, 0)
+	is(block == "minecraft:stone" && y == 15, "incorrect top block: %s at %d", block, y)
+}
@@ -0,0 +1,63 @@
+package anvil
+
+import (
+	"fmt"
+	"io"
+)
+
+// LimitError returned if an entry exceeds [Settings.MaxDecompressedSize] or [Settings.MaxExternalSize].
+// [errors.Is] reports that a LimitError is [ErrTooLarge].
+type LimitError struct {
+	Chunk ChunkPos
+	// External if the external file exceeded [Settings.MaxExternalSize].
+	// Otherwise the decompressed data exceeded [Settings.MaxDecompressedSize].
+	External bool
+	// Limit the limit that was exceeded in bytes.
+	Limit int64
+}
+
+func (l *LimitError) Error() string {
+	if l.External {
+		return fmt.Sprintf("anvil: (%d,%d): external file is larger than %d bytes", l.Chunk.X, l.Chunk.Z, l.Limit)
+	}
+	return fmt.Sprintf("anvil: (%d,%d): decompressed data is larger than %d bytes", l.Chunk.X, l.Chunk.Z, l.Limit)
+}
+
+// Is returns true if target is [ErrTooLarge].
+func (l *LimitError) Is(target error) bool { return target == ErrTooLarge }
+
+// limitReader returns `err` if more than `n` bytes are read from the underlying reader.
+// Unlike [io.LimitedReader], reading exactly `n` bytes is not an error.
+type limitReader struct {
+	io.ReadCloser
+	n   int64
+	err error
+}
+
+func (l *limitReader) Read(p []byte) (n int, err error) {
+	if l.n < 0 {
+		return 0, l.err
+	}
+
+	// read one byte more than the limit to detect if the limit was exceeded
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	if n, err = l.ReadCloser.Read(p); int64(n) <= l.n {
+		l.n -= int64(n)
+		return n, err
+	}
+
+	n, l.n = int(l.n), -1
+	return n, l.err
+}
+
+// limit returns a reader that fails with a [LimitError] if more than [Settings.MaxDecompressedSize]
+// bytes of decompressed data are read from `src`. `src` is returned as is if there is no limit.
+func (a *file) limit(src io.ReadCloser, chunk ChunkPos) io.ReadCloser {
+	if limit := a.settings.MaxDecompressedSize; limit > 0 {
+		return &limitReader{ReadCloser: src, n: limit, err: &LimitError{Chunk: chunk, Limit: limit}}
+	}
+	return src
+}
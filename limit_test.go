@@ -0,0 +1,174 @@
+package anvil
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type limitTest struct{}
+
+func TestLimit(t *testing.T) { is.SuiteP(t, &limitTest{}) }
+
+func (*limitTest) TestDecompressed(is is.Is) {
+	fs := afero.NewMemMapFs()
+	world, err := OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+
+	// 4 MiB of zeros compress to a few KiB
+	bomb := make([]byte, 4<<20)
+	is(world.Write(1, 2, bomb) == nil, "unexpected error")
+	is(world.Write(1, 3, bomb[:1024]) == nil, "unexpected error")
+
+	world, err = OpenFs(fs, Settings{MaxDecompressedSize: 1024})
+	is(err == nil, "unexpected error: %s", err)
+
+	_, err = world.Read(1, 2)
+	var limitErr *LimitError
+	is(errors.As(err, &limitErr), "incorrect error returned: %s", err)
+	is(errors.Is(err, ErrTooLarge), "LimitError is not ErrTooLarge")
+	is(*limitErr == LimitError{Chunk: ChunkPos{1, 2}, Limit: 1024}, "incorrect error: %#v", limitErr)
+
+	err = world.ReadFn(1, 2, func(r io.Reader) error { _, err := io.Copy(io.Discard, r); return err })
+	is(errors.Is(err, ErrTooLarge), "incorrect error returned: %s", err)
+
+	// reading exactly the limit is allowed
+	data, err := world.Read(1, 3)
+	is(err == nil && len(data) == 1024, "unexpected error: %s", err)
+
+	// raw reads are not limited
+	_, _, err = world.ReadRaw(1, 2)
+	is(err == nil, "unexpected error: %s", err)
+
+	// recompressing decompresses the data, so it is limited
+	err = Recompress(context.Background(), world, CompressionNone, 1)
+	var walkErrs WalkErrors
+	is(errors.As(err, &walkErrs) && len(walkErrs) == 1 && walkErrs[0].Pos == ChunkPos{1, 2}, "incorrect error returned: %s", err)
+	is(errors.Is(err, ErrTooLarge), "incorrect error returned: %s", err)
+	data, err = world.Read(1, 3)
+	is(err == nil && len(data) == 1024, "unexpected error: %s", err)
+
+	world, err = OpenFs(fs, Settings{MaxDecompressedSize: -1})
+	is(err == nil, "unexpected error: %s", err)
+	data, err = world.Read(1, 2)
+	is(err == nil && len(data) == len(bomb), "unexpected error: %s", err)
+}
+
+func (*limitTest) TestExternal(is is.Is) {
+	fs := afero.NewMemMapFs()
+	world, err := OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+
+	f, err := world.File(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+	is(f.CompressionMethod(CompressionNone) == nil, "unexpected error")
+	is(f.Write(4, 5, make([]byte, 2<<20)) == nil, "unexpected error")
+	is(f.Close() == nil, "unexpected error")
+
+	world, err = OpenFs(fs, Settings{MaxExternalSize: 1 << 20})
+	is(err == nil, "unexpected error: %s", err)
+
+	_, err = world.Read(4, 5)
+	var limitErr *LimitError
+	is(errors.As(err, &limitErr), "incorrect error returned: %s", err)
+	is(*limitErr == LimitError{Chunk: ChunkPos{4, 5}, External: true, Limit: 1 << 20}, "incorrect error: %#v", limitErr)
+
+	_, _, err = world.ReadRaw(4, 5)
+	is(errors.Is(err, ErrTooLarge), "incorrect error returned: %s", err)
+
+	// entries that could not be read back are not written
+	f, err = world.File(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+	defer f.Close()
+	is(f.CompressionMethod(CompressionNone) == nil, "unexpected error")
+	err = f.Write(4, 6, make([]byte, 2<<20))
+	is(errors.As(err, &limitErr), "incorrect error returned: %s", err)
+	is(*limitErr == LimitError{Chunk: ChunkPos{4, 6}, External: true, Limit: 1 << 20}, "incorrect error: %#v", limitErr)
+	_, exists := f.Info(4, 6)
+	is(!exists, "entry was written")
+	_, err = fs.Stat("c.4.6.mcc")
+	is(errors.Is(err, os.ErrNotExist), "external file was created: %s", err)
+
+	// data that is stored externally but fits the limit is written
+	is(f.Write(4, 6, make([]byte, 1<<20)) == nil, "unexpected error")
+	data, err := world.Read(4, 6)
+	is(err == nil && len(data) == 1<<20, "unexpected error: %s", err)
+}
+
+func (*limitTest) TestCorrupted(is is.Is) {
+	data := fuzzRegion(is.T())
+
+	// set the length of the first entry to more than the sections used by it
+	offset := int64(binary.BigEndian.Uint32(data[:4])>>8) * SectionSize
+	binary.BigEndian.PutUint32(data[offset:], SectionSize*2)
+
+	f, err := ReadAnvil(0, 0, bytes.NewReader(data), int64(len(data)), nil, Settings{ReadOnly: true})
+	is(err == nil, "unexpected error: %s", err)
+	_, err = f.Read(0, 0)
+	is(errors.Is(err, ErrCorrupted), "incorrect error returned: %s", err)
+
+	binary.BigEndian.PutUint32(data[offset:], 0)
+	_, err = f.Read(0, 0)
+	is(errors.Is(err, ErrCorrupted), "incorrect error returned: %s", err)
+
+	// entries must not overlap the header
+	binary.BigEndian.PutUint32(data[:4], 1<<8|1)
+	_, err = ReadAnvil(0, 0, bytes.NewReader(data), int64(len(data)), nil, Settings{ReadOnly: true})
+	is(errors.Is(err, ErrCorrupted), "incorrect error returned: %s", err)
+}
+
+// fuzzRegion returns an anvil file that contains a few entries.
+func fuzzRegion(tb testing.TB) []byte {
+	fs := afero.NewMemMapFs()
+	world, err := OpenFs(fs)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	for i, size := range []int{1, 100, 5000, 20000} {
+		if err = world.Write(int32(i), int32(i), bytes.Repeat([]byte(fmt.Sprint(i)), size)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err = world.Write(31, 31, make([]byte, 1<<20)); err != nil {
+		tb.Fatal(err)
+	}
+
+	data, err := afero.ReadFile(fs, "r.0.0.mca")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+func FuzzRead(f *testing.F) {
+	f.Add(fuzzRegion(f))
+
+	const limit = 64 << 10
+	f.Fuzz(func(t *testing.T, data []byte) {
+		data = data[:len(data)&^sectionSizeMask]
+
+		file, err := ReadAnvil(0, 0, bytes.NewReader(data), int64(len(data)), nil, Settings{ReadOnly: true, MaxDecompressedSize: limit})
+		if err != nil {
+			return
+		}
+		defer file.Close()
+
+		for x := uint8(0); x < 32; x++ {
+			for z := uint8(0); z < 32; z++ {
+				if buf, err := file.Read(x, z); err == nil && len(buf) > limit {
+					t.Fatalf("read %d bytes from (%d,%d) which is larger than the limit", len(buf), x, z)
+				}
+				file.(RawReadWriter).ReadRaw(x, z)
+			}
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package anvil
+
+import (
+	"fmt"
+
+	"github.com/yehan2002/errors"
+)
+
+// MergeConflict information about an entry that is about to be copied by [Merge].
+type MergeConflict struct {
+	// X, Z the position of the entry in the destination.
+	X, Z int32
+
+	// Source the index of the source the entry is being copied from.
+	Source int
+	// Src the header entry in the source.
+	Src Entry
+
+	// Dst the header entry in the destination.
+	// This is only valid if DstExists is set.
+	Dst Entry
+	// DstExists if the entry exists in the destination.
+	DstExists bool
+	// Merged if the entry in the destination was copied from another source during this merge.
+	Merged bool
+}
+
+// MergePolicy decides if the entry described by the given [MergeConflict]
+// should be copied to the destination.
+type MergePolicy func(c MergeConflict) bool
+
+// built-in merge policies
+var (
+	// MergeNewest copies the entry if it is newer than the entry in the destination.
+	MergeNewest MergePolicy = func(c MergeConflict) bool {
+		return !c.DstExists || c.Src.timestamp > c.Dst.timestamp
+	}
+	// MergePriority copies the entry unless it was already copied from a source
+	// that appears earlier in the list of sources.
+	// Entries that exist in the destination before the merge are overwritten.
+	MergePriority MergePolicy = func(c MergeConflict) bool { return !c.Merged }
+	// MergeSkipExisting only copies the entry if it does not exist in the destination.
+	MergeSkipExisting MergePolicy = func(c MergeConflict) bool { return !c.DstExists }
+)
+
+// MergeOptions options for [Merge].
+type MergeOptions struct {
+	// Offsets the number of regions each source is moved by.
+	// Offsets[i] is added to the position of every region in the i-th source.
+	// Sources without an offset are not moved.
+	Offsets []RegionPos
+}
+
+// Merge copies the entries in `srcs` to `dst`.
+// `policy` is called for every entry that exists in a source to decide if it should be copied.
+// Entries are copied without being decompressed and keep the timestamp from the source.
+func Merge(dst *Anvil, srcs []*Anvil, policy MergePolicy, opt ...MergeOptions) (err error) {
+	var options MergeOptions
+	if len(opt) == 1 {
+		options = opt[0]
+	}
+
+	merged := map[RegionPos]*[Entries]bool{}
+
+	for i, src := range srcs {
+		var offset RegionPos
+		if i < len(options.Offsets) {
+			offset = options.Offsets[i]
+		}
+
+		var regions []RegionPos
+		if regions, err = src.Regions(); err != nil {
+			return err
+		}
+
+		for _, rg := range regions {
+			dstRg := RegionPos{X: rg.X + offset.X, Z: rg.Z + offset.Z}
+
+			if merged[dstRg] == nil {
+				merged[dstRg] = &[Entries]bool{}
+			}
+
+			if err = mergeRegion(dst, src, i, rg, dstRg, policy, merged[dstRg]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// mergeRegion copies the entries in the region `rg` in `src` to the region `dstRg` in `dst`.
+func mergeRegion(dst, src *Anvil, source int, rg, dstRg RegionPos, policy MergePolicy, merged *[Entries]bool) (err error) {
+	var srcFile, dstFile *file
+	if srcFile, err = src.getScan(rg.X, rg.Z); err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := src.free(srcFile); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	if dstFile, err = dst.get(dstRg.X, dstRg.Z); err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := dst.free(dstFile); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	for i := 0; i < Entries; i++ {
+		x, z := uint8(i&0x1f), uint8(i>>5)
+
+		srcEntry, exists := srcFile.Info(x, z)
+		if !exists {
+			continue
+		}
+
+		// the policy must see the data queued for the entry
+		dstFile.waitQueued(x, z)
+		dstEntry, dstExists := dstFile.Info(x, z)
+		entryX, entryZ := dstFile.pos.External(x, z)
+
+		conflict := MergeConflict{
+			X: entryX, Z: entryZ, Source: source,
+			Src: srcEntry, Dst: dstEntry, DstExists: dstExists, Merged: merged[i],
+		}
+
+		if !policy(conflict) {
+			continue
+		}
+
+		var buf []byte
+		var method CompressMethod
+		if buf, method, err = srcFile.ReadRaw(x, z); err == nil {
+			err = dstFile.writeRaw(x, z, method, buf, srcEntry.Modified())
+		}
+
+		if err != nil {
+			return errors.Wrap(fmt.Sprintf("anvil: Merge: unable to copy entry (%d,%d)", entryX, entryZ), err)
+		}
+
+		merged[i] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package anvil
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type mergeTest struct{}
+
+func TestMerge(t *testing.T) { is.SuiteP(t, &mergeTest{}) }
+
+// makeWorld creates a world with the given entries.
+// The entry data is the value followed by the x and z values of the entry.
+func makeWorld(is is.Is, entries map[[2]int32]int64) *Anvil {
+	a, err := OpenFs(afero.NewMemMapFs())
+	is(err == nil, "unexpected error: %s", err)
+
+	for pos, value := range entries {
+		data := []byte{byte(value), byte(pos[0]), byte(pos[1])}
+		err = a.WriteWithOptions(pos[0], pos[1], data, WriteOptions{Timestamp: time.Unix(value, 0)})
+		is(err == nil, "unexpected error: %s", err)
+	}
+	return a
+}
+
+func (*mergeTest) check(is is.Is, a *Anvil, x, z int32, value byte) {
+	data, err := a.Read(x, z)
+	is(err == nil, "unexpected error while reading (%d,%d): %s", x, z, err)
+	is(len(data) == 3 && data[0] == value, "incorrect value at (%d,%d): %v", x, z, data)
+}
+
+func (m *mergeTest) TestNewest(is is.Is) {
+	dst := makeWorld(is, map[[2]int32]int64{{0, 0}: 5, {1, 0}: 1})
+	a := makeWorld(is, map[[2]int32]int64{{0, 0}: 3, {1, 0}: 2, {40, 40}: 7})
+	b := makeWorld(is, map[[2]int32]int64{{1, 0}: 4})
+
+	err := Merge(dst, []*Anvil{a, b}, MergeNewest)
+	is(err == nil, "unexpected error: %s", err)
+
+	m.check(is, dst, 0, 0, 5)
+	m.check(is, dst, 1, 0, 4)
+	m.check(is, dst, 40, 40, 7)
+
+	entry, _, err := dst.Info(40, 40)
+	is(err == nil, "unexpected error: %s", err)
+	is(entry.Modified().Equal(time.Unix(7, 0)), "timestamp was not preserved")
+}
+
+func (m *mergeTest) TestPriority(is is.Is) {
+	dst := makeWorld(is, map[[2]int32]int64{{0, 0}: 5, {2, 0}: 9})
+	a := makeWorld(is, map[[2]int32]int64{{0, 0}: 1})
+	b := makeWorld(is, map[[2]int32]int64{{0, 0}: 8, {1, 0}: 2})
+
+	err := Merge(dst, []*Anvil{a, b}, MergePriority)
+	is(err == nil, "unexpected error: %s", err)
+
+	m.check(is, dst, 0, 0, 1)
+	m.check(is, dst, 1, 0, 2)
+	m.check(is, dst, 2, 0, 9)
+}
+
+func (m *mergeTest) TestSkipExisting(is is.Is) {
+	dst := makeWorld(is, map[[2]int32]int64{{0, 0}: 5})
+	a := makeWorld(is, map[[2]int32]int64{{0, 0}: 1, {1, 0}: 2})
+
+	err := Merge(dst, []*Anvil{a}, MergeSkipExisting)
+	is(err == nil, "unexpected error: %s", err)
+
+	m.check(is, dst, 0, 0, 5)
+	m.check(is, dst, 1, 0, 2)
+}
+
+func (m *mergeTest) TestOffset(is is.Is) {
+	dst := makeWorld(is, nil)
+	a := makeWorld(is, map[[2]int32]int64{{3, 4}: 1, {-1, -1}: 2})
+
+	err := Merge(dst, []*Anvil{a}, MergeNewest, MergeOptions{Offsets: []RegionPos{{X: 2, Z: -1}}})
+	is(err == nil, "unexpected error: %s", err)
+
+	data, err := dst.Read(3+64, 4-32)
+	is(err == nil, "unexpected error: %s", err)
+	is(bytes.Equal(data, []byte{1, 3, 4}), "incorrect value read: %v", data)
+
+	data, err = dst.Read(-1+64, -1-32)
+	is(err == nil, "unexpected error: %s", err)
+	is(bytes.Equal(data, []byte{2, 0xff, 0xff}), "incorrect value read: %v", data)
+
+	_, err = dst.Read(3, 4)
+	is.Err(err, ErrNotExist, "entry was copied without an offset")
+}
+
+func (m *mergeTest) TestCustom(is is.Is) {
+	dst := makeWorld(is, nil)
+	a := makeWorld(is, map[[2]int32]int64{{0, 0}: 1, {1, 0}: 2})
+
+	err := Merge(dst, []*Anvil{a}, func(c MergeConflict) bool { return c.X == 1 })
+	is(err == nil, "unexpected error: %s", err)
+
+	_, err = dst.Read(0, 0)
+	is.Err(err, ErrNotExist, "entry was copied")
+	m.check(is, dst, 1, 0, 2)
+}
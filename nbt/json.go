@@ -0,0 +1,300 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/yehan2002/errors"
+)
+
+// jsonTag the JSON representation of a tag.
+// Every tag is written as an object containing its type so that the value
+// can be encoded to the same bytes after it is read.
+type jsonTag struct {
+	// Name the name of the root tag. This is only set for the root tag.
+	Name *string `json:"name,omitempty"`
+	// Type the name of the tag as returned by [Tag.String].
+	Type string `json:"type"`
+	// ElementType the type of the elements in a list.
+	ElementType string `json:"elementType,omitempty"`
+	// Value the value of the tag.
+	// Compounds are written as objects, lists and arrays are written as arrays,
+	// and non-finite floats are written as the strings `NaN`, `Infinity` and `-Infinity`.
+	Value json.RawMessage `json:"value,omitempty"`
+	// Bytes the value of a string that is not valid UTF-8.
+	Bytes []byte `json:"bytes,omitempty"`
+}
+
+// WriteJSON writes the given compound as indented JSON.
+// Every tag is written as an object of the form `{"type": "TAG_Int", "value": 1}`,
+// lists also contain an `elementType` and the root tag also contains its `name`.
+// Strings that are not valid UTF-8 are written as base64 in `bytes` instead of `value`.
+// Names that are not valid UTF-8 cannot be written.
+//
+// The output can be read back using [ReadJSON] and encoded to the same bytes as the original value,
+// except for the payload of NaN values.
+func WriteJSON(w io.Writer, name string, root Compound) error {
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("nbt: the name %q is not valid UTF-8", name)
+	}
+
+	tag, err := toJSON(root)
+	if err != nil {
+		return err
+	}
+	tag.Name = &name
+
+	var compact []byte
+	if compact, err = json.Marshal(tag); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = json.Indent(&buf, compact, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func toJSON(v any) (t jsonTag, err error) {
+	tag := TagOf(v)
+	if tag == TagEnd {
+		return t, fmt.Errorf("nbt: unsupported type %T", v)
+	}
+	t.Type = tag.String()
+
+	switch v := v.(type) {
+	case float32:
+		t.Value = jsonFloat(float64(v), 32)
+	case float64:
+		t.Value = jsonFloat(v, 64)
+	case string:
+		if !utf8.ValidString(v) {
+			t.Bytes = []byte(v)
+			return t, nil
+		}
+		t.Value, err = marshalJSON(v)
+	case List:
+		t.ElementType = v.Type.String()
+		values := make([]jsonTag, len(v.Values))
+		for i, value := range v.Values {
+			if TagOf(value) != v.Type {
+				return t, fmt.Errorf("nbt: list of %s contains %T", v.Type, value)
+			}
+			if values[i], err = toJSON(value); err != nil {
+				return t, err
+			}
+		}
+		t.Value, err = marshalJSON(values)
+	case Compound:
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for i, f := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			if !utf8.ValidString(f.Name) {
+				return t, fmt.Errorf("nbt: the name %q is not valid UTF-8", f.Name)
+			}
+
+			var field jsonTag
+			if field, err = toJSON(f.Value); err != nil {
+				return t, fmt.Errorf("nbt: %q: %w", f.Name, err)
+			}
+
+			var name, value []byte
+			if name, err = marshalJSON(f.Name); err == nil {
+				value, err = marshalJSON(field)
+			}
+			if err != nil {
+				return t, err
+			}
+			buf.Write(name)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteByte('}')
+		t.Value = buf.Bytes()
+	default:
+		t.Value, err = marshalJSON(v)
+	}
+	return t, err
+}
+
+func jsonFloat(v float64, bits int) json.RawMessage {
+	switch {
+	case math.IsNaN(v):
+		return json.RawMessage(`"NaN"`)
+	case math.IsInf(v, 1):
+		return json.RawMessage(`"Infinity"`)
+	case math.IsInf(v, -1):
+		return json.RawMessage(`"-Infinity"`)
+	default:
+		return json.RawMessage(strconv.FormatFloat(v, 'g', -1, bits))
+	}
+}
+
+// marshalJSON is the same as json.Marshal but does not escape HTML characters.
+func marshalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+// ReadJSON reads a value written by [WriteJSON].
+// The root tag must be a compound.
+func ReadJSON(r io.Reader) (name string, root Compound, err error) {
+	var t jsonTag
+	dec := json.NewDecoder(r)
+	if err = dec.Decode(&t); err != nil {
+		return "", nil, errors.Cause(ErrInvalid, err)
+	}
+
+	if t.Type != TagCompound.String() {
+		return "", nil, errors.CauseStr(ErrInvalid, "root tag is not a compound")
+	}
+
+	var v any
+	if v, err = fromJSON(t, 0); err != nil {
+		return "", nil, err
+	}
+
+	if t.Name != nil {
+		name = *t.Name
+	}
+	return name, v.(Compound), nil
+}
+
+func fromJSON(t jsonTag, depth int) (v any, err error) {
+	if depth >= maxDepth {
+		return nil, errors.CauseStr(ErrInvalid, "too many nested tags")
+	}
+
+	tag, ok := tagByName(t.Type)
+	if !ok || tag == TagEnd {
+		return nil, errors.CauseStr(ErrInvalid, "unknown tag "+strconv.Quote(t.Type))
+	}
+
+	switch tag {
+	case TagByte:
+		v, err = unmarshalJSON[int8](t.Value)
+	case TagShort:
+		v, err = unmarshalJSON[int16](t.Value)
+	case TagInt:
+		v, err = unmarshalJSON[int32](t.Value)
+	case TagLong:
+		v, err = unmarshalJSON[int64](t.Value)
+	case TagFloat:
+		var f float64
+		f, err = floatFromJSON(t.Value, 32)
+		v = float32(f)
+	case TagDouble:
+		v, err = floatFromJSON(t.Value, 64)
+	case TagByteArray:
+		v, err = unmarshalJSON[[]int8](t.Value)
+	case TagIntArray:
+		v, err = unmarshalJSON[[]int32](t.Value)
+	case TagLongArray:
+		v, err = unmarshalJSON[[]int64](t.Value)
+	case TagString:
+		if t.Bytes != nil {
+			return string(t.Bytes), nil
+		}
+		v, err = unmarshalJSON[string](t.Value)
+	case TagList:
+		return listFromJSON(t, depth)
+	case TagCompound:
+		return compoundFromJSON(t.Value, depth)
+	}
+
+	if err != nil {
+		return nil, errors.CauseStr(ErrInvalid, t.Type+": "+err.Error())
+	}
+	return v, nil
+}
+
+func listFromJSON(t jsonTag, depth int) (l List, err error) {
+	var ok bool
+	if l.Type, ok = tagByName(t.ElementType); !ok {
+		return l, errors.CauseStr(ErrInvalid, "unknown list type "+strconv.Quote(t.ElementType))
+	}
+
+	var values []jsonTag
+	if values, err = unmarshalJSON[[]jsonTag](t.Value); err != nil {
+		return l, errors.CauseStr(ErrInvalid, "TAG_List: "+err.Error())
+	}
+
+	l.Values = make([]any, len(values))
+	for i, value := range values {
+		if value.Type != t.ElementType {
+			return l, errors.CauseStr(ErrInvalid, fmt.Sprintf("list of %s contains %s", t.ElementType, value.Type))
+		}
+		if l.Values[i], err = fromJSON(value, depth+1); err != nil {
+			return l, err
+		}
+	}
+	return l, nil
+}
+
+// compoundFromJSON decodes a compound while preserving the order of its fields.
+func compoundFromJSON(data json.RawMessage, depth int) (c Compound, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.CauseStr(ErrInvalid, "TAG_Compound is not an object")
+	}
+
+	c = Compound{}
+	for dec.More() {
+		var tok json.Token
+		var t jsonTag
+		if tok, err = dec.Token(); err == nil {
+			err = dec.Decode(&t)
+		}
+		if err != nil {
+			return nil, errors.CauseStr(ErrInvalid, "TAG_Compound: "+err.Error())
+		}
+
+		name := tok.(string)
+		var v any
+		if v, err = fromJSON(t, depth+1); err != nil {
+			return nil, err
+		}
+		c = append(c, Field{Name: name, Value: v})
+	}
+	return c, nil
+}
+
+func floatFromJSON(data json.RawMessage, bits int) (float64, error) {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		switch s {
+		case "NaN":
+			return math.NaN(), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+	}
+	return strconv.ParseFloat(string(data), bits)
+}
+
+func unmarshalJSON[T any](data json.RawMessage) (v T, err error) {
+	if len(data) == 0 {
+		return v, errors.New("missing value")
+	}
+	err = json.Unmarshal(data, &v)
+	return
+}
@@ -0,0 +1,203 @@
+// Package nbt implements a decoder and encoder for the uncompressed binary NBT format
+// used to store chunk data in anvil files.
+//
+// Tags are decoded to the following Go types:
+//
+//	TAG_Byte       int8
+//	TAG_Short      int16
+//	TAG_Int        int32
+//	TAG_Long       int64
+//	TAG_Float      float32
+//	TAG_Double     float64
+//	TAG_Byte_Array []int8
+//	TAG_String     string
+//	TAG_List       List
+//	TAG_Compound   Compound
+//	TAG_Int_Array  []int32
+//	TAG_Long_Array []int64
+package nbt
+
+import (
+	"fmt"
+
+	"github.com/yehan2002/errors"
+)
+
+const (
+	// ErrInvalid returned if the data is not valid NBT.
+	ErrInvalid = errors.Const("nbt: invalid data")
+	// ErrNotFound returned by [Find] if the field does not exist.
+	ErrNotFound = errors.Const("nbt: field not found")
+)
+
+// maxDepth the maximum number of nested lists and compounds.
+const maxDepth = 512
+
+// Tag the type of an NBT tag.
+type Tag byte
+
+// supported tags
+const (
+	TagEnd Tag = iota
+	TagByte
+	TagShort
+	TagInt
+	TagLong
+	TagFloat
+	TagDouble
+	TagByteArray
+	TagString
+	TagList
+	TagCompound
+	TagIntArray
+	TagLongArray
+)
+
+var tagNames = [...]string{
+	TagEnd: "TAG_End", TagByte: "TAG_Byte", TagShort: "TAG_Short", TagInt: "TAG_Int",
+	TagLong: "TAG_Long", TagFloat: "TAG_Float", TagDouble: "TAG_Double",
+	TagByteArray: "TAG_Byte_Array", TagString: "TAG_String", TagList: "TAG_List",
+	TagCompound: "TAG_Compound", TagIntArray: "TAG_Int_Array", TagLongArray: "TAG_Long_Array",
+}
+
+func (t Tag) String() string {
+	if int(t) < len(tagNames) {
+		return tagNames[t]
+	}
+	return fmt.Sprintf("TAG_Unknown(%d)", byte(t))
+}
+
+// TagOf returns the tag for the given value.
+// If the value is not a supported type this returns [TagEnd].
+func TagOf(v any) Tag {
+	switch v.(type) {
+	case int8:
+		return TagByte
+	case int16:
+		return TagShort
+	case int32:
+		return TagInt
+	case int64:
+		return TagLong
+	case float32:
+		return TagFloat
+	case float64:
+		return TagDouble
+	case []int8:
+		return TagByteArray
+	case string:
+		return TagString
+	case List:
+		return TagList
+	case Compound:
+		return TagCompound
+	case []int32:
+		return TagIntArray
+	case []int64:
+		return TagLongArray
+	default:
+		return TagEnd
+	}
+}
+
+// Field a named tag in a compound.
+type Field struct {
+	Name  string
+	Value any
+}
+
+// Compound a compound tag.
+// The order of the fields is preserved so that encoding a decoded compound
+// produces the same bytes.
+type Compound []Field
+
+// Get returns the value of the field with the given name.
+func (c Compound) Get(name string) (v any, ok bool) {
+	for _, f := range c {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Compound returns the compound with the given name.
+func (c Compound) Compound(name string) (v Compound, ok bool) {
+	var t any
+	if t, ok = c.Get(name); ok {
+		v, ok = t.(Compound)
+	}
+	return
+}
+
+// List returns the list with the given name.
+func (c Compound) List(name string) (v List, ok bool) {
+	var t any
+	if t, ok = c.Get(name); ok {
+		v, ok = t.(List)
+	}
+	return
+}
+
+// String returns the string with the given name.
+func (c Compound) String(name string) (v string, ok bool) {
+	var t any
+	if t, ok = c.Get(name); ok {
+		v, ok = t.(string)
+	}
+	return
+}
+
+// Longs returns the long array with the given name.
+func (c Compound) Longs(name string) (v []int64, ok bool) {
+	var t any
+	if t, ok = c.Get(name); ok {
+		v, ok = t.([]int64)
+	}
+	return
+}
+
+// Int returns the integer with the given name.
+// This accepts TAG_Byte, TAG_Short, TAG_Int and TAG_Long.
+func (c Compound) Int(name string) (v int64, ok bool) {
+	var t any
+	if t, ok = c.Get(name); ok {
+		v, ok = toInt(t)
+	}
+	return
+}
+
+// List a list tag.
+type List struct {
+	// Type the type of the elements in the list.
+	Type   Tag
+	Values []any
+}
+
+// Compounds returns the elements of the list as compounds.
+// This returns nil if the list does not contain compounds.
+func (l List) Compounds() []Compound {
+	if l.Type != TagCompound {
+		return nil
+	}
+	c := make([]Compound, len(l.Values))
+	for i, v := range l.Values {
+		c[i] = v.(Compound)
+	}
+	return c
+}
+
+func toInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,170 @@
+package nbt
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/yehan2002/errors"
+	"github.com/yehan2002/is/v2"
+)
+
+func testCompound() Compound {
+	return Compound{
+		{Name: "byte", Value: int8(-1)},
+		{Name: "short", Value: int16(300)},
+		{Name: "int", Value: int32(-70000)},
+		{Name: "long", Value: int64(1) << 40},
+		{Name: "float", Value: float32(1.5)},
+		{Name: "double", Value: float64(-2.25)},
+		{Name: "bytes", Value: []int8{1, -2, 3}},
+		{Name: "string", Value: "hello"},
+		{Name: "list", Value: List{Type: TagString, Values: []any{"a", "b"}}},
+		{Name: "empty", Value: List{Type: TagEnd}},
+		{Name: "compound", Value: Compound{{Name: "z", Value: int32(1)}, {Name: "a", Value: int32(2)}}},
+		{Name: "ints", Value: []int32{1, 2, 3}},
+		{Name: "longs", Value: []int64{-1, 0, 1}},
+	}
+}
+
+func TestRoundtrip(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	err := Write(&buf, "root", testCompound())
+	is(err == nil, "unexpected error: %s", err)
+	encoded := append([]byte(nil), buf.Bytes()...)
+
+	name, root, err := Read(&buf)
+	is(err == nil, "unexpected error: %s", err)
+	is(name == "root", "incorrect name: %s", name)
+	is.Equal(root, testCompound(), "incorrect value decoded")
+
+	buf.Reset()
+	err = Write(&buf, name, root)
+	is(err == nil, "unexpected error: %s", err)
+	is(bytes.Equal(buf.Bytes(), encoded), "re-encoded value is different")
+
+	v, ok := root.Int("short")
+	is(ok && v == 300, "Compound.Int returned an incorrect value")
+	_, ok = root.Int("string")
+	is(!ok, "Compound.Int accepted a string")
+}
+
+func TestInvalid(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	err := Write(&buf, "", testCompound())
+	is(err == nil, "unexpected error: %s", err)
+	encoded := buf.Bytes()
+
+	for i := 0; i < len(encoded); i++ {
+		_, _, err = Read(bytes.NewReader(encoded[:i]))
+		is(errors.Is(err, io.ErrUnexpectedEOF), "truncated data was accepted: %d", i)
+	}
+
+	_, _, err = Read(bytes.NewReader([]byte{byte(TagString), 0, 0, 0, 0}))
+	is(errors.Is(err, ErrInvalid), "non-compound root was accepted")
+
+	err = Write(&buf, "", Compound{{Name: "bad", Value: 1}})
+	is(err != nil, "unsupported type was accepted")
+}
+
+func TestFind(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	root := append(testCompound(), Field{Name: "last", Value: int32(42)})
+	err := Write(&buf, "", root)
+	is(err == nil, "unexpected error: %s", err)
+	encoded := buf.Bytes()
+
+	for _, f := range root {
+		v, err := Find(bytes.NewReader(encoded), f.Name)
+		is(err == nil, "unexpected error: %s", err)
+		is.Equal(v, f.Value, "incorrect value for %s", f.Name)
+	}
+
+	_, err = Find(bytes.NewReader(encoded), "missing")
+	is(errors.Is(err, ErrNotFound), "incorrect error returned: %s", err)
+
+	_, err = Find(bytes.NewReader(encoded[:len(encoded)-8]), "last")
+	is(errors.Is(err, io.ErrUnexpectedEOF), "incorrect error returned: %s", err)
+}
+
+// textCompound returns a compound containing values that need special handling in text formats.
+func textCompound() Compound {
+	return append(testCompound(),
+		Field{Name: "quoted key", Value: "tab\t\"quote\" \\ é \xff\xc0\x80"},
+		Field{Name: "", Value: int8(0)},
+		Field{Name: "floats", Value: List{Type: TagFloat, Values: []any{float32(math.Inf(1)), float32(math.Copysign(0, -1)), float32(0.1)}}},
+		Field{Name: "doubles", Value: List{Type: TagDouble, Values: []any{math.Inf(-1), 1e300, float64(3)}}},
+		Field{Name: "typed", Value: List{Type: TagCompound, Values: []any{}}},
+		Field{Name: "lists", Value: List{Type: TagList, Values: []any{
+			List{Type: TagInt, Values: []any{int32(1)}},
+			List{Type: TagCompound, Values: []any{Compound{}, Compound{{Name: "a", Value: []int64{}}}}},
+		}}},
+		Field{Name: "arrays", Value: List{Type: TagByteArray, Values: []any{[]int8{}, []int8{-128, 127}}}},
+	)
+}
+
+func testText(is is.Is, write func(io.Writer, string, Compound) error, read func(io.Reader) (string, Compound, error)) {
+	for _, name := range []string{"", "root"} {
+		var buf bytes.Buffer
+		err := Write(&buf, name, textCompound())
+		is(err == nil, "unexpected error: %s", err)
+		encoded := append([]byte(nil), buf.Bytes()...)
+
+		buf.Reset()
+		err = write(&buf, name, textCompound())
+		is(err == nil, "unexpected error: %s", err)
+
+		decodedName, root, err := read(&buf)
+		is(err == nil, "unexpected error: %s", err)
+		is(decodedName == name, "incorrect name: %q", decodedName)
+
+		buf.Reset()
+		err = Write(&buf, decodedName, root)
+		is(err == nil, "unexpected error: %s", err)
+		is(bytes.Equal(buf.Bytes(), encoded), "re-encoded value is different")
+	}
+}
+
+func TestSNBT(t *testing.T) {
+	is := is.New(t)
+	testText(is, WriteSNBT, ReadSNBT)
+
+	_, root, err := ReadSNBT(strings.NewReader(`{a: 1b, b: [1, 2], 'c': unquoted, d: [L; 1, 2L], e: true, f: 1.5, g: [B;]}`))
+	is(err == nil, "unexpected error: %s", err)
+	is.Equal(root, Compound{
+		{Name: "a", Value: int8(1)},
+		{Name: "b", Value: List{Type: TagInt, Values: []any{int32(1), int32(2)}}},
+		{Name: "c", Value: "unquoted"},
+		{Name: "d", Value: []int64{1, 2}},
+		{Name: "e", Value: int8(1)},
+		{Name: "f", Value: 1.5},
+		{Name: "g", Value: []int8{}},
+	}, "incorrect value decoded")
+
+	for _, invalid := range []string{"", "[]", "{a: 1", "{a: [1, 2b]}", "{a: 128b}", `{a: "\q"}`, "{a: 1} {}", "{a 1}", "{a: [X;]}"} {
+		_, _, err = ReadSNBT(strings.NewReader(invalid))
+		is(errors.Is(err, ErrInvalid), "invalid SNBT was accepted: %s", invalid)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	is := is.New(t)
+	testText(is, WriteJSON, ReadJSON)
+
+	for _, invalid := range []string{"", "[]", `{"type": "TAG_Int", "value": 1}`, `{"type": "TAG_Compound", "value": {"a": {"type": "TAG_Byte", "value": 128}}}`,
+		`{"type": "TAG_Compound", "value": {"a": {"type": "TAG_List", "elementType": "TAG_Int", "value": [{"type": "TAG_Byte", "value": 1}]}}}`} {
+		_, _, err := ReadJSON(strings.NewReader(invalid))
+		is(errors.Is(err, ErrInvalid), "invalid JSON was accepted: %s", invalid)
+	}
+
+	err := WriteJSON(io.Discard, "", Compound{{Name: "\xff", Value: int8(1)}})
+	is(err != nil, "invalid name was accepted")
+}
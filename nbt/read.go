@@ -0,0 +1,357 @@
+package nbt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/yehan2002/errors"
+)
+
+// Read reads an uncompressed NBT value from the given reader.
+// The root tag must be a compound.
+func Read(r io.Reader) (name string, root Compound, err error) {
+	d := newDecoder(r)
+
+	var tag Tag
+	if tag, name, err = d.header(); err != nil {
+		return "", nil, err
+	}
+
+	if tag != TagCompound {
+		return "", nil, errors.CauseStr(ErrInvalid, "root tag is not a compound")
+	}
+
+	var v any
+	if v, err = d.payload(tag, 0); err != nil {
+		return "", nil, err
+	}
+	return name, v.(Compound), nil
+}
+
+// Find reads the value of the field with the given name in the root compound.
+// Other fields are skipped without being decoded.
+// If the field does not exist, this returns [ErrNotFound].
+func Find(r io.Reader, name string) (v any, err error) {
+	d := newDecoder(r)
+
+	var tag Tag
+	if tag, _, err = d.header(); err != nil {
+		return nil, err
+	}
+
+	if tag != TagCompound {
+		return nil, errors.CauseStr(ErrInvalid, "root tag is not a compound")
+	}
+
+	for {
+		var fieldName string
+		if tag, fieldName, err = d.header(); err != nil {
+			return nil, err
+		}
+
+		if tag == TagEnd {
+			return nil, ErrNotFound
+		}
+
+		if fieldName == name {
+			return d.payload(tag, 1)
+		}
+
+		if err = d.skip(tag, 1); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type decoder struct {
+	r   *bufio.Reader
+	tmp [8]byte
+}
+
+func newDecoder(r io.Reader) *decoder {
+	if br, ok := r.(*bufio.Reader); ok {
+		return &decoder{r: br}
+	}
+	return &decoder{r: bufio.NewReader(r)}
+}
+
+// header reads the tag and name of a named tag.
+// If the tag is [TagEnd], the name is not read.
+func (d *decoder) header() (tag Tag, name string, err error) {
+	var b byte
+	if b, err = d.r.ReadByte(); err != nil {
+		return 0, "", d.err(err)
+	}
+
+	if tag = Tag(b); tag == TagEnd {
+		return
+	}
+
+	name, err = d.string()
+	return
+}
+
+func (d *decoder) payload(tag Tag, depth int) (v any, err error) {
+	switch tag {
+	case TagByte:
+		var b byte
+		b, err = d.r.ReadByte()
+		return int8(b), d.err(err)
+	case TagShort:
+		var n uint16
+		n, err = d.uint16()
+		return int16(n), err
+	case TagInt:
+		var n uint32
+		n, err = d.uint32()
+		return int32(n), err
+	case TagLong:
+		var n uint64
+		n, err = d.uint64()
+		return int64(n), err
+	case TagFloat:
+		var n uint32
+		n, err = d.uint32()
+		return math.Float32frombits(n), err
+	case TagDouble:
+		var n uint64
+		n, err = d.uint64()
+		return math.Float64frombits(n), err
+	case TagByteArray:
+		return d.byteArray()
+	case TagString:
+		return d.string()
+	case TagList:
+		return d.list(depth)
+	case TagCompound:
+		return d.compound(depth)
+	case TagIntArray:
+		return d.intArray()
+	case TagLongArray:
+		return d.longArray()
+	default:
+		return nil, errors.CauseStr(ErrInvalid, "unknown tag "+tag.String())
+	}
+}
+
+// arrayElementSize the size of a single element in an array tag.
+var arrayElementSize = [...]int{TagByteArray: 1, TagIntArray: 4, TagLongArray: 8}
+
+// skip skips the payload of the given tag.
+func (d *decoder) skip(tag Tag, depth int) (err error) {
+	if depth >= maxDepth {
+		return errors.CauseStr(ErrInvalid, "too many nested tags")
+	}
+
+	switch tag {
+	case TagByte:
+		return d.discard(1)
+	case TagShort:
+		return d.discard(2)
+	case TagInt, TagFloat:
+		return d.discard(4)
+	case TagLong, TagDouble:
+		return d.discard(8)
+	case TagByteArray, TagIntArray, TagLongArray:
+		var n int
+		if n, err = d.length(); err == nil {
+			err = d.discard(n * arrayElementSize[tag])
+		}
+		return err
+	case TagString:
+		var n uint16
+		if n, err = d.uint16(); err == nil {
+			err = d.discard(int(n))
+		}
+		return err
+	case TagList:
+		var b byte
+		if b, err = d.r.ReadByte(); err != nil {
+			return d.err(err)
+		}
+
+		var n int
+		if n, err = d.length(); err != nil {
+			return err
+		}
+
+		for i := 0; i < n && err == nil; i++ {
+			err = d.skip(Tag(b), depth+1)
+		}
+		return err
+	case TagCompound:
+		for {
+			if tag, _, err = d.header(); err != nil || tag == TagEnd {
+				return err
+			}
+			if err = d.skip(tag, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.CauseStr(ErrInvalid, "unknown tag "+tag.String())
+	}
+}
+
+func (d *decoder) discard(n int) error {
+	if _, err := d.r.Discard(n); err != nil {
+		return d.err(err)
+	}
+	return nil
+}
+
+func (d *decoder) compound(depth int) (c Compound, err error) {
+	if depth >= maxDepth {
+		return nil, errors.CauseStr(ErrInvalid, "too many nested tags")
+	}
+
+	c = Compound{}
+	for {
+		var tag Tag
+		var name string
+		if tag, name, err = d.header(); err != nil {
+			return nil, err
+		}
+
+		if tag == TagEnd {
+			return c, nil
+		}
+
+		var v any
+		if v, err = d.payload(tag, depth+1); err != nil {
+			return nil, err
+		}
+		c = append(c, Field{Name: name, Value: v})
+	}
+}
+
+func (d *decoder) list(depth int) (l List, err error) {
+	if depth >= maxDepth {
+		return l, errors.CauseStr(ErrInvalid, "too many nested tags")
+	}
+
+	var b byte
+	if b, err = d.r.ReadByte(); err != nil {
+		return l, d.err(err)
+	}
+	l.Type = Tag(b)
+
+	var n int
+	if n, err = d.length(); err != nil {
+		return l, err
+	}
+
+	l.Values = make([]any, 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		var v any
+		if v, err = d.payload(l.Type, depth+1); err != nil {
+			return l, err
+		}
+		l.Values = append(l.Values, v)
+	}
+	return l, nil
+}
+
+func (d *decoder) string() (string, error) {
+	n, err := d.uint16()
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, n)
+	if _, err = io.ReadFull(d.r, buf); err != nil {
+		return "", d.err(err)
+	}
+	return string(buf), nil
+}
+
+func (d *decoder) byteArray() (v []int8, err error) {
+	var n int
+	if n, err = d.length(); err != nil {
+		return nil, err
+	}
+
+	v = make([]int8, 0, min(n, 4096))
+	for i := 0; i < n; i++ {
+		var b byte
+		if b, err = d.r.ReadByte(); err != nil {
+			return nil, d.err(err)
+		}
+		v = append(v, int8(b))
+	}
+	return v, nil
+}
+
+func (d *decoder) intArray() (v []int32, err error) {
+	var n int
+	if n, err = d.length(); err != nil {
+		return nil, err
+	}
+
+	v = make([]int32, 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		var t uint32
+		if t, err = d.uint32(); err != nil {
+			return nil, err
+		}
+		v = append(v, int32(t))
+	}
+	return v, nil
+}
+
+func (d *decoder) longArray() (v []int64, err error) {
+	var n int
+	if n, err = d.length(); err != nil {
+		return nil, err
+	}
+
+	v = make([]int64, 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		var t uint64
+		if t, err = d.uint64(); err != nil {
+			return nil, err
+		}
+		v = append(v, int64(t))
+	}
+	return v, nil
+}
+
+// length reads the length of an array or list.
+func (d *decoder) length() (int, error) {
+	n, err := d.uint32()
+	if err == nil && int32(n) < 0 {
+		err = errors.CauseStr(ErrInvalid, "negative length")
+	}
+	return int(int32(n)), err
+}
+
+func (d *decoder) uint16() (uint16, error) {
+	if _, err := io.ReadFull(d.r, d.tmp[:2]); err != nil {
+		return 0, d.err(err)
+	}
+	return binary.BigEndian.Uint16(d.tmp[:]), nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if _, err := io.ReadFull(d.r, d.tmp[:4]); err != nil {
+		return 0, d.err(err)
+	}
+	return binary.BigEndian.Uint32(d.tmp[:]), nil
+}
+
+func (d *decoder) uint64() (uint64, error) {
+	if _, err := io.ReadFull(d.r, d.tmp[:8]); err != nil {
+		return 0, d.err(err)
+	}
+	return binary.BigEndian.Uint64(d.tmp[:]), nil
+}
+
+// err converts io.EOF to io.ErrUnexpectedEOF since a valid value never ends early.
+func (d *decoder) err(err error) error {
+	if err == io.EOF {
+		return errors.Wrap("nbt: unexpected end of data", io.ErrUnexpectedEOF)
+	}
+	return err
+}
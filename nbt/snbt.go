@@ -0,0 +1,622 @@
+package nbt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yehan2002/errors"
+)
+
+// WriteSNBT writes the given compound as SNBT (stringified NBT), the text format used by commands.
+// Compounds and lists containing compounds, lists or arrays are written on multiple lines
+// so that the output can be diffed.
+//
+// The output can be read back using [ReadSNBT] and encoded to the same bytes as the original value.
+// The following extensions are used for values that cannot be represented in SNBT:
+//
+//   - The root tag is written as `name: {...}` if it has a name.
+//   - Empty lists with an element type other than [TagEnd] are written as `[TAG_Compound;]`.
+//   - Bytes in strings that are not valid UTF-8 are written as `\xNN` escapes.
+//   - Non-finite floats are written as `NaNf`, `Infinityd` etc.
+//     The payload of NaN values is not preserved.
+func WriteSNBT(w io.Writer, name string, root Compound) (err error) {
+	e := &snbtEncoder{w: bufio.NewWriter(w)}
+	if name != "" {
+		e.key(name)
+		e.w.WriteString(": ")
+	}
+
+	if err = e.value(root, 0); err == nil {
+		e.w.WriteByte('\n')
+		err = e.w.Flush()
+	}
+	return
+}
+
+type snbtEncoder struct {
+	w *bufio.Writer
+}
+
+func (e *snbtEncoder) value(v any, depth int) error {
+	switch v := v.(type) {
+	case int8:
+		e.w.WriteString(strconv.FormatInt(int64(v), 10) + "b")
+	case int16:
+		e.w.WriteString(strconv.FormatInt(int64(v), 10) + "s")
+	case int32:
+		e.w.WriteString(strconv.FormatInt(int64(v), 10))
+	case int64:
+		e.w.WriteString(strconv.FormatInt(v, 10) + "L")
+	case float32:
+		e.float(float64(v), 32, 'f')
+	case float64:
+		e.float(v, 64, 'd')
+	case string:
+		e.quote(v)
+	case []int8:
+		e.array("B", len(v))
+		for i, n := range v {
+			e.separator(i)
+			e.w.WriteString(strconv.FormatInt(int64(n), 10) + "b")
+		}
+		e.w.WriteByte(']')
+	case []int32:
+		e.array("I", len(v))
+		for i, n := range v {
+			e.separator(i)
+			e.w.WriteString(strconv.FormatInt(int64(n), 10))
+		}
+		e.w.WriteByte(']')
+	case []int64:
+		e.array("L", len(v))
+		for i, n := range v {
+			e.separator(i)
+			e.w.WriteString(strconv.FormatInt(n, 10) + "L")
+		}
+		e.w.WriteByte(']')
+	case List:
+		return e.list(v, depth)
+	case Compound:
+		return e.compound(v, depth)
+	default:
+		return fmt.Errorf("nbt: unsupported type %T", v)
+	}
+	return nil
+}
+
+func (e *snbtEncoder) compound(c Compound, depth int) error {
+	if len(c) == 0 {
+		e.w.WriteString("{}")
+		return nil
+	}
+
+	e.w.WriteByte('{')
+	for i, f := range c {
+		if TagOf(f.Value) == TagEnd {
+			return fmt.Errorf("nbt: unsupported type %T for %q", f.Value, f.Name)
+		}
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		e.newline(depth + 1)
+		e.key(f.Name)
+		e.w.WriteString(": ")
+		if err := e.value(f.Value, depth+1); err != nil {
+			return err
+		}
+	}
+	e.newline(depth)
+	e.w.WriteByte('}')
+	return nil
+}
+
+func (e *snbtEncoder) list(l List, depth int) error {
+	if len(l.Values) == 0 {
+		if l.Type == TagEnd {
+			e.w.WriteString("[]")
+		} else {
+			e.w.WriteString("[" + l.Type.String() + ";]")
+		}
+		return nil
+	}
+
+	multiline := l.Type >= TagByteArray && l.Type != TagString
+	e.w.WriteByte('[')
+	for i, v := range l.Values {
+		if TagOf(v) != l.Type {
+			return fmt.Errorf("nbt: list of %s contains %T", l.Type, v)
+		}
+
+		if multiline {
+			if i > 0 {
+				e.w.WriteByte(',')
+			}
+			e.newline(depth + 1)
+		} else {
+			e.separator(i)
+		}
+
+		if err := e.value(v, depth+1); err != nil {
+			return err
+		}
+	}
+	if multiline {
+		e.newline(depth)
+	}
+	e.w.WriteByte(']')
+	return nil
+}
+
+func (e *snbtEncoder) float(v float64, bits int, suffix byte) {
+	switch {
+	case math.IsNaN(v):
+		e.w.WriteString("NaN")
+	case math.IsInf(v, 1):
+		e.w.WriteString("Infinity")
+	case math.IsInf(v, -1):
+		e.w.WriteString("-Infinity")
+	default:
+		e.w.WriteString(strconv.FormatFloat(v, 'g', -1, bits))
+	}
+	e.w.WriteByte(suffix)
+}
+
+// array writes the start of an array.
+func (e *snbtEncoder) array(prefix string, length int) {
+	e.w.WriteString("[" + prefix + ";")
+	if length > 0 {
+		e.w.WriteByte(' ')
+	}
+}
+
+// separator writes the separator before the i-th value in a single line list or array.
+func (e *snbtEncoder) separator(i int) {
+	if i > 0 {
+		e.w.WriteString(", ")
+	}
+}
+
+func (e *snbtEncoder) newline(depth int) {
+	e.w.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		e.w.WriteString("  ")
+	}
+}
+
+func (e *snbtEncoder) key(name string) {
+	if name != "" && strings.IndexFunc(name, func(r rune) bool { return !isUnquoted(r) }) == -1 {
+		e.w.WriteString(name)
+		return
+	}
+	e.quote(name)
+}
+
+func (e *snbtEncoder) quote(s string) {
+	e.w.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '\n':
+			e.w.WriteString(`\n`)
+		case r == '\t':
+			e.w.WriteString(`\t`)
+		case r == utf8.RuneError && size == 1, r < 0x20, r == 0x7f:
+			e.w.WriteString(fmt.Sprintf(`\x%02x`, s[i]))
+		case r == '"' || r == '\\':
+			e.w.WriteByte('\\')
+			e.w.WriteByte(byte(r))
+		default:
+			e.w.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	e.w.WriteByte('"')
+}
+
+// isUnquoted reports if the given rune is allowed in unquoted keys and strings.
+func isUnquoted(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		r == '_' || r == '-' || r == '.' || r == '+'
+}
+
+// ReadSNBT reads an SNBT value written by [WriteSNBT].
+// The root tag must be a compound.
+// Unquoted strings, single-quoted strings, `true` and `false` are also accepted.
+func ReadSNBT(r io.Reader) (name string, root Compound, err error) {
+	var data []byte
+	if data, err = io.ReadAll(r); err != nil {
+		return "", nil, err
+	}
+
+	d := &snbtDecoder{data: data}
+	if d.skipSpace(); d.peek() != '{' {
+		if name, err = d.key(); err != nil {
+			return "", nil, err
+		}
+		if err = d.expect(':'); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if d.skipSpace(); d.peek() != '{' {
+		return "", nil, d.error("root tag is not a compound")
+	}
+
+	if root, err = d.compound(0); err != nil {
+		return "", nil, err
+	}
+
+	if d.skipSpace(); d.pos != len(d.data) {
+		return "", nil, d.error("unexpected data after root tag")
+	}
+	return name, root, nil
+}
+
+type snbtDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *snbtDecoder) value(depth int) (any, error) {
+	switch d.skipSpace(); d.peek() {
+	case '{':
+		return d.compound(depth)
+	case '[':
+		return d.list(depth)
+	case '"', '\'':
+		return d.string()
+	default:
+		token := d.token()
+		if token == "" {
+			return nil, d.error("expected a value")
+		}
+		if v, ok := parseLiteral(token); ok {
+			return v, nil
+		}
+		return nil, d.error("invalid number " + strconv.Quote(token))
+	}
+}
+
+func (d *snbtDecoder) compound(depth int) (c Compound, err error) {
+	if depth >= maxDepth {
+		return nil, d.error("too many nested tags")
+	}
+
+	d.pos++ // {
+	c = Compound{}
+	for {
+		if d.skipSpace(); d.peek() == '}' {
+			d.pos++
+			return c, nil
+		}
+
+		var f Field
+		if f.Name, err = d.key(); err != nil {
+			return nil, err
+		}
+		if err = d.expect(':'); err != nil {
+			return nil, err
+		}
+		if f.Value, err = d.value(depth + 1); err != nil {
+			return nil, err
+		}
+		c = append(c, f)
+
+		if !d.next('}') {
+			return nil, d.error("expected ',' or '}'")
+		}
+	}
+}
+
+func (d *snbtDecoder) list(depth int) (v any, err error) {
+	if depth >= maxDepth {
+		return nil, d.error("too many nested tags")
+	}
+
+	d.pos++ // [
+	start := d.pos
+	d.skipSpace()
+	if prefix := d.token(); prefix != "" {
+		if d.skipSpace(); d.peek() == ';' {
+			d.pos++
+			return d.typed(prefix)
+		}
+	}
+	d.pos = start
+
+	l := List{Values: []any{}}
+	for {
+		if d.skipSpace(); d.peek() == ']' {
+			d.pos++
+			return l, nil
+		}
+
+		var value any
+		if value, err = d.value(depth + 1); err != nil {
+			return nil, err
+		}
+
+		if tag := TagOf(value); len(l.Values) == 0 {
+			l.Type = tag
+		} else if tag != l.Type {
+			return nil, d.error(fmt.Sprintf("list of %s contains %s", l.Type, tag))
+		}
+		l.Values = append(l.Values, value)
+
+		if !d.next(']') {
+			return nil, d.error("expected ',' or ']'")
+		}
+	}
+}
+
+// typed reads an array or an empty list with an element type.
+func (d *snbtDecoder) typed(prefix string) (any, error) {
+	var array []any
+	var tag Tag
+	switch prefix {
+	case "B":
+		tag = TagByte
+	case "I":
+		tag = TagInt
+	case "L":
+		tag = TagLong
+	default:
+		var ok bool
+		if tag, ok = tagByName(prefix); !ok || tag == TagEnd {
+			return nil, d.error("unknown list type " + strconv.Quote(prefix))
+		}
+		if d.skipSpace(); d.peek() != ']' {
+			return nil, d.error("expected ']'")
+		}
+		d.pos++
+		return List{Type: tag, Values: []any{}}, nil
+	}
+
+	for {
+		if d.skipSpace(); d.peek() == ']' {
+			d.pos++
+			break
+		}
+
+		value, ok := parseNumber(d.token(), tag)
+		if !ok {
+			return nil, d.error("invalid " + tag.String() + " in array")
+		}
+		array = append(array, value)
+
+		if !d.next(']') {
+			return nil, d.error("expected ',' or ']'")
+		}
+	}
+
+	switch tag {
+	case TagByte:
+		v := make([]int8, len(array))
+		for i, n := range array {
+			v[i] = n.(int8)
+		}
+		return v, nil
+	case TagInt:
+		v := make([]int32, len(array))
+		for i, n := range array {
+			v[i] = n.(int32)
+		}
+		return v, nil
+	default:
+		v := make([]int64, len(array))
+		for i, n := range array {
+			v[i] = n.(int64)
+		}
+		return v, nil
+	}
+}
+
+// next skips the separator after a value in a compound or list.
+// This returns false if the next character is neither a comma nor `end`.
+func (d *snbtDecoder) next(end byte) bool {
+	switch d.skipSpace(); d.peek() {
+	case ',':
+		d.pos++
+		return true
+	case end:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *snbtDecoder) key() (string, error) {
+	if d.skipSpace(); d.peek() == '"' || d.peek() == '\'' {
+		return d.string()
+	}
+	if key := d.token(); key != "" {
+		return key, nil
+	}
+	return "", d.error("expected a key")
+}
+
+func (d *snbtDecoder) string() (string, error) {
+	quote := d.data[d.pos]
+	d.pos++
+
+	var sb strings.Builder
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		d.pos++
+		switch c {
+		case quote:
+			return sb.String(), nil
+		case '\\':
+			if d.pos >= len(d.data) {
+				return "", d.error("unterminated string")
+			}
+			c = d.data[d.pos]
+			d.pos++
+			switch c {
+			case '\\', '"', '\'':
+				sb.WriteByte(c)
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 's':
+				sb.WriteByte(' ')
+			case 'x':
+				if d.pos+2 > len(d.data) {
+					return "", d.error("invalid escape")
+				}
+				b, err := strconv.ParseUint(string(d.data[d.pos:d.pos+2]), 16, 8)
+				if err != nil {
+					return "", d.error("invalid escape")
+				}
+				sb.WriteByte(byte(b))
+				d.pos += 2
+			case 'u':
+				if d.pos+4 > len(d.data) {
+					return "", d.error("invalid escape")
+				}
+				r, err := strconv.ParseUint(string(d.data[d.pos:d.pos+4]), 16, 16)
+				if err != nil {
+					return "", d.error("invalid escape")
+				}
+				sb.WriteRune(rune(r))
+				d.pos += 4
+			default:
+				return "", d.error("invalid escape")
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", d.error("unterminated string")
+}
+
+// token reads an unquoted string.
+func (d *snbtDecoder) token() string {
+	start := d.pos
+	for d.pos < len(d.data) && isUnquoted(rune(d.data[d.pos])) {
+		d.pos++
+	}
+	return string(d.data[start:d.pos])
+}
+
+func (d *snbtDecoder) expect(c byte) error {
+	if d.skipSpace(); d.peek() != c {
+		return d.error("expected " + strconv.QuoteRune(rune(c)))
+	}
+	d.pos++
+	return nil
+}
+
+func (d *snbtDecoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next character or 0 at the end of the data.
+func (d *snbtDecoder) peek() byte {
+	if d.pos < len(d.data) {
+		return d.data[d.pos]
+	}
+	return 0
+}
+
+func (d *snbtDecoder) error(msg string) error {
+	line := 1 + strings.Count(string(d.data[:min(d.pos, len(d.data))]), "\n")
+	return errors.CauseStr(ErrInvalid, fmt.Sprintf("line %d: %s", line, msg))
+}
+
+// suffixes the lowercase suffixes of number types.
+var suffixes = [...]byte{TagByte: 'b', TagShort: 's', TagInt: 0, TagLong: 'l', TagFloat: 'f', TagDouble: 'd'}
+
+// parseLiteral parses an unquoted value.
+// Values that are not numbers or booleans are treated as strings,
+// unless they start with a digit.
+func parseLiteral(token string) (any, bool) {
+	switch token {
+	case "true":
+		return int8(1), true
+	case "false":
+		return int8(0), true
+	}
+
+	suffix := token[len(token)-1] | 0x20
+	for tag := TagByte; tag <= TagDouble; tag++ {
+		if tag != TagInt && suffixes[tag] == suffix {
+			if v, ok := parseNumber(token, tag); ok {
+				return v, true
+			}
+		}
+	}
+
+	if v, ok := parseNumber(token, TagInt); ok {
+		return v, true
+	}
+
+	digits := strings.TrimLeft(token, "+-.")
+	if numeric := digits != "" && digits[0] >= '0' && digits[0] <= '9'; numeric {
+		return parseNumber(token, TagDouble)
+	}
+	return token, true
+}
+
+// parseNumber parses a number of the given type.
+// The suffix for the type is optional.
+func parseNumber(token string, tag Tag) (any, bool) {
+	if n := len(token); tag != TagInt && n > 1 && token[n-1]|0x20 == suffixes[tag] {
+		token = token[:n-1]
+	}
+
+	var err error
+	var v any
+	switch tag {
+	case TagByte:
+		var n int64
+		n, err = strconv.ParseInt(token, 10, 8)
+		v = int8(n)
+	case TagShort:
+		var n int64
+		n, err = strconv.ParseInt(token, 10, 16)
+		v = int16(n)
+	case TagInt:
+		var n int64
+		n, err = strconv.ParseInt(token, 10, 32)
+		v = int32(n)
+	case TagLong:
+		v, err = strconv.ParseInt(token, 10, 64)
+	case TagFloat:
+		var n float64
+		n, err = strconv.ParseFloat(token, 32)
+		v = float32(n)
+	case TagDouble:
+		v, err = strconv.ParseFloat(token, 64)
+	}
+	return v, err == nil
+}
+
+// tagByName returns the tag with the given name as returned by [Tag.String].
+func tagByName(name string) (Tag, bool) {
+	for tag, n := range tagNames {
+		if n == name {
+			return Tag(tag), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,109 @@
+package nbt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Write writes the given compound as an uncompressed NBT value.
+func Write(w io.Writer, name string, root Compound) (err error) {
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.header(TagCompound, name)
+	if err = e.payload(root); err == nil {
+		err = e.w.Flush()
+	}
+	return
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	tmp [8]byte
+}
+
+func (e *encoder) header(tag Tag, name string) {
+	e.w.WriteByte(byte(tag))
+	e.string(name)
+}
+
+func (e *encoder) payload(v any) error {
+	switch v := v.(type) {
+	case int8:
+		e.w.WriteByte(byte(v))
+	case int16:
+		e.uint16(uint16(v))
+	case int32:
+		e.uint32(uint32(v))
+	case int64:
+		e.uint64(uint64(v))
+	case float32:
+		e.uint32(math.Float32bits(v))
+	case float64:
+		e.uint64(math.Float64bits(v))
+	case []int8:
+		e.uint32(uint32(len(v)))
+		for _, b := range v {
+			e.w.WriteByte(byte(b))
+		}
+	case string:
+		e.string(v)
+	case List:
+		e.w.WriteByte(byte(v.Type))
+		e.uint32(uint32(len(v.Values)))
+		for _, value := range v.Values {
+			if TagOf(value) != v.Type {
+				return fmt.Errorf("nbt: list of %s contains %T", v.Type, value)
+			}
+			if err := e.payload(value); err != nil {
+				return err
+			}
+		}
+	case Compound:
+		for _, f := range v {
+			tag := TagOf(f.Value)
+			if tag == TagEnd {
+				return fmt.Errorf("nbt: unsupported type %T for %q", f.Value, f.Name)
+			}
+			e.header(tag, f.Name)
+			if err := e.payload(f.Value); err != nil {
+				return err
+			}
+		}
+		e.w.WriteByte(byte(TagEnd))
+	case []int32:
+		e.uint32(uint32(len(v)))
+		for _, n := range v {
+			e.uint32(uint32(n))
+		}
+	case []int64:
+		e.uint32(uint32(len(v)))
+		for _, n := range v {
+			e.uint64(uint64(n))
+		}
+	default:
+		return fmt.Errorf("nbt: unsupported type %T", v)
+	}
+	return nil
+}
+
+func (e *encoder) string(s string) {
+	e.uint16(uint16(len(s)))
+	e.w.WriteString(s)
+}
+
+func (e *encoder) uint16(v uint16) {
+	binary.BigEndian.PutUint16(e.tmp[:], v)
+	e.w.Write(e.tmp[:2])
+}
+
+func (e *encoder) uint32(v uint32) {
+	binary.BigEndian.PutUint32(e.tmp[:], v)
+	e.w.Write(e.tmp[:4])
+}
+
+func (e *encoder) uint64(v uint64) {
+	binary.BigEndian.PutUint64(e.tmp[:], v)
+	e.w.Write(e.tmp[:8])
+}
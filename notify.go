@@ -0,0 +1,141 @@
+package anvil
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NotifyKind the kind of change reported by a [Notification].
+type NotifyKind uint8
+
+// kinds of notifications
+const (
+	// NotifyWritten the entry was written.
+	NotifyWritten NotifyKind = 1 + iota
+	// NotifyRemoved the entry was removed.
+	NotifyRemoved
+)
+
+func (k NotifyKind) String() string {
+	switch k {
+	case NotifyWritten:
+		return "written"
+	case NotifyRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// Notification a change to an entry.
+type Notification struct {
+	ChunkPos
+	Kind NotifyKind
+	// Timestamp the modification time stored in the header for the entry.
+	Timestamp time.Time
+}
+
+// DefaultSubscribeBuffer the default value for [SubscribeOptions.Buffer].
+const DefaultSubscribeBuffer = 64
+
+// SubscribeOptions options for [Anvil.Subscribe].
+type SubscribeOptions struct {
+	// Buffer the maximum number of notifications that are buffered.
+	// Default: [DefaultSubscribeBuffer]
+	Buffer int
+	// Block if writes should block until there is space in the buffer.
+	// If this is false, notifications are dropped when the buffer is full
+	// and the number of dropped notifications is reported by [Subscription.Dropped].
+	// Default: false
+	Block bool
+}
+
+// Subscription receives notifications for changes made to entries in an [Anvil].
+type Subscription struct {
+	// C receives a notification after each successful write or remove.
+	// Notifications for the same entry are delivered in the order the changes were made.
+	// C is closed when the subscription is closed.
+	C <-chan Notification
+
+	c       chan Notification
+	block   bool
+	dropped atomic.Uint64
+
+	done  chan struct{}
+	close sync.Once
+	anvil *Anvil
+}
+
+// Subscribe returns a subscription that receives a notification after each write
+// or remove commits its header update, including writes made using [Anvil.File], [Walk] and [Merge].
+// Removing an entry that does not exist is not reported.
+// Notifications are sent after the anvil file is unlocked, so subscribers can read the file while
+// handling a notification. If [SubscribeOptions.Block] is set, later writes to the same anvil file
+// are blocked until the subscriber receives the notification.
+// The subscription must be closed using [Subscription.Close] when it is no longer used.
+func (a *Anvil) Subscribe(opt ...SubscribeOptions) *Subscription {
+	var options SubscribeOptions
+	if len(opt) == 1 {
+		options = opt[0]
+	}
+	if options.Buffer <= 0 {
+		options.Buffer = DefaultSubscribeBuffer
+	}
+
+	c := make(chan Notification, options.Buffer)
+	s := &Subscription{C: c, c: c, block: options.Block, done: make(chan struct{}), anvil: a}
+
+	a.subMux.Lock()
+	if a.subs == nil {
+		a.subs = map[*Subscription]struct{}{}
+	}
+	a.subs[s] = struct{}{}
+	a.subMux.Unlock()
+	return s
+}
+
+// Dropped returns the number of notifications that were dropped because the buffer was full.
+func (s *Subscription) Dropped() uint64 { return s.dropped.Load() }
+
+// Close closes the subscription.
+// Writes blocked on this subscription are unblocked and C is closed
+// after the buffered notifications.
+func (s *Subscription) Close() {
+	s.close.Do(func() {
+		close(s.done)
+
+		s.anvil.subMux.Lock()
+		delete(s.anvil.subs, s)
+		s.anvil.subMux.Unlock()
+
+		close(s.c)
+	})
+}
+
+// send sends the notification to the subscriber.
+func (s *Subscription) send(n Notification) {
+	if s.block {
+		select {
+		case s.c <- n:
+		case <-s.done:
+		}
+		return
+	}
+
+	select {
+	case s.c <- n:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// notify sends the given notification to all subscribers.
+func (a *Anvil) notify(n Notification) {
+	a.subMux.RLock()
+	defer a.subMux.RUnlock()
+
+	for s := range a.subs {
+		s.send(n)
+	}
+}
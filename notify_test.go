@@ -0,0 +1,128 @@
+package anvil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yehan2002/is/v2"
+)
+
+type notifyTest struct{}
+
+func TestNotify(t *testing.T) { is.SuiteP(t, &notifyTest{}) }
+
+func (*notifyTest) TestSubscribe(is is.Is) {
+	a := makeWorld(is, nil)
+	sub := a.Subscribe()
+	defer sub.Close()
+
+	err := a.WriteWithOptions(40, -2, []byte{1}, WriteOptions{Timestamp: time.Unix(100, 0)})
+	is(err == nil, "unexpected error: %s", err)
+	err = a.Remove(40, -2)
+	is(err == nil, "unexpected error: %s", err)
+
+	n := <-sub.C
+	is(n.ChunkPos == ChunkPos{X: 40, Z: -2} && n.Kind == NotifyWritten && n.Timestamp.Equal(time.Unix(100, 0)), "incorrect notification: %+v", n)
+	n = <-sub.C
+	is(n.ChunkPos == ChunkPos{X: 40, Z: -2} && n.Kind == NotifyRemoved, "incorrect notification: %+v", n)
+
+	sub.Close()
+	_, ok := <-sub.C
+	is(!ok, "channel was not closed")
+
+	// failed writes are not reported
+	readOnly, err := OpenFs(a.settings.fs, Settings{ReadOnly: true})
+	is(err == nil, "unexpected error: %s", err)
+	sub = readOnly.Subscribe()
+	defer sub.Close()
+	is(readOnly.Write(40, -2, []byte{1}) != nil, "write was accepted")
+	is(len(sub.C) == 0, "failed write was reported")
+}
+
+func (*notifyTest) TestDrop(is is.Is) {
+	a := makeWorld(is, nil)
+	sub := a.Subscribe(SubscribeOptions{Buffer: 1})
+	defer sub.Close()
+
+	for x := int32(0); x < 3; x++ {
+		err := a.Write(x, 0, []byte{1})
+		is(err == nil, "unexpected error: %s", err)
+	}
+
+	is(sub.Dropped() == 2, "incorrect number of dropped notifications: %d", sub.Dropped())
+	n := <-sub.C
+	is(n.X == 0, "incorrect notification: %+v", n)
+}
+
+func (*notifyTest) TestBlock(is is.Is) {
+	a := makeWorld(is, nil)
+	sub := a.Subscribe(SubscribeOptions{Buffer: 1, Block: true})
+
+	done := make(chan error)
+	go func() {
+		for x := int32(0); x < 3; x++ {
+			if err := a.Write(x, 0, []byte{1}); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	n := <-sub.C
+	is(n.X == 0, "incorrect notification: %+v", n)
+
+	select {
+	case <-done:
+		is.Fail("write did not block")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// closing the subscription unblocks writes
+	sub.Close()
+	err := <-done
+	is(err == nil, "unexpected error: %s", err)
+	is(sub.Dropped() == 0, "notifications were dropped")
+}
+
+func (*notifyTest) TestReadInHandler(is is.Is) {
+	a := makeWorld(is, nil)
+	sub := a.Subscribe(SubscribeOptions{Buffer: 1, Block: true})
+	defer sub.Close()
+
+	done := make(chan error)
+	go func() {
+		for x := int32(0); x < 3; x++ {
+			if err := a.Write(x, 0, []byte{byte(x + 1)}); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	// the writer is blocked sending a notification while the subscriber reads the same file
+	for i := 0; i < 3; i++ {
+		n := <-sub.C
+		read := make(chan error)
+		go func() { _, err := a.Read(n.X, n.Z); read <- err }()
+		select {
+		case err := <-read:
+			is(err == nil, "unexpected error: %s", err)
+		case <-time.After(10 * time.Second):
+			is.Fail("reading from a subscriber deadlocked")
+		}
+	}
+	is(<-done == nil, "unexpected error")
+}
+
+func (*notifyTest) TestRemoveMissing(is is.Is) {
+	a := makeWorld(is, nil)
+	sub := a.Subscribe()
+	defer sub.Close()
+
+	is(a.Remove(5, 5) == nil, "unexpected error")
+	is(a.Write(5, 5, []byte{1}) == nil, "unexpected error")
+	n := <-sub.C
+	is(n.Kind == NotifyWritten, "removing a missing entry was reported: %+v", n)
+}
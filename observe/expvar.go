@@ -0,0 +1,112 @@
+package observe
+
+import (
+	"errors"
+	"expvar"
+
+	"github.com/FireworkMC/anvil"
+)
+
+// Expvar an [anvil.Observer] that counts events using an [expvar.Map].
+//
+// The map contains the following counters:
+//
+//	opens, cache_hits, open_errors
+//	closes, close_errors, evictions
+//	reads, read_errors, read_missing, read_bytes, read_compressed_bytes, read_nanoseconds
+//	writes, removes, write_errors, write_bytes, write_compressed_bytes, write_nanoseconds, sync_nanoseconds
+//	grows, grow_bytes, grow_errors
+//	spills, spill_bytes, spill_errors
+//
+// Reads of entries that do not exist are only counted in read_missing.
+type Expvar struct {
+	m *expvar.Map
+}
+
+var _ anvil.Observer = &Expvar{}
+
+// NewExpvar creates an [Expvar] and publishes its map with the given name.
+// Like [expvar.Publish], this panics if the name is already in use.
+func NewExpvar(name string) *Expvar { return &Expvar{m: expvar.NewMap(name)} }
+
+// NewExpvarMap creates an [Expvar] that adds the counters to the given map without publishing it.
+func NewExpvarMap(m *expvar.Map) *Expvar { return &Expvar{m: m} }
+
+// Map returns the map containing the counters.
+func (e *Expvar) Map() *expvar.Map { return e.m }
+
+// Open implements [anvil.Observer].
+func (e *Expvar) Open(ev anvil.OpenEvent) {
+	switch {
+	case ev.Err != nil:
+		e.m.Add("open_errors", 1)
+	case ev.Cached:
+		e.m.Add("cache_hits", 1)
+	default:
+		e.m.Add("opens", 1)
+	}
+}
+
+// Close implements [anvil.Observer].
+func (e *Expvar) Close(ev anvil.CloseEvent) {
+	e.m.Add("closes", 1)
+	if ev.Err != nil {
+		e.m.Add("close_errors", 1)
+	}
+}
+
+// Evict implements [anvil.Observer].
+func (e *Expvar) Evict(anvil.RegionPos) { e.m.Add("evictions", 1) }
+
+// Read implements [anvil.Observer].
+func (e *Expvar) Read(ev anvil.ReadEvent) {
+	switch {
+	case errors.Is(ev.Err, anvil.ErrNotExist):
+		e.m.Add("read_missing", 1)
+		return
+	case ev.Err != nil:
+		e.m.Add("read_errors", 1)
+	}
+
+	e.m.Add("reads", 1)
+	e.m.Add("read_bytes", ev.Uncompressed)
+	e.m.Add("read_compressed_bytes", ev.Compressed)
+	e.m.Add("read_nanoseconds", int64(ev.Duration))
+}
+
+// Write implements [anvil.Observer].
+func (e *Expvar) Write(ev anvil.WriteEvent) {
+	if ev.Err != nil {
+		e.m.Add("write_errors", 1)
+	}
+
+	if ev.Removed {
+		e.m.Add("removes", 1)
+	} else {
+		e.m.Add("writes", 1)
+		e.m.Add("write_bytes", ev.Uncompressed)
+		e.m.Add("write_compressed_bytes", ev.Compressed)
+	}
+	e.m.Add("write_nanoseconds", int64(ev.Duration))
+	e.m.Add("sync_nanoseconds", int64(ev.Sync))
+}
+
+// Grow implements [anvil.Observer].
+func (e *Expvar) Grow(ev anvil.GrowEvent) {
+	if ev.Err != nil {
+		e.m.Add("grow_errors", 1)
+		return
+	}
+	e.m.Add("grows", 1)
+	e.m.Add("grow_bytes", ev.NewSize-ev.OldSize)
+}
+
+// Spill implements [anvil.Observer].
+func (e *Expvar) Spill(ev anvil.SpillEvent) {
+	if ev.Err != nil {
+		e.m.Add("spill_errors", 1)
+		return
+	}
+	e.m.Add("spills", 1)
+	e.m.Add("spill_bytes", ev.Size)
+}
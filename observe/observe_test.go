@@ -0,0 +1,64 @@
+package observe
+
+import (
+	"expvar"
+	"sync"
+	"testing"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type observeTest struct{}
+
+func TestObserve(t *testing.T) { is.SuiteP(t, &observeTest{}) }
+
+// use writes and reads an entry, and reads an entry that does not exist.
+func use(is is.Is, observer anvil.Observer) {
+	a, err := anvil.OpenFs(afero.NewMemMapFs(), anvil.Settings{Observer: observer})
+	is(err == nil, "unexpected error: %s", err)
+
+	err = a.Write(0, 0, []byte("hello"))
+	is(err == nil, "unexpected error: %s", err)
+	_, err = a.Read(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+	_, err = a.Read(1, 0)
+	is(err != nil, "missing entry was read")
+}
+
+func (*observeTest) TestExpvar(is is.Is) {
+	e := NewExpvarMap(new(expvar.Map))
+	use(is, e)
+
+	counters := map[string]int64{}
+	e.Map().Do(func(kv expvar.KeyValue) { counters[kv.Key] = kv.Value.(*expvar.Int).Value() })
+
+	is(counters["opens"] == 1 && counters["cache_hits"] == 2, "incorrect open counters: %v", counters)
+	is(counters["writes"] == 1 && counters["write_bytes"] == 5 && counters["write_compressed_bytes"] > 0, "incorrect write counters: %v", counters)
+	is(counters["reads"] == 1 && counters["read_bytes"] == 5 && counters["read_missing"] == 1, "incorrect read counters: %v", counters)
+	is(counters["grows"] == 1 && counters["grow_bytes"] == 3*anvil.SectionSize, "incorrect grow counters: %v", counters)
+}
+
+func (*observeTest) TestTracer(is is.Is) {
+	var mux sync.Mutex
+	var spans []Span
+	use(is, NewTracer(func(s Span) {
+		mux.Lock()
+		spans = append(spans, s)
+		mux.Unlock()
+	}))
+
+	names := map[string]int{}
+	for _, s := range spans {
+		names[s.Name]++
+		is(!s.End.Before(s.Start), "span ends before it starts: %+v", s)
+	}
+	is.Equal(names, map[string]int{"anvil.Open": 3, "anvil.Grow": 1, "anvil.Write": 1, "anvil.Read": 2}, "incorrect spans")
+
+	for _, s := range spans {
+		if s.Name == "anvil.Write" {
+			is(s.Err == nil && len(s.Attributes) > 2 && s.Attributes[0] == Attribute{"anvil.chunk.x", int64(0)}, "incorrect write span: %+v", s)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package observe contains [anvil.Observer] implementations that report
+// events using expvar counters or as tracing spans.
+package observe
+
+import (
+	"time"
+
+	"github.com/FireworkMC/anvil"
+)
+
+// Attribute a key-value pair attached to a [Span].
+// Values are int64, bool or string.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Span a completed operation.
+// Events that do not have a duration (evictions, grows and spills) are reported as spans
+// that start and end at the time they occurred.
+type Span struct {
+	// Name the name of the operation, e.g. `anvil.Read`.
+	Name       string
+	Start, End time.Time
+	Attributes []Attribute
+	Err        error
+}
+
+// Tracer an [anvil.Observer] that reports every event as a [Span].
+//
+// Spans are reported after the operation completes, so they can be converted
+// to OpenTelemetry spans by setting their timestamps explicitly:
+//
+//	observe.NewTracer(func(s observe.Span) {
+//		_, span := tracer.Start(ctx, s.Name, trace.WithTimestamp(s.Start), trace.WithAttributes(toOtel(s.Attributes)...))
+//		if s.Err != nil {
+//			span.RecordError(s.Err)
+//			span.SetStatus(codes.Error, s.Err.Error())
+//		}
+//		span.End(trace.WithTimestamp(s.End))
+//	})
+type Tracer struct {
+	fn func(Span)
+}
+
+var _ anvil.Observer = &Tracer{}
+
+// NewTracer creates a [Tracer] that calls `fn` for every span.
+// `fn` may be called concurrently from multiple goroutines.
+func NewTracer(fn func(Span)) *Tracer { return &Tracer{fn: fn} }
+
+func (t *Tracer) span(name string, start time.Time, d time.Duration, err error, attrs ...Attribute) {
+	t.fn(Span{Name: name, Start: start, End: start.Add(d), Attributes: attrs, Err: err})
+}
+
+// Open implements [anvil.Observer].
+func (t *Tracer) Open(e anvil.OpenEvent) {
+	t.span("anvil.Open", e.Start, e.Duration, e.Err, append(region(e.Region), Attribute{"anvil.cached", e.Cached})...)
+}
+
+// Close implements [anvil.Observer].
+func (t *Tracer) Close(e anvil.CloseEvent) {
+	t.span("anvil.Close", e.Start, e.Duration, e.Err, region(e.Region)...)
+}
+
+// Evict implements [anvil.Observer].
+func (t *Tracer) Evict(rg anvil.RegionPos) {
+	t.span("anvil.Evict", time.Now(), 0, nil, region(rg)...)
+}
+
+// Read implements [anvil.Observer].
+func (t *Tracer) Read(e anvil.ReadEvent) {
+	t.span("anvil.Read", e.Start, e.Duration, e.Err, append(chunk(e.Chunk),
+		Attribute{"anvil.raw", e.Raw}, Attribute{"anvil.external", e.External},
+		Attribute{"anvil.compressed_bytes", e.Compressed}, Attribute{"anvil.uncompressed_bytes", e.Uncompressed},
+	)...)
+}
+
+// Write implements [anvil.Observer].
+func (t *Tracer) Write(e anvil.WriteEvent) {
+	if e.Removed {
+		t.span("anvil.Remove", e.Start, e.Duration, e.Err, append(chunk(e.Chunk), Attribute{"anvil.sync_ns", int64(e.Sync)})...)
+		return
+	}
+
+	t.span("anvil.Write", e.Start, e.Duration, e.Err, append(chunk(e.Chunk),
+		Attribute{"anvil.raw", e.Raw}, Attribute{"anvil.external", e.External},
+		Attribute{"anvil.compressed_bytes", e.Compressed}, Attribute{"anvil.uncompressed_bytes", e.Uncompressed},
+		Attribute{"anvil.sync_ns", int64(e.Sync)},
+	)...)
+}
+
+// Grow implements [anvil.Observer].
+func (t *Tracer) Grow(e anvil.GrowEvent) {
+	t.span("anvil.Grow", time.Now(), 0, e.Err, append(region(e.Region),
+		Attribute{"anvil.old_size", e.OldSize}, Attribute{"anvil.new_size", e.NewSize},
+	)...)
+}
+
+// Spill implements [anvil.Observer].
+func (t *Tracer) Spill(e anvil.SpillEvent) {
+	t.span("anvil.Spill", time.Now(), 0, e.Err, append(chunk(e.Chunk), Attribute{"anvil.size", e.Size})...)
+}
+
+func region(rg anvil.RegionPos) []Attribute {
+	return []Attribute{{"anvil.region.x", int64(rg.X)}, {"anvil.region.z", int64(rg.Z)}}
+}
+
+func chunk(c anvil.ChunkPos) []Attribute {
+	return []Attribute{{"anvil.chunk.x", int64(c.X)}, {"anvil.chunk.z", int64(c.Z)}}
+}
@@ -0,0 +1,170 @@
+package anvil
+
+import (
+	"io"
+	"time"
+)
+
+// Observer receives events from [Anvil] and the anvil files it opens.
+// Methods are called synchronously after the operation completes, possibly while a lock is held,
+// and may be called concurrently from multiple goroutines.
+// Implementations should return quickly and must not call methods of the [Anvil] or [File]
+// that reported the event.
+// Embed [NopObserver] to only handle some events.
+type Observer interface {
+	// Open called when [Anvil] gets an anvil file, or when [OpenFile] opens one.
+	Open(e OpenEvent)
+	// Close called when an anvil file is closed.
+	Close(e CloseEvent)
+	// Evict called when [Anvil] evicts an unused anvil file from its cache.
+	// [Observer.Close] is called after the file is closed.
+	Evict(region RegionPos)
+	// Read called after an entry was read.
+	Read(e ReadEvent)
+	// Write called after an entry was written or removed.
+	Write(e WriteEvent)
+	// Grow called when an anvil file is grown to make space for an entry.
+	Grow(e GrowEvent)
+	// Spill called when an entry is too large to fit in an anvil file and is stored in an external file.
+	Spill(e SpillEvent)
+}
+
+// OpenEvent the event passed to [Observer.Open].
+type OpenEvent struct {
+	Region RegionPos
+	// Cached if the file was already open or in the cache of the [Anvil].
+	Cached   bool
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// CloseEvent the event passed to [Observer.Close].
+type CloseEvent struct {
+	Region   RegionPos
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// ReadEvent the event passed to [Observer.Read].
+type ReadEvent struct {
+	Chunk ChunkPos
+	// Raw if the compressed data was read using ReadRaw.
+	Raw bool
+	// External if the entry is stored in an external file.
+	External bool
+	// Compressed the number of compressed bytes read.
+	Compressed int64
+	// Uncompressed the number of uncompressed bytes read. This is 0 for raw reads.
+	Uncompressed int64
+	// Start the time the read started.
+	// For reads that use a callback, Duration includes the time spent in the callback.
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// WriteEvent the event passed to [Observer.Write].
+type WriteEvent struct {
+	Chunk ChunkPos
+	// Raw if already compressed data was written using WriteRaw.
+	Raw bool
+	// Removed if the entry was removed.
+	Removed bool
+	// External if the entry was stored in an external file.
+	External bool
+	// Compressed the size of the compressed data.
+	Compressed int64
+	// Uncompressed the size of the uncompressed data. This is 0 for raw writes.
+	Uncompressed int64
+	Start        time.Time
+	Duration     time.Duration
+	// Sync the time spent syncing the file to disk.
+	Sync time.Duration
+	Err  error
+}
+
+// GrowEvent the event passed to [Observer.Grow].
+type GrowEvent struct {
+	Region RegionPos
+	// OldSize, NewSize the size of the file in bytes before and after it was grown.
+	OldSize, NewSize int64
+	Err              error
+}
+
+// SpillEvent the event passed to [Observer.Spill].
+type SpillEvent struct {
+	Chunk ChunkPos
+	// Size the size of the compressed data written to the external file.
+	Size int64
+	Err  error
+}
+
+// NopObserver an [Observer] that ignores all events.
+type NopObserver struct{}
+
+var _ Observer = NopObserver{}
+
+// Open implements [Observer].
+func (NopObserver) Open(OpenEvent) {}
+
+// Close implements [Observer].
+func (NopObserver) Close(CloseEvent) {}
+
+// Evict implements [Observer].
+func (NopObserver) Evict(RegionPos) {}
+
+// Read implements [Observer].
+func (NopObserver) Read(ReadEvent) {}
+
+// Write implements [Observer].
+func (NopObserver) Write(WriteEvent) {}
+
+// Grow implements [Observer].
+func (NopObserver) Grow(GrowEvent) {}
+
+// Spill implements [Observer].
+func (NopObserver) Spill(SpillEvent) {}
+
+// countingReader counts the number of bytes read from the underlying reader.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return
+}
+
+// observedReader reports a [ReadEvent] when it is closed.
+type observedReader struct {
+	countingReader
+	raw      *countingReader
+	event    ReadEvent
+	observer Observer
+	err      error
+}
+
+func (r *observedReader) Read(p []byte) (n int, err error) {
+	if n, err = r.countingReader.Read(p); err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return
+}
+
+func (r *observedReader) Close() (err error) {
+	err = r.countingReader.Close()
+	if r.observer != nil {
+		r.event.Compressed, r.event.Uncompressed = r.raw.n, r.n
+		r.event.Duration = time.Since(r.event.Start)
+		if r.event.Err = r.err; r.event.Err == nil {
+			r.event.Err = err
+		}
+		r.observer.Read(r.event)
+		r.observer = nil
+	}
+	return
+}
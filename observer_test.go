@@ -0,0 +1,107 @@
+package anvil
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/errors"
+	"github.com/yehan2002/is/v2"
+)
+
+// recorder an observer that records every event.
+type recorder struct {
+	mux    sync.Mutex
+	opens  []OpenEvent
+	closes []CloseEvent
+	evicts []RegionPos
+	reads  []ReadEvent
+	writes []WriteEvent
+	grows  []GrowEvent
+	spills []SpillEvent
+}
+
+func (r *recorder) Open(e OpenEvent)   { r.mux.Lock(); r.opens = append(r.opens, e); r.mux.Unlock() }
+func (r *recorder) Close(e CloseEvent) { r.mux.Lock(); r.closes = append(r.closes, e); r.mux.Unlock() }
+func (r *recorder) Evict(rg RegionPos) { r.mux.Lock(); r.evicts = append(r.evicts, rg); r.mux.Unlock() }
+func (r *recorder) Read(e ReadEvent)   { r.mux.Lock(); r.reads = append(r.reads, e); r.mux.Unlock() }
+func (r *recorder) Write(e WriteEvent) { r.mux.Lock(); r.writes = append(r.writes, e); r.mux.Unlock() }
+func (r *recorder) Grow(e GrowEvent)   { r.mux.Lock(); r.grows = append(r.grows, e); r.mux.Unlock() }
+func (r *recorder) Spill(e SpillEvent) { r.mux.Lock(); r.spills = append(r.spills, e); r.mux.Unlock() }
+
+type observerTest struct{}
+
+func TestObserver(t *testing.T) { is.SuiteP(t, &observerTest{}) }
+
+func (*observerTest) open(is is.Is, cacheSize int) (*Anvil, *recorder) {
+	r := &recorder{}
+	a, err := OpenFs(afero.NewMemMapFs(), Settings{CacheSize: cacheSize, Observer: r})
+	is(err == nil, "unexpected error: %s", err)
+	return a, r
+}
+
+func (o *observerTest) TestCache(is is.Is) {
+	a, r := o.open(is, 1)
+
+	for _, x := range []int32{0, 1, 40} {
+		err := a.Write(x, 0, []byte{1})
+		is(err == nil, "unexpected error: %s", err)
+	}
+
+	is(len(r.opens) == 3, "incorrect number of open events: %d", len(r.opens))
+	is(!r.opens[0].Cached && r.opens[1].Cached && !r.opens[2].Cached, "incorrect open events: %+v", r.opens)
+	is(r.opens[2].Region == RegionPos{X: 1}, "incorrect region: %+v", r.opens[2].Region)
+
+	is.Equal(r.evicts, []RegionPos{{}}, "incorrect evict events")
+	is(len(r.closes) == 1 && r.closes[0].Region == RegionPos{} && r.closes[0].Err == nil, "incorrect close events: %+v", r.closes)
+}
+
+func (o *observerTest) TestReadWrite(is is.Is) {
+	a, r := o.open(is, 0)
+
+	data := bytes.Repeat([]byte("anvil"), 1000)
+	err := a.Write(33, -1, data)
+	is(err == nil, "unexpected error: %s", err)
+
+	is(len(r.writes) == 1, "incorrect number of write events: %d", len(r.writes))
+	w := r.writes[0]
+	is(w.Chunk == ChunkPos{X: 33, Z: -1} && w.Uncompressed == int64(len(data)), "incorrect write event: %+v", w)
+	is(w.Compressed > 0 && w.Compressed < w.Uncompressed && w.Err == nil && !w.Start.IsZero(), "incorrect write event: %+v", w)
+	is(len(r.grows) == 1 && r.grows[0].OldSize == 0 && r.grows[0].NewSize == 3*SectionSize, "incorrect grow events: %+v", r.grows)
+
+	err = a.ReadFn(33, -1, func(src io.Reader) error { _, err := io.Copy(io.Discard, src); return err })
+	is(err == nil, "unexpected error: %s", err)
+	raw, _, err := a.ReadRaw(33, -1)
+	is(err == nil, "unexpected error: %s", err)
+	_, err = a.Read(0, 0)
+	is(errors.Is(err, ErrNotExist), "incorrect error: %s", err)
+
+	is(len(r.reads) == 3, "incorrect number of read events: %d", len(r.reads))
+	is(r.reads[0].Uncompressed == int64(len(data)) && r.reads[0].Compressed == w.Compressed, "incorrect read event: %+v", r.reads[0])
+	is(r.reads[1].Raw && r.reads[1].Compressed == int64(len(raw)) && r.reads[1].Uncompressed == 0, "incorrect raw read event: %+v", r.reads[1])
+	is(errors.Is(r.reads[2].Err, ErrNotExist), "incorrect read event: %+v", r.reads[2])
+
+	err = a.Remove(33, -1)
+	is(err == nil, "unexpected error: %s", err)
+	is(len(r.writes) == 2 && r.writes[1].Removed, "incorrect remove event: %+v", r.writes)
+}
+
+func (o *observerTest) TestSpill(is is.Is) {
+	a, r := o.open(is, 0)
+
+	data := make([]byte, 256*SectionSize)
+	for i := range data {
+		data[i] = byte(i * 7919 >> 3)
+	}
+
+	err := a.WriteWithOptions(0, 0, data, WriteOptions{Compression: CompressionNone})
+	is(err == nil, "unexpected error: %s", err)
+	is(len(r.spills) == 1 && r.spills[0].Size == int64(len(data)) && r.spills[0].Err == nil, "incorrect spill events: %+v", r.spills)
+	is(len(r.writes) == 1 && r.writes[0].External, "incorrect write events: %+v", r.writes)
+
+	_, err = a.Read(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+	is(len(r.reads) == 1 && r.reads[0].External && r.reads[0].Uncompressed == int64(len(data)), "incorrect read events: %+v", r.reads)
+}
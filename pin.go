@@ -0,0 +1,73 @@
+package anvil
+
+import (
+	"github.com/yehan2002/errors"
+)
+
+// DefaultMaxPinned the default value for [Settings.MaxPinned].
+const DefaultMaxPinned = 16
+
+// ErrPinLimit returned by [Anvil.Pin] if [Settings.MaxPinned] anvil files are already pinned.
+const ErrPinLimit = errors.Const("anvil: too many pinned anvil files")
+
+// Pin opens the anvil file at rgX, rgZ and keeps it open until [Anvil.Unpin] is called.
+// Pinned files are never evicted from the cache and do not count towards [Settings.CacheSize];
+// instead, at most [Settings.MaxPinned] files can be pinned at a time.
+// This can be used to keep frequently accessed files, such as the files around the spawn, open.
+// Pinning a file that is already pinned does nothing.
+// The anvil file is created if it does not exist unless [Settings.ReadOnly] is set.
+func (a *Anvil) Pin(rgX, rgZ int32) (err error) {
+	rg := pos{rgX, rgZ}
+
+	a.pinMux.Lock()
+	defer a.pinMux.Unlock()
+
+	if _, ok := a.pinned[rg]; ok {
+		return nil
+	}
+
+	if a.settings.MaxPinned >= 0 && len(a.pinned) >= a.settings.MaxPinned {
+		return ErrPinLimit
+	}
+
+	// the file is kept open by not freeing it until it is unpinned.
+	var f *file
+	if f, err = a.get(rgX, rgZ); err != nil {
+		return err
+	}
+
+	if a.pinned == nil {
+		a.pinned = map[pos]*file{}
+	}
+	a.pinned[rg] = f
+	return nil
+}
+
+// Unpin unpins the anvil file at rgX, rgZ.
+// The file is moved to the cache, where it is evicted like any other file.
+// Unpinning a file that is not pinned does nothing.
+func (a *Anvil) Unpin(rgX, rgZ int32) (err error) {
+	rg := pos{rgX, rgZ}
+
+	a.pinMux.Lock()
+	defer a.pinMux.Unlock()
+
+	f, ok := a.pinned[rg]
+	if !ok {
+		return nil
+	}
+	delete(a.pinned, rg)
+	return a.free(f)
+}
+
+// Pinned returns the positions of the pinned anvil files.
+func (a *Anvil) Pinned() (regions []RegionPos) {
+	a.pinMux.Lock()
+	defer a.pinMux.Unlock()
+
+	regions = make([]RegionPos, 0, len(a.pinned))
+	for rg := range a.pinned {
+		regions = append(regions, rg.region())
+	}
+	return regions
+}
@@ -0,0 +1,65 @@
+package anvil
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type pinTest struct{}
+
+func TestPin(t *testing.T) { is.SuiteP(t, &pinTest{}) }
+
+// evictObserver records the anvil files that were evicted.
+type evictObserver struct {
+	NopObserver
+	mux     sync.Mutex
+	evicted map[RegionPos]int
+}
+
+func (e *evictObserver) Evict(rg RegionPos) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.evicted == nil {
+		e.evicted = map[RegionPos]int{}
+	}
+	e.evicted[rg]++
+}
+
+func (*pinTest) TestPin(is is.Is) {
+	observer := &evictObserver{}
+	a, err := OpenFs(afero.NewMemMapFs(), Settings{CacheSize: 1, MaxPinned: 2, Observer: observer})
+	is(err == nil, "unexpected error: %s", err)
+
+	is(a.Pin(0, 0) == nil, "unexpected error")
+	is(a.Pin(0, 0) == nil, "pinning a pinned file should do nothing")
+	is(a.Pin(1, 0) == nil, "unexpected error")
+	is(errors.Is(a.Pin(2, 0), ErrPinLimit), "pin limit was not enforced")
+
+	pinned := a.Pinned()
+	is(len(pinned) == 2, "incorrect pinned files: %v", pinned)
+
+	// access enough files to evict every file in the cache
+	for x := int32(0); x < 8; x++ {
+		is(a.Write(x*32, 0, []byte{byte(x + 1)}) == nil, "unexpected error")
+	}
+	is(observer.evicted[RegionPos{0, 0}] == 0 && observer.evicted[RegionPos{1, 0}] == 0, "pinned file was evicted")
+	is(a.cached(pos{0, 0}) && a.cached(pos{1, 0}), "pinned file was closed")
+
+	is(a.Unpin(0, 0) == nil, "unexpected error")
+	is(a.Unpin(0, 0) == nil, "unpinning a file that is not pinned should do nothing")
+	is(a.Pin(2, 0) == nil, "unexpected error")
+
+	// unpinned files are evicted like any other file
+	is(a.Write(7*32, 0, []byte{1}) == nil, "unexpected error")
+	is(observer.evicted[RegionPos{0, 0}] == 1, "unpinned file was not evicted")
+
+	data, err := a.Read(0, 0)
+	is(err == nil && data[0] == 1, "incorrect data: %v %s", data, err)
+
+	is(a.Close() == nil, "unexpected error")
+	is(len(a.Pinned()) == 0, "files were pinned after close")
+}
@@ -0,0 +1,217 @@
+package anvil
+
+import (
+	"context"
+	"sync"
+
+	"github.com/yehan2002/errors"
+)
+
+const (
+	// DefaultPrefetchWorkers the default value for [Settings.PrefetchWorkers].
+	DefaultPrefetchWorkers = 2
+	// DefaultPrefetchQueueSize the default value for [Settings.PrefetchQueueSize].
+	DefaultPrefetchQueueSize = 64
+)
+
+// ErrPrefetchFull returned by [Anvil.Prefetch] if [Settings.PrefetchQueueSize] anvil files are already queued.
+const ErrPrefetchFull = errors.Const("anvil: prefetch queue is full")
+
+// PrefetchOptions options for [Anvil.Prefetch].
+type PrefetchOptions struct {
+	// Warm if the data of every entry should be read after the file is opened,
+	// so that it is in the page cache of the operating system.
+	// Default: false
+	Warm bool
+}
+
+// Prefetch queues the anvil file at rgX, rgZ to be opened by a background worker, so that the
+// first access to it does not wait for the file to be opened and for its header to be read.
+// The opened file is kept in the cache like any other file, so prefetching does nothing if the cache is disabled.
+// Anvil files that do not exist are not created.
+//
+// This does not block: if [Settings.PrefetchQueueSize] files are queued, this returns [ErrPrefetchFull].
+// Files that are already queued or already open are ignored unless [PrefetchOptions.Warm] is set.
+// The request is dropped if `ctx` is done before a worker starts it.
+// Errors that occur while prefetching are ignored. Errors opening files are reported to [Settings.Observer].
+func (a *Anvil) Prefetch(ctx context.Context, rgX, rgZ int32, opt ...PrefetchOptions) error {
+	var options PrefetchOptions
+	if len(opt) == 1 {
+		options = opt[0]
+	}
+	return a.prefetch.put(ctx, pos{rgX, rgZ}, options)
+}
+
+// PrefetchArea is the same as [Anvil.Prefetch] but prefetches every anvil file
+// within `radius` files of rgX, rgZ, starting with the closest files.
+// This stops at the first error.
+func (a *Anvil) PrefetchArea(ctx context.Context, rgX, rgZ, radius int32, opt ...PrefetchOptions) (err error) {
+	for d := int32(0); d <= radius && err == nil; d++ {
+		// prefetch the ring of files that are `d` files away
+		for x := -d; x <= d && err == nil; x++ {
+			for z := -d; z <= d && err == nil; z++ {
+				if x == -d || x == d || z == -d || z == d {
+					err = a.Prefetch(ctx, rgX+x, rgZ+z, opt...)
+				}
+			}
+		}
+	}
+	return
+}
+
+// prefetchRequest a request to prefetch an anvil file.
+type prefetchRequest struct {
+	ctx     context.Context
+	rg      pos
+	options PrefetchOptions
+}
+
+// prefetcher the workers used by [Anvil.Prefetch].
+type prefetcher struct {
+	anvil *Anvil
+
+	mux sync.Mutex
+	// queued the files that are queued.
+	queued   map[pos]struct{}
+	requests chan prefetchRequest
+	started  bool
+	closed   bool
+
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+func newPrefetcher(a *Anvil) *prefetcher {
+	return &prefetcher{
+		anvil:    a,
+		queued:   map[pos]struct{}{},
+		requests: make(chan prefetchRequest, a.settings.PrefetchQueueSize),
+		stop:     make(chan struct{}),
+	}
+}
+
+// put queues the given file.
+func (p *prefetcher) put(ctx context.Context, rg pos, options PrefetchOptions) error {
+	if p.anvil.policy == nil {
+		return nil
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+
+	if _, ok := p.queued[rg]; ok {
+		return nil
+	} else if !options.Warm && p.anvil.cached(rg) {
+		return nil
+	}
+
+	if !p.started {
+		p.started = true
+		for i := 0; i < p.anvil.settings.PrefetchWorkers; i++ {
+			p.workers.Add(1)
+			go p.work()
+		}
+	}
+
+	select {
+	case p.requests <- prefetchRequest{ctx: ctx, rg: rg, options: options}:
+		p.queued[rg] = struct{}{}
+		return nil
+	default:
+		return ErrPrefetchFull
+	}
+}
+
+// work prefetches queued files until the prefetcher is closed.
+func (p *prefetcher) work() {
+	defer p.workers.Done()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case r := <-p.requests:
+			p.mux.Lock()
+			delete(p.queued, r.rg)
+			p.mux.Unlock()
+
+			if r.ctx.Err() == nil {
+				p.prefetch(r)
+			}
+		}
+	}
+}
+
+// prefetch opens the requested file and warms it if requested.
+func (p *prefetcher) prefetch(r prefetchRequest) {
+	// avoid creating files that do not exist
+	if exists, err := p.anvil.exists(r.rg); err != nil || !exists {
+		return
+	}
+
+	f, err := p.anvil.get(r.rg.x, r.rg.z)
+	if err != nil {
+		return
+	}
+
+	if r.options.Warm {
+		f.warm(r.ctx)
+	}
+	p.anvil.free(f)
+}
+
+// close stops the workers. Queued requests are dropped.
+func (p *prefetcher) close() {
+	p.mux.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.stop)
+	}
+	p.mux.Unlock()
+
+	p.workers.Wait()
+}
+
+// warm reads the sections used by every entry, so that they are in the page cache of the operating system.
+// The read lock is only held while each entry is read, so writes are not blocked until every entry is read.
+func (a *file) warm(ctx context.Context) error {
+	tmp := sectionPool.Get().(*section)
+	defer tmp.Free()
+
+	for i := 0; i < Entries; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := a.warmEntry(i, tmp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warmEntry reads the sections used by the i-th entry into `tmp`.
+func (a *file) warmEntry(i int, tmp *section) error {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+
+	if a.header == nil {
+		return ErrClosed
+	}
+
+	entry := a.header.entries[i]
+	if !entry.Exists() {
+		return nil
+	}
+
+	for s := int64(0); s < entry.CompressedSize(); s++ {
+		if _, err := a.reader.ReadAt(tmp[:], (entry.Offset()+s)*SectionSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
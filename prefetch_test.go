@@ -0,0 +1,101 @@
+package anvil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type prefetchTest struct{}
+
+func TestPrefetch(t *testing.T) { is.SuiteP(t, &prefetchTest{}) }
+
+// openObserver records the events passed to [Observer.Open].
+type openObserver struct {
+	NopObserver
+	mux    sync.Mutex
+	events []OpenEvent
+}
+
+func (o *openObserver) Open(e OpenEvent) {
+	o.mux.Lock()
+	o.events = append(o.events, e)
+	o.mux.Unlock()
+}
+
+func (o *openObserver) opened(rg RegionPos) (opened, cached bool) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	for _, e := range o.events {
+		if e.Region == rg {
+			if !e.Cached {
+				opened = true
+			} else {
+				cached = true
+			}
+		}
+	}
+	return
+}
+
+func (*prefetchTest) TestPrefetch(is is.Is) {
+	fs := afero.NewMemMapFs()
+	a, err := OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+	for x := int32(-1); x <= 1; x++ {
+		is(a.Write(x*32, 0, []byte{byte(x + 2)}) == nil, "unexpected error")
+	}
+	is(a.Close() == nil, "unexpected error")
+
+	observer := &openObserver{}
+	a, err = OpenFs(fs, Settings{Observer: observer})
+	is(err == nil, "unexpected error: %s", err)
+	is(a.PrefetchArea(context.Background(), 0, 0, 1, PrefetchOptions{Warm: true}) == nil, "unexpected error")
+
+	for x := int32(-1); x <= 1; x++ {
+		rg := RegionPos{X: x}
+		deadline := time.Now().Add(10 * time.Second)
+		for opened, _ := observer.opened(rg); !opened; opened, _ = observer.opened(rg) {
+			is(time.Now().Before(deadline), "region %d was not prefetched", x)
+			time.Sleep(time.Millisecond)
+		}
+
+		data, err := a.Read(x*32, 0)
+		is(err == nil && data[0] == byte(x+2), "incorrect data: %v %s", data, err)
+		_, cached := observer.opened(rg)
+		is(cached, "prefetched region %d was not cached", x)
+	}
+
+	// regions that do not exist are not created
+	exists, err := a.RegionExists(1, 1)
+	is(err == nil && !exists, "prefetching created a region")
+
+	is(a.Close() == nil, "unexpected error")
+	is(errors.Is(a.Prefetch(context.Background(), 0, 0), ErrClosed), "prefetch was queued after close")
+}
+
+func (*prefetchTest) TestFull(is is.Is) {
+	fs := &blockingFs{Fs: afero.NewMemMapFs(), name: "r.0.0.mca", opened: make(chan struct{}), unblock: make(chan struct{})}
+	a, err := OpenFs(fs, Settings{PrefetchWorkers: 1, PrefetchQueueSize: 1})
+	is(err == nil, "unexpected error: %s", err)
+	is(afero.WriteFile(fs.Fs, "r.0.0.mca", nil, 0o666) == nil, "unexpected error")
+	is(afero.WriteFile(fs.Fs, "r.1.0.mca", nil, 0o666) == nil, "unexpected error")
+	is(afero.WriteFile(fs.Fs, "r.2.0.mca", nil, 0o666) == nil, "unexpected error")
+
+	ctx := context.Background()
+	is(a.Prefetch(ctx, 0, 0) == nil, "unexpected error")
+	<-fs.opened
+
+	// the worker is blocked opening r.0.0.mca
+	is(a.Prefetch(ctx, 1, 0) == nil, "unexpected error")
+	is(a.Prefetch(ctx, 1, 0) == nil, "queued files should be ignored")
+	is(errors.Is(a.Prefetch(ctx, 2, 0), ErrPrefetchFull), "queue was not full")
+
+	close(fs.unblock)
+	is(a.Close() == nil, "unexpected error")
+}
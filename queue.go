@@ -0,0 +1,411 @@
+package anvil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAsyncWorkers the default value for [Settings.AsyncWorkers].
+	DefaultAsyncWorkers = 2
+	// DefaultAsyncQueueSize the default value for [Settings.AsyncQueueSize].
+	DefaultAsyncQueueSize = 1024
+)
+
+// AsyncError an error that occurred while writing an entry queued by [Anvil.WriteAsync].
+// If the error occurred while opening or closing an anvil file,
+// Pos is the position of the first entry in the file.
+type AsyncError struct {
+	Pos ChunkPos
+	Err error
+}
+
+func (a *AsyncError) Error() string {
+	return fmt.Sprintf("anvil: WriteAsync: (%d,%d): %s", a.Pos.X, a.Pos.Z, a.Err)
+}
+
+func (a *AsyncError) Unwrap() error { return a.Err }
+
+// AsyncErrors the errors returned by [Anvil.Flush] and [Anvil.Close].
+type AsyncErrors []*AsyncError
+
+func (a AsyncErrors) Error() string {
+	if len(a) == 1 {
+		return a[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", a[0], len(a)-1)
+}
+
+// Unwrap returns the errors as a slice of errors.
+func (a AsyncErrors) Unwrap() []error {
+	errs := make([]error, len(a))
+	for i, err := range a {
+		errs[i] = err
+	}
+	return errs
+}
+
+// WriteAsync queues the chunk data for the given location to be written by background workers.
+// If the entry is already queued, the queued data is replaced, so repeated writes to the same
+// entry are coalesced into a single write. `p` is copied and can be reused once this returns.
+// Calling this function with an empty buffer queues the removal of the entry.
+//
+// Entries are written by up to [Settings.AsyncWorkers] workers, each of which writes the queued entries
+// of one anvil file at a time, after waiting for at least [Settings.AsyncDelay].
+// This blocks while [Settings.AsyncQueueSize] entries are queued.
+// Errors that occur while writing are returned by [Anvil.Flush] and [Anvil.Close].
+// Queued entries are written like entries written using [Anvil.Write]: coalescing reduces the number of
+// writes, but every entry that is written is still synced separately.
+//
+// Writes and removes made using [Anvil.Write], [Anvil.WriteRaw], [Anvil.Remove] and the files returned by
+// [Anvil.File] discard the data queued for the entry before writing it, and [WalkModify], [Recompress]
+// and [Merge] wait for the queued entry to be written before reading and modifying it,
+// so queued data never overwrites data written synchronously.
+// [Anvil.Read], [Anvil.ReadTo] and [Anvil.ReadFn] return the queued data,
+// and [Anvil.ReadRaw] and [Anvil.Info] wait for the queued entry to be written.
+// Other reads, including reads using [Anvil.File], [Walk] and [Anvil.Snapshot], do not see queued data until it is written.
+func (a *Anvil) WriteAsync(entryX, entryZ int32, p []byte) error {
+	if a.settings.ReadOnly {
+		return ErrReadOnly
+	}
+
+	var data []byte
+	if len(p) != 0 {
+		data = append([]byte(nil), p...)
+	}
+	return a.queue.put(ChunkPos{X: entryX, Z: entryZ}, data)
+}
+
+// Flush waits until every entry queued by [Anvil.WriteAsync] before Flush was called is written.
+// Queued entries are written without waiting for [Settings.AsyncDelay].
+// This returns the errors that occurred while writing queued entries since the last call to Flush as [AsyncErrors].
+func (a *Anvil) Flush() error {
+	a.queue.wait(func(ChunkPos) bool { return true })
+	return a.queue.errors()
+}
+
+// queued the data queued for an entry.
+type queued struct {
+	// data the data to write. This is nil if the entry is removed.
+	data      []byte
+	timestamp time.Time
+	// seq the order in which entries were queued.
+	seq uint64
+}
+
+// queuedRegion the entries queued for an anvil file.
+type queuedRegion struct {
+	entries map[ChunkPos]*queued
+	// since when the first entry was queued.
+	since time.Time
+}
+
+// writeQueue the queue used by [Anvil.WriteAsync].
+type writeQueue struct {
+	anvil *Anvil
+
+	mux  sync.Mutex
+	cond sync.Cond
+
+	// latest the latest data queued for each entry, including entries that are being written.
+	latest map[ChunkPos]*queued
+	// pending the entries that are not being written yet, by anvil file.
+	pending map[RegionPos]*queuedRegion
+	// size the number of entries in `pending`.
+	size int
+	// busy the anvil files that are being written.
+	busy map[RegionPos]bool
+
+	seq uint64
+	// urgent the number of callers waiting for entries to be written.
+	// [Settings.AsyncDelay] is ignored while this is not 0.
+	urgent int
+	timer  *time.Timer
+
+	started bool
+	closed  bool
+	workers sync.WaitGroup
+
+	errs AsyncErrors
+}
+
+func newWriteQueue(a *Anvil) *writeQueue {
+	q := &writeQueue{anvil: a, latest: map[ChunkPos]*queued{}, pending: map[RegionPos]*queuedRegion{}, busy: map[RegionPos]bool{}}
+	q.cond.L = &q.mux
+	return q
+}
+
+// put queues the given data for the entry at pos.
+func (q *writeQueue) put(pos ChunkPos, data []byte) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if !q.started {
+		q.started = true
+		for i := 0; i < q.anvil.settings.AsyncWorkers; i++ {
+			q.workers.Add(1)
+			go q.work()
+		}
+	}
+
+	// wait for space unless the entry is already queued
+	rg := pos.Region()
+	for !q.closed && q.size >= q.anvil.settings.AsyncQueueSize {
+		if r, ok := q.pending[rg]; ok && r.entries[pos] != nil {
+			break
+		}
+		q.cond.Wait()
+	}
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	r, ok := q.pending[rg]
+	if !ok {
+		r = &queuedRegion{entries: map[ChunkPos]*queued{}, since: time.Now()}
+		q.pending[rg] = r
+	}
+	if r.entries[pos] == nil {
+		q.size++
+	}
+
+	q.seq++
+	e := &queued{data: data, timestamp: time.Now(), seq: q.seq}
+	r.entries[pos], q.latest[pos] = e, e
+
+	q.cond.Broadcast()
+	return nil
+}
+
+// get returns the latest data queued for the entry at pos.
+// The returned data is nil if the removal of the entry is queued.
+// The returned slice must not be modified.
+func (q *writeQueue) get(pos ChunkPos) (data []byte, ok bool) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	var e *queued
+	if e, ok = q.latest[pos]; ok {
+		data = e.data
+	}
+	return
+}
+
+// read calls fn with a reader that reads the data queued for the entry at pos, if any.
+func (q *writeQueue) read(pos ChunkPos, fn func(io.Reader) error) (ok bool, err error) {
+	var data []byte
+	if data, ok = q.get(pos); !ok {
+		return false, nil
+	} else if data == nil {
+		return true, ErrNotExist
+	}
+	return true, fn(bytes.NewReader(data))
+}
+
+// wait waits until the entries that match `fn` and were queued before wait was called are written.
+func (q *writeQueue) wait(fn func(ChunkPos) bool) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	target := q.seq
+	q.urgent++
+	defer func() { q.urgent-- }()
+	q.cond.Broadcast()
+
+	for {
+		queued := false
+		for pos, e := range q.latest {
+			if e.seq <= target && fn(pos) {
+				queued = true
+				break
+			}
+		}
+
+		if !queued {
+			return
+		}
+		q.cond.Wait()
+	}
+}
+
+// discard removes the data queued for the entry at pos and waits until the anvil file
+// that contains it is no longer being written, so that the queued data is not written
+// after data that is written synchronously.
+func (q *writeQueue) discard(pos ChunkPos) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if _, ok := q.latest[pos]; !ok {
+		return
+	}
+	delete(q.latest, pos)
+
+	rg := pos.Region()
+	if r, ok := q.pending[rg]; ok && r.entries[pos] != nil {
+		delete(r.entries, pos)
+		q.size--
+		if len(r.entries) == 0 {
+			delete(q.pending, rg)
+		}
+		// there is space in the queue, and callers of wait may be waiting for the entry
+		q.cond.Broadcast()
+	}
+
+	// an older version of the entry may be being written
+	for q.busy[rg] {
+		q.cond.Wait()
+	}
+}
+
+// discardQueued discards the data queued by [Anvil.WriteAsync] for the entry at x,z
+// before the entry is written synchronously, see [writeQueue.discard].
+// This does nothing if the file was not opened by an [Anvil].
+func (a *file) discardQueued(x, z uint8) {
+	if a.cache != nil {
+		a.cache.queue.discard(a.pos.chunk(x, z))
+	}
+}
+
+// waitQueued waits until the data queued by [Anvil.WriteAsync] for the entry at x,z is written,
+// so that an entry that is read and then modified is not overwritten by older queued data.
+// This does nothing if the file was not opened by an [Anvil].
+func (a *file) waitQueued(x, z uint8) {
+	if a.cache != nil {
+		pos := a.pos.chunk(x, z)
+		a.cache.queue.wait(func(p ChunkPos) bool { return p == pos })
+	}
+}
+
+// errors returns the errors that occurred since the last call to errors.
+func (q *writeQueue) errors() error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if errs := q.errs; len(errs) != 0 {
+		q.errs = nil
+		return errs
+	}
+	return nil
+}
+
+// close writes all queued entries and stops the workers.
+func (q *writeQueue) close() error {
+	q.mux.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mux.Unlock()
+
+	q.workers.Wait()
+	return q.errors()
+}
+
+// work writes queued entries until the queue is closed.
+func (q *writeQueue) work() {
+	defer q.workers.Done()
+
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	for {
+		rg, r, wait := q.next()
+		if r == nil {
+			if q.closed && len(q.pending) == 0 {
+				return
+			}
+
+			if wait > 0 && q.timer == nil {
+				q.timer = time.AfterFunc(wait, func() {
+					q.mux.Lock()
+					q.timer = nil
+					q.cond.Broadcast()
+					q.mux.Unlock()
+				})
+			}
+			q.cond.Wait()
+			continue
+		}
+
+		delete(q.pending, rg)
+		q.size -= len(r.entries)
+		q.busy[rg] = true
+		// there is space in the queue
+		q.cond.Broadcast()
+
+		q.mux.Unlock()
+		errs := q.write(rg, r.entries)
+		q.mux.Lock()
+
+		delete(q.busy, rg)
+		for pos, e := range r.entries {
+			// the entry may have been queued again while it was being written
+			if q.latest[pos] == e {
+				delete(q.latest, pos)
+			}
+		}
+		q.errs = append(q.errs, errs...)
+		q.cond.Broadcast()
+	}
+}
+
+// next returns the anvil file that was queued first out of the files that are ready to be written
+// and are not being written by another worker.
+// If no file is ready, this returns the time until the next file is ready.
+// Callers must hold the lock.
+func (q *writeQueue) next() (rg RegionPos, r *queuedRegion, wait time.Duration) {
+	delay := q.anvil.settings.AsyncDelay
+	if q.urgent > 0 || q.closed {
+		delay = 0
+	}
+
+	now := time.Now()
+	for pos, p := range q.pending {
+		if q.busy[pos] {
+			continue
+		}
+
+		if d := delay - now.Sub(p.since); d > 0 {
+			if wait == 0 || d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		if r == nil || p.since.Before(r.since) {
+			rg, r = pos, p
+		}
+	}
+	return
+}
+
+// write writes the given entries to the anvil file at rg.
+func (q *writeQueue) write(rg RegionPos, entries map[ChunkPos]*queued) (errs AsyncErrors) {
+	f, err := q.anvil.get(rg.X, rg.Z)
+	if err != nil {
+		for pos := range entries {
+			errs = append(errs, &AsyncError{Pos: pos, Err: err})
+		}
+		return
+	}
+
+	for pos, e := range entries {
+		x, z := uint8(pos.X&0x1f), uint8(pos.Z&0x1f)
+		if e.data == nil {
+			err = f.Remove(x, z)
+		} else {
+			err = f.WriteWithOptions(x, z, e.data, WriteOptions{Timestamp: e.timestamp})
+		}
+
+		if err != nil {
+			errs = append(errs, &AsyncError{Pos: pos, Err: err})
+		}
+	}
+
+	if err = q.anvil.free(f); err != nil {
+		errs = append(errs, &AsyncError{Pos: ChunkPos{X: rg.X << 5, Z: rg.Z << 5}, Err: err})
+	}
+	return
+}
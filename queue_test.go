@@ -0,0 +1,155 @@
+package anvil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type queueTest struct{}
+
+func TestQueue(t *testing.T) { is.SuiteP(t, &queueTest{}) }
+
+// countingObserver counts the number of writes.
+type countingObserver struct {
+	NopObserver
+	mux    sync.Mutex
+	writes int
+}
+
+func (c *countingObserver) Write(WriteEvent) { c.mux.Lock(); c.writes++; c.mux.Unlock() }
+
+func (*queueTest) TestCoalesce(is is.Is) {
+	observer := &countingObserver{}
+	a, err := OpenFs(afero.NewMemMapFs(), Settings{AsyncDelay: time.Hour, Observer: observer})
+	is(err == nil, "unexpected error: %s", err)
+
+	for i := byte(1); i <= 10; i++ {
+		is(a.WriteAsync(1, 2, []byte{i}) == nil, "unexpected error")
+		is(a.WriteAsync(40, 2, []byte{i}) == nil, "unexpected error")
+	}
+
+	// reads see queued data
+	data, err := a.Read(1, 2)
+	is(err == nil && bytes.Equal(data, []byte{10}), "queued data was not read: %v %s", data, err)
+	err = a.ReadFn(1, 2, func(r io.Reader) error {
+		data, err := io.ReadAll(r)
+		is(err == nil && bytes.Equal(data, []byte{10}), "queued data was not read: %v %s", data, err)
+		return err
+	})
+	is(err == nil, "unexpected error: %s", err)
+
+	is(a.WriteAsync(3, 3, nil) == nil, "unexpected error")
+	_, err = a.Read(3, 3)
+	is(errors.Is(err, ErrNotExist), "queued removal was not read: %s", err)
+
+	is(a.Flush() == nil, "unexpected error")
+	is(observer.writes == 3, "writes were not coalesced: %d writes", observer.writes)
+
+	data, err = a.Read(40, 2)
+	is(err == nil && bytes.Equal(data, []byte{10}), "incorrect data: %v %s", data, err)
+
+	// Info waits for the entry to be written
+	is(a.WriteAsync(5, 5, []byte{1}) == nil, "unexpected error")
+	_, exists, err := a.Info(5, 5)
+	is(err == nil && exists, "queued entry was not written: %s", err)
+	is(a.Close() == nil, "unexpected error")
+}
+
+func (*queueTest) TestClose(is is.Is) {
+	fs := afero.NewMemMapFs()
+	a, err := OpenFs(fs, Settings{AsyncQueueSize: 4, AsyncWorkers: 3})
+	is(err == nil, "unexpected error: %s", err)
+
+	for x := int32(0); x < 200; x++ {
+		is(a.WriteAsync(x, x%7, []byte{byte(x)}) == nil, "unexpected error")
+	}
+	is(a.Close() == nil, "unexpected error")
+	is(errors.Is(a.WriteAsync(0, 0, []byte{1}), ErrClosed), "write was queued after close")
+
+	a, err = OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+	for x := int32(0); x < 200; x++ {
+		data, err := a.Read(x, x%7)
+		is(err == nil && bytes.Equal(data, []byte{byte(x)}), "incorrect data at %d: %v %s", x, data, err)
+	}
+}
+
+func (*queueTest) TestSync(is is.Is) {
+	fs := afero.NewMemMapFs()
+	a, err := OpenFs(fs, Settings{AsyncDelay: time.Hour})
+	is(err == nil, "unexpected error: %s", err)
+
+	is(a.WriteAsync(1, 2, []byte{1}) == nil, "unexpected error")
+	is(a.Write(1, 2, []byte{2}) == nil, "unexpected error")
+	data, err := a.Read(1, 2)
+	is(err == nil && bytes.Equal(data, []byte{2}), "queued data was read after a write: %v %s", data, err)
+
+	is(a.Write(3, 3, []byte{1}) == nil, "unexpected error")
+	is(a.WriteAsync(3, 3, []byte{2}) == nil, "unexpected error")
+	is(a.Remove(3, 3) == nil, "unexpected error")
+	_, err = a.Read(3, 3)
+	is(errors.Is(err, ErrNotExist), "queued data was read after a remove: %s", err)
+	is(a.Close() == nil, "unexpected error")
+
+	a, err = OpenFs(fs)
+	is(err == nil, "unexpected error: %s", err)
+	data, err = a.Read(1, 2)
+	is(err == nil && bytes.Equal(data, []byte{2}), "queued data overwrote a write: %v %s", data, err)
+	_, err = a.Read(3, 3)
+	is(errors.Is(err, ErrNotExist), "queued data overwrote a remove: %s", err)
+}
+
+func (*queueTest) TestSyncFile(is is.Is) {
+	a, err := OpenFs(afero.NewMemMapFs(), Settings{AsyncDelay: time.Hour})
+	is(err == nil, "unexpected error: %s", err)
+	is(a.Write(0, 0, []byte{1}) == nil, "unexpected error")
+
+	// writes using File discard the queued data
+	is(a.WriteAsync(1, 2, []byte{1}) == nil, "unexpected error")
+	f, err := a.File(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+	is(f.Write(1, 2, []byte{2}) == nil, "unexpected error")
+	is(f.Close() == nil, "unexpected error")
+	is(a.Flush() == nil, "unexpected error")
+	data, err := a.Read(1, 2)
+	is(err == nil && bytes.Equal(data, []byte{2}), "queued data overwrote a write: %v %s", data, err)
+
+	// entries that are modified are read after the queued data is written
+	is(a.WriteAsync(0, 0, []byte{3}) == nil, "unexpected error")
+	err = WalkModify(context.Background(), a, 1, func(pos ChunkPos, r io.Reader) ([]byte, error) {
+		b, err := io.ReadAll(r)
+		if err != nil || pos != (ChunkPos{}) {
+			return nil, err
+		}
+		return append(b, 4), nil
+	})
+	is(err == nil, "unexpected error: %s", err)
+	is(a.Flush() == nil, "unexpected error")
+	data, err = a.Read(0, 0)
+	is(err == nil && bytes.Equal(data, []byte{3, 4}), "queued data overwrote a modified entry: %v %s", data, err)
+}
+
+func (*queueTest) TestErrors(is is.Is) {
+	fs := afero.NewMemMapFs()
+	a, err := OpenFs(fs, Settings{ReadOnly: true})
+	is(err == nil, "unexpected error: %s", err)
+	is(errors.Is(a.WriteAsync(0, 0, []byte{1}), ErrReadOnly), "write was queued in read-only mode")
+
+	// opening the file fails since the filesystem is read-only
+	a, err = OpenFs(afero.NewReadOnlyFs(fs))
+	is(err == nil, "unexpected error: %s", err)
+	is(a.WriteAsync(0, 0, []byte{1}) == nil, "unexpected error")
+
+	err = a.Flush()
+	var errs AsyncErrors
+	is(errors.As(err, &errs) && len(errs) == 1 && errs[0].Pos == ChunkPos{}, "incorrect error: %v", err)
+	is(a.Flush() == nil, "errors were returned twice")
+}
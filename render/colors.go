@@ -0,0 +1,160 @@
+package render
+
+import "image/color"
+
+// Tint the biome dependent color a block is tinted with.
+type Tint byte
+
+// supported tints
+const (
+	TintNone Tint = iota
+	TintGrass
+	TintFoliage
+	TintWater
+)
+
+// Block how a block is drawn on the map.
+type Block struct {
+	// Color the color of the block.
+	// If Tint is not [TintNone], this is multiplied by the tint color of the biome.
+	Color color.RGBA
+	Tint  Tint
+}
+
+// Biome the tint colors for a biome.
+type Biome struct{ Grass, Foliage, Water color.RGBA }
+
+func rgb(v uint32) color.RGBA {
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
+
+// white is used as the base color for tinted blocks so they use the tint color as is.
+var white = rgb(0xffffff)
+
+// defaultBlock the color used for blocks that are not in the color table.
+var defaultBlock = Block{Color: rgb(0x7f7f7f)}
+
+// defaultBiome the tint used for biomes that are not in the biome table.
+var defaultBiome = Biome{Grass: rgb(0x91bd59), Foliage: rgb(0x77ab2f), Water: rgb(0x3f76e4)}
+
+// DefaultBlocks the colors used for blocks if no color is set in [Options.Blocks].
+var DefaultBlocks = map[string]Block{
+	"minecraft:grass_block":       {Color: white, Tint: TintGrass},
+	"minecraft:short_grass":       {Color: white, Tint: TintGrass},
+	"minecraft:grass":             {Color: white, Tint: TintGrass},
+	"minecraft:tall_grass":        {Color: white, Tint: TintGrass},
+	"minecraft:fern":              {Color: white, Tint: TintGrass},
+	"minecraft:large_fern":        {Color: white, Tint: TintGrass},
+	"minecraft:oak_leaves":        {Color: white, Tint: TintFoliage},
+	"minecraft:jungle_leaves":     {Color: white, Tint: TintFoliage},
+	"minecraft:acacia_leaves":     {Color: white, Tint: TintFoliage},
+	"minecraft:dark_oak_leaves":   {Color: white, Tint: TintFoliage},
+	"minecraft:mangrove_leaves":   {Color: white, Tint: TintFoliage},
+	"minecraft:vine":              {Color: white, Tint: TintFoliage},
+	"minecraft:water":             {Color: white, Tint: TintWater},
+	"minecraft:bubble_column":     {Color: white, Tint: TintWater},
+	"minecraft:birch_leaves":      {Color: rgb(0x80a755)},
+	"minecraft:spruce_leaves":     {Color: rgb(0x619961)},
+	"minecraft:cherry_leaves":     {Color: rgb(0xe8b4d0)},
+	"minecraft:azalea_leaves":     {Color: rgb(0x5e7a2c)},
+	"minecraft:stone":             {Color: rgb(0x7d7d7d)},
+	"minecraft:deepslate":         {Color: rgb(0x505052)},
+	"minecraft:granite":           {Color: rgb(0x956756)},
+	"minecraft:diorite":           {Color: rgb(0xbcbcbc)},
+	"minecraft:andesite":          {Color: rgb(0x888889)},
+	"minecraft:cobblestone":       {Color: rgb(0x7f7f7f)},
+	"minecraft:bedrock":           {Color: rgb(0x555555)},
+	"minecraft:dirt":              {Color: rgb(0x866043)},
+	"minecraft:coarse_dirt":       {Color: rgb(0x77553b)},
+	"minecraft:podzol":            {Color: rgb(0x5b3f18)},
+	"minecraft:mycelium":          {Color: rgb(0x6f6265)},
+	"minecraft:dirt_path":         {Color: rgb(0x947a41)},
+	"minecraft:farmland":          {Color: rgb(0x8f6642)},
+	"minecraft:mud":               {Color: rgb(0x3c3a3d)},
+	"minecraft:sand":              {Color: rgb(0xdbcfa3)},
+	"minecraft:red_sand":          {Color: rgb(0xbe6621)},
+	"minecraft:sandstone":         {Color: rgb(0xd8cb9b)},
+	"minecraft:gravel":            {Color: rgb(0x837f7e)},
+	"minecraft:clay":              {Color: rgb(0xa0a6b3)},
+	"minecraft:terracotta":        {Color: rgb(0x985e43)},
+	"minecraft:snow":              {Color: rgb(0xf9fefe)},
+	"minecraft:snow_block":        {Color: rgb(0xf9fefe)},
+	"minecraft:powder_snow":       {Color: rgb(0xf8fdfd)},
+	"minecraft:ice":               {Color: rgb(0x91b7fd)},
+	"minecraft:packed_ice":        {Color: rgb(0x8db4fa)},
+	"minecraft:blue_ice":          {Color: rgb(0x74a8fd)},
+	"minecraft:lava":              {Color: rgb(0xd4590f)},
+	"minecraft:obsidian":          {Color: rgb(0x0f0b19)},
+	"minecraft:netherrack":        {Color: rgb(0x612626)},
+	"minecraft:soul_sand":         {Color: rgb(0x513e32)},
+	"minecraft:end_stone":         {Color: rgb(0xdbde9e)},
+	"minecraft:oak_log":           {Color: rgb(0x6d5533)},
+	"minecraft:spruce_log":        {Color: rgb(0x3a2611)},
+	"minecraft:birch_log":         {Color: rgb(0xd8d7d2)},
+	"minecraft:jungle_log":        {Color: rgb(0x55441a)},
+	"minecraft:oak_planks":        {Color: rgb(0xa2834f)},
+	"minecraft:spruce_planks":     {Color: rgb(0x735531)},
+	"minecraft:cactus":            {Color: rgb(0x557f2b)},
+	"minecraft:sugar_cane":        {Color: rgb(0xaadb74)},
+	"minecraft:pumpkin":           {Color: rgb(0xc6761c)},
+	"minecraft:melon":             {Color: rgb(0x6f9130)},
+	"minecraft:dandelion":         {Color: rgb(0xcbd12b)},
+	"minecraft:poppy":             {Color: rgb(0xc21b14)},
+	"minecraft:kelp":              {Color: rgb(0x578c2f)},
+	"minecraft:seagrass":          {Color: rgb(0x3a7c17)},
+	"minecraft:tall_seagrass":     {Color: rgb(0x3a7c17)},
+	"minecraft:lily_pad":          {Color: rgb(0x208030)},
+	"minecraft:moss_block":        {Color: rgb(0x596e2d)},
+	"minecraft:glass":             {Color: rgb(0xafd5db)},
+	"minecraft:bricks":            {Color: rgb(0x976253)},
+	"minecraft:stone_bricks":      {Color: rgb(0x7a7979)},
+	"minecraft:white_wool":        {Color: rgb(0xe9ecec)},
+	"minecraft:torch":             {Color: rgb(0xffd866)},
+	"minecraft:crafting_table":    {Color: rgb(0x7a5a36)},
+	"minecraft:chest":             {Color: rgb(0x9c7034)},
+	"minecraft:mossy_cobblestone": {Color: rgb(0x6e7661)},
+}
+
+// DefaultBiomes the tint colors used for biomes if no color is set in [Options.Biomes].
+var DefaultBiomes = map[string]Biome{
+	"minecraft:plains":           defaultBiome,
+	"minecraft:sunflower_plains": defaultBiome,
+	"minecraft:meadow":           {Grass: rgb(0x83bb6d), Foliage: rgb(0x63a948), Water: rgb(0x0e4ecf)},
+	"minecraft:forest":           {Grass: rgb(0x79c05a), Foliage: rgb(0x59ae30), Water: rgb(0x3f76e4)},
+	"minecraft:flower_forest":    {Grass: rgb(0x79c05a), Foliage: rgb(0x59ae30), Water: rgb(0x3f76e4)},
+	"minecraft:birch_forest":     {Grass: rgb(0x88bb67), Foliage: rgb(0x6ba941), Water: rgb(0x3f76e4)},
+	"minecraft:dark_forest":      {Grass: rgb(0x507a32), Foliage: rgb(0x59ae30), Water: rgb(0x3f76e4)},
+	"minecraft:taiga":            {Grass: rgb(0x86b783), Foliage: rgb(0x68a464), Water: rgb(0x287082)},
+	"minecraft:snowy_taiga":      {Grass: rgb(0x80b497), Foliage: rgb(0x60a17b), Water: rgb(0x205e83)},
+	"minecraft:snowy_plains":     {Grass: rgb(0x80b497), Foliage: rgb(0x60a17b), Water: rgb(0x3f76e4)},
+	"minecraft:jungle":           {Grass: rgb(0x59c93c), Foliage: rgb(0x30bb0b), Water: rgb(0x14a2c5)},
+	"minecraft:swamp":            {Grass: rgb(0x6a7039), Foliage: rgb(0x6a7039), Water: rgb(0x617b64)},
+	"minecraft:mangrove_swamp":   {Grass: rgb(0x6a7039), Foliage: rgb(0x8db127), Water: rgb(0x3a7a6a)},
+	"minecraft:desert":           {Grass: rgb(0xbfb755), Foliage: rgb(0xaea42a), Water: rgb(0x32a598)},
+	"minecraft:savanna":          {Grass: rgb(0xbfb755), Foliage: rgb(0xaea42a), Water: rgb(0x2c8b9c)},
+	"minecraft:badlands":         {Grass: rgb(0x90814d), Foliage: rgb(0x9e814d), Water: rgb(0x4e7f81)},
+	"minecraft:ocean":            {Grass: rgb(0x8eb971), Foliage: rgb(0x71a74d), Water: rgb(0x3f76e4)},
+	"minecraft:deep_ocean":       {Grass: rgb(0x8eb971), Foliage: rgb(0x71a74d), Water: rgb(0x3f76e4)},
+	"minecraft:warm_ocean":       {Grass: rgb(0x8eb971), Foliage: rgb(0x71a74d), Water: rgb(0x43d5ee)},
+	"minecraft:lukewarm_ocean":   {Grass: rgb(0x8eb971), Foliage: rgb(0x71a74d), Water: rgb(0x45adf2)},
+	"minecraft:cold_ocean":       {Grass: rgb(0x8eb971), Foliage: rgb(0x71a74d), Water: rgb(0x3d57d6)},
+	"minecraft:frozen_ocean":     {Grass: rgb(0x80b497), Foliage: rgb(0x60a17b), Water: rgb(0x3938c9)},
+	"minecraft:river":            {Grass: rgb(0x8eb971), Foliage: rgb(0x71a74d), Water: rgb(0x3f76e4)},
+	"minecraft:beach":            {Grass: rgb(0x91bd59), Foliage: rgb(0x77ab2f), Water: rgb(0x3f76e4)},
+}
+
+// multiply multiplies each channel of the given colors.
+func multiply(a, b color.RGBA) color.RGBA {
+	return color.RGBA{
+		R: uint8(uint16(a.R) * uint16(b.R) / 0xff),
+		G: uint8(uint16(a.G) * uint16(b.G) / 0xff),
+		B: uint8(uint16(a.B) * uint16(b.B) / 0xff),
+		A: a.A,
+	}
+}
+
+// shade scales the brightness of the given color by factor/16.
+func shade(c color.RGBA, factor uint16) color.RGBA {
+	scale := func(v uint8) uint8 { return uint8(min(uint16(v)*factor/16, 0xff)) }
+	return color.RGBA{R: scale(c.R), G: scale(c.G), B: scale(c.B), A: c.A}
+}
@@ -0,0 +1,166 @@
+// Package render renders top-down maps of worlds stored in anvil files.
+//
+// Each column of blocks is drawn as a single pixel using the color of the highest
+// non-air block in the column, tinted using the biome the block is in.
+// A region is rendered as a 512x512 image.
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/FireworkMC/anvil/internal/chunk"
+	"github.com/FireworkMC/anvil/nbt"
+	"github.com/yehan2002/errors"
+)
+
+// RegionSize the width and height of a rendered region in pixels.
+const RegionSize = 32 * 16
+
+// Options options for [New].
+type Options struct {
+	// Blocks the colors used for blocks.
+	// Blocks that are not in this map use the color in [DefaultBlocks].
+	Blocks map[string]Block
+	// Biomes the tint colors used for biomes.
+	// Biomes that are not in this map use the colors in [DefaultBiomes].
+	Biomes map[string]Biome
+	// NoShading disables shading columns based on the height of the column north of it.
+	NoShading bool
+}
+
+// Renderer renders regions from an [anvil.Anvil].
+// All functions can be called concurrently from multiple goroutines.
+type Renderer struct {
+	world   *anvil.Anvil
+	blocks  map[string]Block
+	biomes  map[string]Biome
+	shading bool
+}
+
+// New creates a new renderer for the given world.
+func New(world *anvil.Anvil, opt ...Options) *Renderer {
+	var options Options
+	if len(opt) == 1 {
+		options = opt[0]
+	}
+
+	r := &Renderer{world: world, shading: !options.NoShading, blocks: map[string]Block{}, biomes: map[string]Biome{}}
+	for _, m := range []map[string]Block{DefaultBlocks, options.Blocks} {
+		for name, b := range m {
+			r.blocks[name] = b
+		}
+	}
+	for _, m := range []map[string]Biome{DefaultBiomes, options.Biomes} {
+		for name, b := range m {
+			r.biomes[name] = b
+		}
+	}
+	return r
+}
+
+// Region renders the region at rgX, rgZ.
+// Chunks that do not exist are left transparent.
+func (r *Renderer) Region(rgX, rgZ int32) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, RegionSize, RegionSize))
+	heights := make([]int, RegionSize*RegionSize)
+
+	for cz := 0; cz < 32; cz++ {
+		for cx := 0; cx < 32; cx++ {
+			chunkX, chunkZ := rgX<<5|int32(cx), rgZ<<5|int32(cz)
+
+			var root nbt.Compound
+			err := r.world.ReadFn(chunkX, chunkZ, func(src io.Reader) (err error) {
+				_, root, err = nbt.Read(src)
+				return
+			})
+
+			if errors.Is(err, anvil.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, errors.Wrap(fmt.Sprintf("render: unable to read chunk (%d,%d)", chunkX, chunkZ), err)
+			}
+
+			r.drawChunk(img, heights, chunk.Parse(root), cx*16, cz*16)
+		}
+	}
+
+	if r.shading {
+		r.shade(img, heights)
+	}
+	return img, nil
+}
+
+// WriteRegion renders the region at rgX, rgZ and writes it to `w` as a PNG.
+func (r *Renderer) WriteRegion(w io.Writer, rgX, rgZ int32) error {
+	img, err := r.Region(rgX, rgZ)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// drawChunk draws the given chunk with its top left corner at offsetX, offsetZ.
+func (r *Renderer) drawChunk(img *image.RGBA, heights []int, c *chunk.Chunk, offsetX, offsetZ int) {
+	for z := 0; z < 16; z++ {
+		for x := 0; x < 16; x++ {
+			block, biome, y := c.Top(x, z)
+			if block == "" {
+				continue
+			}
+
+			img.SetRGBA(offsetX+x, offsetZ+z, r.color(block, biome))
+			heights[(offsetZ+z)*RegionSize+offsetX+x] = y
+		}
+	}
+}
+
+// color returns the color of the given block in the given biome.
+func (r *Renderer) color(block, biome string) color.RGBA {
+	b, ok := r.blocks[block]
+	if !ok {
+		b = defaultBlock
+	}
+
+	if b.Tint == TintNone {
+		return b.Color
+	}
+
+	tint, ok := r.biomes[biome]
+	if !ok {
+		tint = defaultBiome
+	}
+
+	switch b.Tint {
+	case TintGrass:
+		return multiply(b.Color, tint.Grass)
+	case TintFoliage:
+		return multiply(b.Color, tint.Foliage)
+	default:
+		return multiply(b.Color, tint.Water)
+	}
+}
+
+// shade makes columns that are higher than the column north of them brighter
+// and columns that are lower darker.
+func (r *Renderer) shade(img *image.RGBA, heights []int) {
+	for z := RegionSize - 1; z > 0; z-- {
+		for x := 0; x < RegionSize; x++ {
+			c := img.RGBAAt(x, z)
+			if c.A == 0 || img.RGBAAt(x, z-1).A == 0 {
+				continue
+			}
+
+			y, north := heights[z*RegionSize+x], heights[(z-1)*RegionSize+x]
+			if y > north {
+				img.SetRGBA(x, z, shade(c, 18))
+			} else if y < north {
+				img.SetRGBA(x, z, shade(c, 14))
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package render
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/FireworkMC/anvil/nbt"
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type renderTest struct{}
+
+func TestRender(t *testing.T) { is.SuiteP(t, &renderTest{}) }
+
+// testChunk creates a chunk with a layer of stone at y=-64, and a single block at 3,y,5.
+func testChunk(is is.Is, block string, y int) []byte {
+	blocks := make([]int64, 256)
+	// set the block at 3,y&15,5 to the second entry in the palette.
+	idx := (y&15)<<8 | 5<<4 | 3
+	blocks[idx/16] = 1 << (idx % 16 * 4)
+
+	heightmap := make([]int64, 37)
+	for i := 0; i < 256; i++ {
+		h := int64(1)
+		if i == 5<<4|3 {
+			h = int64(y + 64 + 1)
+		}
+		heightmap[i/7] |= h << (i % 7 * 9)
+	}
+
+	root := nbt.Compound{
+		{Name: "DataVersion", Value: int32(3465)},
+		{Name: "yPos", Value: int32(-4)},
+		{Name: "Heightmaps", Value: nbt.Compound{{Name: "WORLD_SURFACE", Value: heightmap}}},
+		{Name: "sections", Value: nbt.List{Type: nbt.TagCompound, Values: []any{
+			nbt.Compound{
+				{Name: "Y", Value: int8(-4)},
+				{Name: "block_states", Value: nbt.Compound{
+					{Name: "palette", Value: nbt.List{Type: nbt.TagCompound, Values: []any{nbt.Compound{{Name: "Name", Value: "minecraft:stone"}}}}},
+				}},
+			},
+			nbt.Compound{
+				{Name: "Y", Value: int8(y >> 4)},
+				{Name: "block_states", Value: nbt.Compound{
+					{Name: "palette", Value: nbt.List{Type: nbt.TagCompound, Values: []any{
+						nbt.Compound{{Name: "Name", Value: "minecraft:air"}},
+						nbt.Compound{{Name: "Name", Value: block}},
+					}}},
+					{Name: "data", Value: blocks},
+				}},
+				{Name: "biomes", Value: nbt.Compound{
+					{Name: "palette", Value: nbt.List{Type: nbt.TagString, Values: []any{"minecraft:desert"}}},
+				}},
+			},
+		}}},
+	}
+
+	var buf bytes.Buffer
+	err := nbt.Write(&buf, "", root)
+	is(err == nil, "unexpected error: %s", err)
+	return buf.Bytes()
+}
+
+func (*renderTest) world(is is.Is) *anvil.Anvil {
+	world, err := anvil.OpenFs(afero.NewMemMapFs())
+	is(err == nil, "unexpected error: %s", err)
+
+	old := anvil.WriteOptions{Timestamp: time.Now().Add(-time.Hour)}
+	err = world.WriteWithOptions(0, 0, testChunk(is, "minecraft:grass_block", 70), old)
+	is(err == nil, "unexpected error: %s", err)
+	err = world.WriteWithOptions(33, 0, testChunk(is, "minecraft:sand", 10), old)
+	is(err == nil, "unexpected error: %s", err)
+	return world
+}
+
+func (r *renderTest) TestRegion(is is.Is) {
+	world := r.world(is)
+
+	img, err := New(world, Options{NoShading: true}).Region(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+
+	desert := DefaultBiomes["minecraft:desert"]
+	is(img.RGBAAt(3, 5) == desert.Grass, "incorrect color for tinted block: %v", img.RGBAAt(3, 5))
+	is(img.RGBAAt(4, 5) == DefaultBlocks["minecraft:stone"].Color, "incorrect color for block: %v", img.RGBAAt(4, 5))
+	is(img.RGBAAt(16, 0).A == 0, "missing chunk was drawn")
+
+	img, err = New(world, Options{Blocks: map[string]Block{"minecraft:stone": {Color: color.RGBA{R: 1, A: 0xff}}}}).Region(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+	is(img.RGBAAt(4, 5) == color.RGBA{R: 1, A: 0xff}, "color was not overridden")
+	is(img.RGBAAt(3, 6) != img.RGBAAt(4, 6), "lower block was not shaded")
+}
+
+func (r *renderTest) TestTiles(is is.Is) {
+	world := r.world(is)
+	out := afero.NewMemMapFs()
+	renderer := New(world)
+
+	rendered, err := renderer.Tiles(out, 2)
+	is(err == nil, "unexpected error: %s", err)
+	is(rendered == 4, "incorrect number of tiles rendered: %d", rendered)
+
+	for _, name := range []string{TilePath(0, 0, 0), TilePath(0, 1, 0), TilePath(1, 0, 0), TilePath(2, 0, 0)} {
+		_, err = out.Stat(name)
+		is(err == nil, "tile %s was not rendered", name)
+	}
+
+	top, err := readPNG(out, TilePath(1, 0, 0))
+	is(err == nil, "unexpected error: %s", err)
+	_, _, _, alpha := top.At(1, 2).RGBA()
+	is(alpha != 0, "child tile was not drawn")
+
+	rendered, err = renderer.Tiles(out, 2)
+	is(err == nil, "unexpected error: %s", err)
+	is(rendered == 0, "unmodified tiles were rendered: %d", rendered)
+
+	err = world.Write(40, 0, testChunk(is, "minecraft:sand", 10))
+	is(err == nil, "unexpected error: %s", err)
+
+	rendered, err = renderer.Tiles(out, 2)
+	is(err == nil, "unexpected error: %s", err)
+	is(rendered == 3, "incorrect number of tiles rendered: %d", rendered)
+}
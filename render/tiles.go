@@ -0,0 +1,190 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path"
+	"time"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/spf13/afero"
+	"github.com/yehan2002/errors"
+)
+
+// tile the position of a tile in the tile pyramid.
+type tile struct{ x, z int32 }
+
+// TilePath returns the path of the tile at x,z at the given zoom level.
+// Level 0 contains one tile per region. Each tile at level n covers
+// 2x2 tiles at level n-1.
+func TilePath(level int, x, z int32) string {
+	return path.Join(fmt.Sprint(level), fmt.Sprint(x), fmt.Sprintf("%d.png", z))
+}
+
+// Tiles renders a tile pyramid for the world to `out`.
+// Tiles are stored at the paths returned by [TilePath].
+// `levels` is the number of zoomed out levels rendered on top of level 0.
+// Regions are only rendered if a chunk in it was modified after its tile was written,
+// and zoomed out tiles are only rendered if one of the tiles it covers was rendered.
+// This returns the number of tiles that were rendered.
+func (r *Renderer) Tiles(out afero.Fs, levels int) (rendered int, err error) {
+	var regions []anvil.RegionPos
+	if regions, err = r.world.Regions(); err != nil {
+		return 0, err
+	}
+
+	// dirty the tiles at the current level that were rendered
+	dirty := map[tile]bool{}
+	tiles := map[tile]bool{}
+
+	for _, rg := range regions {
+		t := tile{rg.X, rg.Z}
+		tiles[t] = true
+
+		var modified bool
+		if modified, err = r.regionModified(out, rg); err != nil {
+			return rendered, err
+		}
+
+		if !modified {
+			continue
+		}
+
+		var img *image.RGBA
+		if img, err = r.Region(rg.X, rg.Z); err != nil {
+			return rendered, err
+		}
+
+		if err = writePNG(out, TilePath(0, t.x, t.z), img); err != nil {
+			return rendered, err
+		}
+		dirty[t] = true
+		rendered++
+	}
+
+	for level := 1; level <= levels; level++ {
+		parents, parentsDirty := map[tile]bool{}, map[tile]bool{}
+		for t := range tiles {
+			parent := tile{t.x >> 1, t.z >> 1}
+			parents[parent] = true
+			if dirty[t] {
+				parentsDirty[parent] = true
+			}
+		}
+
+		for t := range parents {
+			if !parentsDirty[t] {
+				if _, statErr := out.Stat(TilePath(level, t.x, t.z)); statErr == nil {
+					continue
+				}
+			}
+
+			if err = renderParent(out, level, t); err != nil {
+				return rendered, err
+			}
+			parentsDirty[t] = true
+			rendered++
+		}
+
+		tiles, dirty = parents, parentsDirty
+	}
+
+	return rendered, nil
+}
+
+// regionModified checks if any chunk in the region was modified after the tile for it was written.
+func (r *Renderer) regionModified(out afero.Fs, rg anvil.RegionPos) (modified bool, err error) {
+	info, err := out.Stat(TilePath(0, rg.X, rg.Z))
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	// timestamps are stored in seconds, so any chunk modified in the same second
+	// as the tile was written must be treated as modified.
+	written := info.ModTime().Truncate(time.Second)
+
+	var f anvil.File
+	if f, err = r.world.File(rg.X, rg.Z); err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	for x := uint8(0); x < 32; x++ {
+		for z := uint8(0); z < 32; z++ {
+			if entry, exists := f.Info(x, z); exists && !entry.Modified().Before(written) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// renderParent renders the tile at the given level by scaling down the 4 tiles it covers.
+func renderParent(out afero.Fs, level int, t tile) error {
+	img := image.NewRGBA(image.Rect(0, 0, RegionSize, RegionSize))
+
+	for i := int32(0); i < 4; i++ {
+		cx, cz := i&1, i>>1
+		child, err := readPNG(out, TilePath(level-1, t.x<<1|cx, t.z<<1|cz))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		downscale(img, child, int(cx)*RegionSize/2, int(cz)*RegionSize/2)
+	}
+
+	return writePNG(out, TilePath(level, t.x, t.z), img)
+}
+
+// downscale draws `src` at half its size with its top left corner at offsetX, offsetZ.
+func downscale(dst *image.RGBA, src image.Image, offsetX, offsetZ int) {
+	bounds := src.Bounds()
+	for z := 0; z < bounds.Dy()/2; z++ {
+		for x := 0; x < bounds.Dx()/2; x++ {
+			var r, g, b, a uint32
+			for i := 0; i < 4; i++ {
+				cr, cg, cb, ca := src.At(bounds.Min.X+x*2+(i&1), bounds.Min.Y+z*2+(i>>1)).RGBA()
+				r, g, b, a = r+cr, g+cg, b+cb, a+ca
+			}
+			dst.Set(offsetX+x, offsetZ+z, color.RGBA64{R: uint16(r / 4), G: uint16(g / 4), B: uint16(b / 4), A: uint16(a / 4)})
+		}
+	}
+}
+
+func readPNG(fs afero.Fs, name string) (image.Image, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, errors.Wrap("render: unable to read tile "+name, err)
+	}
+	return img, nil
+}
+
+func writePNG(fs afero.Fs, name string, img image.Image) (err error) {
+	if err = fs.MkdirAll(path.Dir(name), 0o777); err != nil {
+		return errors.Wrap("render: unable to create directory for "+name, err)
+	}
+
+	var f afero.File
+	if f, err = fs.Create(name); err != nil {
+		return errors.Wrap("render: unable to create tile "+name, err)
+	}
+
+	if err = png.Encode(f, img); err != nil {
+		f.Close()
+		return errors.Wrap("render: unable to write tile "+name, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,256 @@
+// Package search finds blocks, block entities and entities in a world.
+package search
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/FireworkMC/anvil/internal/chunk"
+	"github.com/FireworkMC/anvil/nbt"
+)
+
+// Kind the kind of object a match refers to.
+type Kind byte
+
+// supported kinds
+const (
+	KindBlock Kind = 1 + iota
+	KindBlockEntity
+	KindEntity
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindBlock:
+		return "block"
+	case KindBlockEntity:
+		return "block entity"
+	case KindEntity:
+		return "entity"
+	default:
+		return "unknown"
+	}
+}
+
+// Match an object that matched a query.
+type Match struct {
+	Kind Kind
+	// Chunk the position of the chunk the object is stored in.
+	Chunk anvil.ChunkPos
+	// X, Y, Z the position of the block in world coordinates.
+	// For entities this is the position of the block the entity is in.
+	X, Y, Z int
+	// Name the name of the block or the id of the block entity or entity.
+	Name string
+	// Data the block state, block entity or entity.
+	Data nbt.Compound
+}
+
+// Bounds a region bounding box.
+// Both Min and Max are inclusive.
+type Bounds struct{ Min, Max anvil.RegionPos }
+
+// Contains checks if the given region is inside the bounding box.
+func (b *Bounds) Contains(rg anvil.RegionPos) bool {
+	return rg.X >= b.Min.X && rg.X <= b.Max.X && rg.Z >= b.Min.Z && rg.Z <= b.Max.Z
+}
+
+// Query the objects to search for.
+// Predicates that are nil are not evaluated.
+// Predicates may be called concurrently from multiple goroutines.
+type Query struct {
+	// Block is called for every distinct block state in each chunk section.
+	// `state` contains the block name and properties.
+	Block func(name string, state nbt.Compound) bool
+	// BlockEntity is called for every block entity.
+	BlockEntity func(id string, blockEntity nbt.Compound) bool
+	// Entity is called for every entity.
+	Entity func(id string, entity nbt.Compound) bool
+
+	// Bounds limits the search to the given regions.
+	// If this is nil, every region is searched.
+	Bounds *Bounds
+	// Concurrency the number of regions that are searched at the same time.
+	// See [anvil.Walk] for more information.
+	Concurrency int
+}
+
+// World the directories that contain a world.
+type World struct {
+	// Regions the world's `region` directory.
+	Regions *anvil.Anvil
+	// Entities the world's `entities` directory.
+	// This is only needed to search for entities in worlds saved since 1.17.
+	Entities *anvil.Anvil
+}
+
+// Search searches the world for objects that match the query.
+// `fn` is called for each match from a single goroutine.
+// If `fn` returns an error, the search is stopped and the error is returned.
+// Errors that occur while reading chunks are returned as [anvil.WalkErrors]
+// after every chunk was searched.
+func Search(ctx context.Context, world World, q Query, fn func(Match) error) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var worlds []*anvil.Anvil
+	if world.Regions != nil {
+		worlds = append(worlds, world.Regions)
+	}
+	if q.Entity != nil && world.Entities != nil {
+		worlds = append(worlds, world.Entities)
+	}
+
+	matches := make(chan Match, 64)
+	var walkErr error
+	go func() {
+		defer close(matches)
+
+		// errors reading chunks do not stop the search, so every world is searched
+		var errs anvil.WalkErrors
+		for _, w := range worlds {
+			err := q.walk(ctx, w, matches)
+			var walkErrs anvil.WalkErrors
+			if errors.As(err, &walkErrs) {
+				errs = append(errs, walkErrs...)
+			} else if err != nil {
+				walkErr = err
+				return
+			}
+		}
+
+		if len(errs) != 0 {
+			walkErr = errs
+		}
+	}()
+
+	var fnErr error
+	for m := range matches {
+		if fnErr != nil {
+			continue
+		}
+		if fnErr = fn(m); fnErr != nil {
+			cancel()
+		}
+	}
+
+	if fnErr != nil {
+		return fnErr
+	}
+	return walkErr
+}
+
+// walk searches the regions in the given world that are inside the bounding box.
+func (q *Query) walk(ctx context.Context, world *anvil.Anvil, matches chan<- Match) error {
+	all, err := world.Regions()
+	if err != nil {
+		return err
+	}
+
+	var regions []anvil.RegionPos
+	for _, rg := range all {
+		if q.Bounds == nil || q.Bounds.Contains(rg) {
+			regions = append(regions, rg)
+		}
+	}
+
+	return anvil.WalkRegions(ctx, world, regions, q.Concurrency, func(pos anvil.ChunkPos, src io.Reader) error {
+		_, root, err := nbt.Read(src)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range q.chunk(pos, chunk.Parse(root)) {
+			select {
+			case matches <- m:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+}
+
+// chunk returns the objects in the chunk that match the query.
+func (q *Query) chunk(pos anvil.ChunkPos, c *chunk.Chunk) (matches []Match) {
+	if q.Block != nil {
+		for y, sec := range c.Sections {
+			matches = q.section(matches, pos, y, sec)
+		}
+	}
+
+	if q.BlockEntity != nil {
+		for _, be := range c.BlockEntities {
+			id, _ := be.String("id")
+			if !q.BlockEntity(id, be) {
+				continue
+			}
+
+			x, _ := be.Int("x")
+			y, _ := be.Int("y")
+			z, _ := be.Int("z")
+			matches = append(matches, Match{Kind: KindBlockEntity, Chunk: pos, X: int(x), Y: int(y), Z: int(z), Name: id, Data: be})
+		}
+	}
+
+	if q.Entity != nil {
+		for _, e := range c.Entities {
+			id, _ := e.String("id")
+			if !q.Entity(id, e) {
+				continue
+			}
+
+			m := Match{Kind: KindEntity, Chunk: pos, Name: id, Data: e}
+			if p, ok := e.List("Pos"); ok && p.Type == nbt.TagDouble && len(p.Values) == 3 {
+				m.X = int(math.Floor(p.Values[0].(float64)))
+				m.Y = int(math.Floor(p.Values[1].(float64)))
+				m.Z = int(math.Floor(p.Values[2].(float64)))
+			}
+			matches = append(matches, m)
+		}
+	}
+	return
+}
+
+// section appends the blocks in the section that match the query to `matches`.
+func (q *Query) section(matches []Match, pos anvil.ChunkPos, sectionY int, sec *chunk.Section) []Match {
+	// evaluate the predicate once for each entry in the palette
+	matched := make([]bool, len(sec.Blocks.Names))
+	var found bool
+	for i, name := range sec.Blocks.Names {
+		var state nbt.Compound
+		if i < len(sec.Blocks.States) {
+			state = sec.Blocks.States[i]
+		}
+		matched[i] = q.Block(name, state)
+		found = found || matched[i]
+	}
+
+	if !found {
+		return matches
+	}
+
+	for y := 0; y < 16; y++ {
+		for z := 0; z < 16; z++ {
+			for x := 0; x < 16; x++ {
+				idx := sec.Blocks.Index(chunk.BlockIndex(x, y, z))
+				if idx >= len(matched) || !matched[idx] {
+					continue
+				}
+
+				m := Match{
+					Kind: KindBlock, Chunk: pos, Name: sec.Blocks.Names[idx],
+					X: int(pos.X)<<4 | x, Y: sectionY<<4 | y, Z: int(pos.Z)<<4 | z,
+				}
+				if idx < len(sec.Blocks.States) {
+					m.Data = sec.Blocks.States[idx]
+				}
+				matches = append(matches, m)
+			}
+		}
+	}
+	return matches
+}
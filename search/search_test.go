@@ -0,0 +1,157 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/FireworkMC/anvil"
+	"github.com/FireworkMC/anvil/nbt"
+	"github.com/spf13/afero"
+	"github.com/yehan2002/is/v2"
+)
+
+type searchTest struct{}
+
+func TestSearch(t *testing.T) { is.SuiteP(t, &searchTest{}) }
+
+func encode(is is.Is, root nbt.Compound) []byte {
+	var buf bytes.Buffer
+	err := nbt.Write(&buf, "", root)
+	is(err == nil, "unexpected error: %s", err)
+	return buf.Bytes()
+}
+
+// testChunk creates a chunk with a spawner at 1,2,3 in the section at y=-64
+// and a chest containing `item` at the same position in world coordinates.
+func testChunk(is is.Is, pos anvil.ChunkPos, item string) []byte {
+	blocks := make([]int64, 256)
+	idx := 2<<8 | 3<<4 | 1
+	blocks[idx/16] = 1 << (idx % 16 * 4)
+
+	x, z := pos.X<<4|1, pos.Z<<4|3
+	return encode(is, nbt.Compound{
+		{Name: "yPos", Value: int32(-4)},
+		{Name: "sections", Value: nbt.List{Type: nbt.TagCompound, Values: []any{
+			nbt.Compound{
+				{Name: "Y", Value: int8(-4)},
+				{Name: "block_states", Value: nbt.Compound{
+					{Name: "palette", Value: nbt.List{Type: nbt.TagCompound, Values: []any{
+						nbt.Compound{{Name: "Name", Value: "minecraft:stone"}},
+						nbt.Compound{{Name: "Name", Value: "minecraft:spawner"}},
+					}}},
+					{Name: "data", Value: blocks},
+				}},
+			},
+		}}},
+		{Name: "block_entities", Value: nbt.List{Type: nbt.TagCompound, Values: []any{
+			nbt.Compound{
+				{Name: "id", Value: "minecraft:chest"},
+				{Name: "x", Value: x}, {Name: "y", Value: int32(-62)}, {Name: "z", Value: z},
+				{Name: "Items", Value: nbt.List{Type: nbt.TagCompound, Values: []any{
+					nbt.Compound{{Name: "id", Value: item}, {Name: "Count", Value: int8(1)}},
+				}}},
+			},
+		}}},
+	})
+}
+
+func testEntities(is is.Is, pos anvil.ChunkPos) []byte {
+	return encode(is, nbt.Compound{
+		{Name: "Entities", Value: nbt.List{Type: nbt.TagCompound, Values: []any{
+			nbt.Compound{
+				{Name: "id", Value: "minecraft:zombie"},
+				{Name: "Pos", Value: nbt.List{Type: nbt.TagDouble, Values: []any{
+					float64(pos.X<<4) + 0.5, float64(70), float64(pos.Z<<4) - 0.5,
+				}}},
+			},
+		}}},
+	})
+}
+
+func (*searchTest) world(is is.Is) World {
+	regions, err := anvil.OpenFs(afero.NewMemMapFs())
+	is(err == nil, "unexpected error: %s", err)
+	entities, err := anvil.OpenFs(afero.NewMemMapFs())
+	is(err == nil, "unexpected error: %s", err)
+
+	items := map[anvil.ChunkPos]string{{X: 0, Z: 0}: "minecraft:diamond", {X: 40, Z: -3}: "minecraft:stick", {X: -100, Z: 5}: "minecraft:diamond"}
+	for pos, item := range items {
+		err = regions.Write(pos.X, pos.Z, testChunk(is, pos, item))
+		is(err == nil, "unexpected error: %s", err)
+		err = entities.Write(pos.X, pos.Z, testEntities(is, pos))
+		is(err == nil, "unexpected error: %s", err)
+	}
+	return World{Regions: regions, Entities: entities}
+}
+
+func (*searchTest) collect(is is.Is, world World, q Query) map[anvil.ChunkPos][]Match {
+	found := map[anvil.ChunkPos][]Match{}
+	err := Search(context.Background(), world, q, func(m Match) error {
+		found[m.Chunk] = append(found[m.Chunk], m)
+		return nil
+	})
+	is(err == nil, "unexpected error: %s", err)
+	return found
+}
+
+func (s *searchTest) TestBlocks(is is.Is) {
+	found := s.collect(is, s.world(is), Query{Block: func(name string, _ nbt.Compound) bool { return name == "minecraft:spawner" }})
+
+	is(len(found) == 3, "incorrect number of chunks matched: %d", len(found))
+	m := found[anvil.ChunkPos{X: 40, Z: -3}]
+	is(len(m) == 1, "incorrect number of matches: %d", len(m))
+	is(m[0].Kind == KindBlock && m[0].X == 40*16+1 && m[0].Y == -62 && m[0].Z == -3*16+3, "incorrect match: %+v", m[0])
+}
+
+func (s *searchTest) TestBlockEntities(is is.Is) {
+	found := s.collect(is, s.world(is), Query{
+		BlockEntity: func(id string, be nbt.Compound) bool {
+			items, _ := be.List("Items")
+			for _, item := range items.Compounds() {
+				if name, _ := item.String("id"); name == "minecraft:diamond" {
+					return id == "minecraft:chest"
+				}
+			}
+			return false
+		},
+	})
+
+	is(len(found) == 2, "incorrect number of chunks matched: %d", len(found))
+	m := found[anvil.ChunkPos{X: -100, Z: 5}]
+	is(len(m) == 1 && m[0].X == -100*16+1 && m[0].Z == 5*16+3, "incorrect match: %+v", m)
+}
+
+func (s *searchTest) TestEntities(is is.Is) {
+	found := s.collect(is, s.world(is), Query{
+		Entity: func(id string, _ nbt.Compound) bool { return id == "minecraft:zombie" },
+		Bounds: &Bounds{Min: anvil.RegionPos{X: 0, Z: -1}, Max: anvil.RegionPos{X: 1, Z: 0}},
+	})
+
+	is(len(found) == 2, "incorrect number of chunks matched: %d", len(found))
+	m := found[anvil.ChunkPos{X: 40, Z: -3}]
+	is(len(m) == 1 && m[0].X == 40*16 && m[0].Y == 70 && m[0].Z == -3*16-1, "incorrect match: %+v", m)
+}
+
+func (s *searchTest) TestStop(is is.Is) {
+	stop := errors.New("stop")
+	err := Search(context.Background(), s.world(is), Query{Concurrency: 1, Block: func(string, nbt.Compound) bool { return true }},
+		func(Match) error { return stop })
+	is(errors.Is(err, stop), "incorrect error returned: %s", err)
+}
+
+func (s *searchTest) TestErrors(is is.Is) {
+	world := s.world(is)
+	err := world.Regions.Write(5, 5, []byte("not nbt"))
+	is(err == nil, "unexpected error: %s", err)
+
+	// entities are searched after a chunk in the region directory could not be read
+	found := map[anvil.ChunkPos][]Match{}
+	err = Search(context.Background(), world, Query{Entity: func(id string, _ nbt.Compound) bool { return id == "minecraft:zombie" }},
+		func(m Match) error { found[m.Chunk] = append(found[m.Chunk], m); return nil })
+
+	var errs anvil.WalkErrors
+	is(errors.As(err, &errs) && len(errs) == 1 && errs[0].Pos == anvil.ChunkPos{X: 5, Z: 5}, "incorrect error returned: %v", err)
+	is(len(found) == 3, "incorrect number of chunks matched: %d", len(found))
+}
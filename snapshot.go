@@ -0,0 +1,335 @@
+package anvil
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/yehan2002/errors"
+)
+
+// ErrReleased returned by the methods of a [Snapshot] after it was released.
+const ErrReleased = errors.Const("anvil: snapshot released")
+
+// Snapshot a read-only view of an [Anvil] as it was when [Anvil.Snapshot] was called.
+// Reads through the snapshot do not see writes made after the snapshot was taken,
+// including writes made using [Anvil.File], [Walk] and [Merge].
+//
+// Anvil files are captured lazily: the header of an anvil file is copied when it is first
+// modified after the snapshot was taken. Until the snapshot is released, the sections freed by
+// writes to captured files are not reused, external files that are overwritten are kept in memory,
+// and captured files are kept open. Snapshots should be released using [Snapshot.Release]
+// as soon as they are no longer used.
+// All methods can be called concurrently.
+type Snapshot struct {
+	anvil *Anvil
+	time  time.Time
+
+	mux      sync.RWMutex
+	captures map[pos]*capture
+	released bool
+	// reads the number of reads in progress.
+	reads sync.WaitGroup
+}
+
+// capture the header of an anvil file as it was when a snapshot was taken.
+type capture struct {
+	f       *file
+	entries [Entries]Entry
+	// external the previous content of external files that were overwritten after the capture.
+	external map[uint16][]byte
+	// empty if the file did not contain any entries when it was captured.
+	empty bool
+}
+
+// Get gets the captured entry at x,z.
+func (c *capture) Get(x, z uint8) *Entry { return &c.entries[uint16(x&0x1f)|(uint16(z&0x1f)<<5)] }
+
+// overwritten returns the previous content of the external file for the entry at x,z
+// if it was overwritten after the capture.
+// This returns false if `c` is nil.
+func (c *capture) overwritten(x, z uint8) (data []byte, ok bool) {
+	if c != nil {
+		data, ok = c.external[uint16(x&0x1f)|(uint16(z&0x1f)<<5)]
+	}
+	return
+}
+
+// Snapshot returns a read-only view of the anvil files as they are now.
+// Writes that are in progress complete before the snapshot is taken.
+// The snapshot must be released using [Snapshot.Release].
+func (a *Anvil) Snapshot() *Snapshot {
+	s := &Snapshot{anvil: a, captures: map[pos]*capture{}}
+
+	a.snapMux.Lock()
+	if a.snapshots == nil {
+		a.snapshots = map[*Snapshot]struct{}{}
+	}
+	s.time = time.Now()
+	a.snapshots[s] = struct{}{}
+	a.snapMux.Unlock()
+	return s
+}
+
+// Time returns when the snapshot was taken.
+func (s *Snapshot) Time() time.Time { return s.time }
+
+// Read reads the content of the entry at the given coordinates as it was when the snapshot was taken.
+func (s *Snapshot) Read(entryX, entryZ int32) (buf []byte, err error) {
+	err = s.with(entryX>>5, entryZ>>5, func(f *file, c *capture) (err error) {
+		buf, err = f.readBytes(uint8(entryX&0x1f), uint8(entryZ&0x1f), c)
+		return
+	})
+	return
+}
+
+// ReadTo reads the entry at x,z as it was when the snapshot was taken to the given [io.ReaderFrom].
+// `reader` must not retain the [io.Reader] passed to it.
+// `reader` must not return before reading has completed.
+func (s *Snapshot) ReadTo(entryX, entryZ int32, reader io.ReaderFrom) (n int64, err error) {
+	err = s.with(entryX>>5, entryZ>>5, func(f *file, c *capture) (err error) {
+		n, err = f.readTo(uint8(entryX&0x1f), uint8(entryZ&0x1f), reader, c)
+		return
+	})
+	return
+}
+
+// ReadFn reads the entry at x,z as it was when the snapshot was taken using the given readFn.
+// `readFn` must not retain the [io.Reader] passed to it.
+// `readFn` must not return before reading has completed.
+func (s *Snapshot) ReadFn(entryX, entryZ int32, readFn func(io.Reader) error) (err error) {
+	_, err = s.ReadTo(entryX, entryZ, &readFromWrapper{fn: readFn})
+	return
+}
+
+// ReadRaw reads the compressed data for the entry at the given coordinates as it was
+// when the snapshot was taken without decompressing it.
+// This also returns the compression method used to compress the data.
+func (s *Snapshot) ReadRaw(entryX, entryZ int32) (buf []byte, method CompressMethod, err error) {
+	err = s.with(entryX>>5, entryZ>>5, func(f *file, c *capture) (err error) {
+		buf, method, err = f.readRawBytes(uint8(entryX&0x1f), uint8(entryZ&0x1f), c)
+		return
+	})
+	return
+}
+
+// Info gets information stored in the anvil header for the given entry when the snapshot was taken.
+func (s *Snapshot) Info(entryX, entryZ int32) (entry Entry, exists bool, err error) {
+	err = s.with(entryX>>5, entryZ>>5, func(f *file, c *capture) error {
+		if f.header == nil {
+			return ErrClosed
+		}
+
+		if c != nil {
+			entry = *c.Get(uint8(entryX&0x1f), uint8(entryZ&0x1f))
+		} else {
+			entry = *f.header.Get(uint8(entryX&0x1f), uint8(entryZ&0x1f))
+		}
+		exists = entry.Exists()
+		return nil
+	})
+	if errors.Is(err, ErrNotExist) {
+		err = nil
+	}
+	return
+}
+
+// Regions returns the positions of all anvil files in the directory that existed when the snapshot was taken.
+// Files that did not contain any data are ignored if they were created or written after the snapshot was taken.
+func (s *Snapshot) Regions() (regions []RegionPos, err error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	if s.released {
+		return nil, ErrReleased
+	}
+
+	var all []RegionPos
+	if all, err = s.anvil.Regions(); err != nil {
+		return nil, err
+	}
+
+	for _, rg := range all {
+		if c, ok := s.captures[pos{rg.X, rg.Z}]; !ok || !c.empty {
+			regions = append(regions, rg)
+		}
+	}
+	return regions, nil
+}
+
+// Release releases the snapshot.
+// This waits for reads in progress to complete, and frees the space held for the snapshot.
+// This function can be called multiple times.
+func (s *Snapshot) Release() (err error) {
+	s.anvil.snapMux.Lock()
+	delete(s.anvil.snapshots, s)
+	s.anvil.snapMux.Unlock()
+
+	s.mux.Lock()
+	s.released = true
+	s.mux.Unlock()
+
+	// reads in progress may still use the captures
+	s.reads.Wait()
+
+	s.mux.Lock()
+	captures := s.captures
+	s.captures = nil
+	s.mux.Unlock()
+
+	for _, c := range captures {
+		if releaseErr := c.f.release(c); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+		if freeErr := s.anvil.free(c.f); freeErr != nil && err == nil {
+			err = freeErr
+		}
+	}
+	return
+}
+
+// with calls fn with the anvil file at rgX, rgZ and its capture while holding the read lock of the file.
+// The capture is nil if the file was not modified since the snapshot was taken.
+func (s *Snapshot) with(rgX, rgZ int32, fn func(f *file, c *capture) error) (err error) {
+	rg := pos{rgX, rgZ}
+
+	s.mux.RLock()
+	if s.released {
+		s.mux.RUnlock()
+		return ErrReleased
+	}
+	c, captured := s.captures[rg]
+	s.reads.Add(1)
+	s.mux.RUnlock()
+	defer s.reads.Done()
+
+	if captured && c.empty {
+		return ErrNotExist
+	} else if !captured {
+		// avoid creating anvil files that did not exist when the snapshot was taken
+		var exists bool
+		if exists, err = s.anvil.exists(rg); err != nil {
+			return err
+		} else if !exists {
+			return ErrNotExist
+		}
+	}
+
+	var f *file
+	if f, err = s.anvil.getScan(rgX, rgZ); err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := s.anvil.free(f); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+
+	// the file may have been captured before the read lock was acquired
+	s.mux.RLock()
+	c = s.captures[rg]
+	s.mux.RUnlock()
+
+	if c != nil && c.empty {
+		return ErrNotExist
+	}
+	return fn(f, c)
+}
+
+// capture captures the current state of the given file if it was not captured already.
+// Callers must hold the write lock of the file and the read lock of `snapMux`.
+func (s *Snapshot) capture(f *file) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, ok := s.captures[f.pos]; ok {
+		return
+	}
+
+	c := &capture{f: f, entries: *f.header.entries, empty: true}
+	for i := range c.entries {
+		if c.entries[i].Exists() {
+			c.empty = false
+			break
+		}
+	}
+	s.captures[f.pos] = c
+	f.captures = append(f.captures, c)
+	f.header.hold()
+
+	// keep the file open until the snapshot is released.
+	// The caller holds a use, so the count can not reach 0 while it is updated.
+	f.useCount.Add(1)
+}
+
+// freeze captures the state of the file for every live snapshot that has not captured it yet.
+// This must be called while holding the write lock before the file is modified,
+// and the returned function must be called after the modification is complete.
+func (a *file) freeze() (done func()) {
+	if a.cache == nil {
+		return func() {}
+	}
+
+	a.cache.snapMux.RLock()
+	for s := range a.cache.snapshots {
+		s.capture(a)
+	}
+	return a.cache.snapMux.RUnlock
+}
+
+// release removes the given capture, and frees the space held for it if there are no other captures.
+func (a *file) release(c *capture) error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	for i, other := range a.captures {
+		if other == c {
+			a.captures = append(a.captures[:i], a.captures[i+1:]...)
+			break
+		}
+	}
+
+	if len(a.captures) == 0 && a.header != nil {
+		return a.header.release()
+	}
+	return nil
+}
+
+// preserveExternal keeps the content of the given external file for the entry at x,z
+// in the captures that reference it before it is overwritten.
+// Callers must hold the write lock.
+func (a *file) preserveExternal(x, z uint8, filename string) (err error) {
+	var data []byte
+	for _, c := range a.captures {
+		entry := c.Get(x, z)
+		if _, ok := c.overwritten(x, z); ok || !entry.Exists() {
+			continue
+		}
+
+		// the sections used by the captured entry are held, so the entry header is unchanged
+		var external bool
+		if _, _, external, err = a.readEntryHeader(entry); err != nil || !external {
+			continue
+		}
+
+		if data == nil {
+			if data, err = afero.ReadFile(a.settings.fs, filename); errors.Is(err, os.ErrNotExist) {
+				// the entry can not be read using the snapshot either
+				return nil
+			} else if err != nil {
+				return errors.Wrap(fmt.Sprintf("anvil: unable to preserve external file for (%d,%d)", x, z), err)
+			}
+		}
+
+		if c.external == nil {
+			c.external = map[uint16][]byte{}
+		}
+		c.external[uint16(x&0x1f)|(uint16(z&0x1f)<<5)] = data
+	}
+	return nil
+}
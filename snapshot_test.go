@@ -0,0 +1,152 @@
+package anvil
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/yehan2002/is/v2"
+)
+
+type snapshotTest struct{}
+
+func TestSnapshot(t *testing.T) { is.SuiteP(t, &snapshotTest{}) }
+
+func (*snapshotTest) TestRead(is is.Is) {
+	a := makeWorld(is, map[[2]int32]int64{{0, 0}: 1, {1, 0}: 1, {40, 40}: 1})
+
+	s := a.Snapshot()
+	defer s.Release()
+
+	is(a.Write(0, 0, []byte{2}) == nil, "unexpected error")
+	is(a.Remove(1, 0) == nil, "unexpected error")
+	is(a.Write(2, 0, []byte{2}) == nil, "unexpected error")
+	is(a.Write(-100, -100, []byte{2}) == nil, "unexpected error")
+
+	data, err := s.Read(0, 0)
+	is(err == nil && data[0] == 1, "incorrect data read from snapshot: %v %s", data, err)
+	data, err = s.Read(1, 0)
+	is(err == nil && data[0] == 1, "removed entry was not read from snapshot: %v %s", data, err)
+	_, err = s.Read(2, 0)
+	is(errors.Is(err, ErrNotExist), "entry written after the snapshot was read: %s", err)
+	_, err = s.Read(-100, -100)
+	is(errors.Is(err, ErrNotExist), "entry written after the snapshot was read: %s", err)
+	data, err = s.Read(40, 40)
+	is(err == nil && data[0] == 1, "incorrect data read from snapshot: %v %s", data, err)
+
+	// regions that were not modified are read from the current header
+	is(a.Write(40, 40, []byte{2}) == nil, "unexpected error")
+	data, err = s.Read(40, 40)
+	is(err == nil && data[0] == 1, "incorrect data read from snapshot: %v %s", data, err)
+
+	_, exists, err := s.Info(2, 0)
+	is(err == nil && !exists, "entry written after the snapshot exists: %s", err)
+
+	regions, err := s.Regions()
+	is(err == nil, "unexpected error: %s", err)
+	is.Equal(regions, []RegionPos{{0, 0}, {1, 1}}, "incorrect regions")
+
+	data, err = a.Read(0, 0)
+	is(err == nil && data[0] == 2, "incorrect data read from anvil: %v %s", data, err)
+
+	is(s.Release() == nil, "unexpected error")
+	is(s.Release() == nil, "unexpected error")
+	_, err = s.Read(0, 0)
+	is(errors.Is(err, ErrReleased), "incorrect error: %s", err)
+}
+
+func (*snapshotTest) TestSpace(is is.Is) {
+	a := makeWorld(is, nil)
+	is(a.Write(0, 0, bytes.Repeat([]byte{1}, 1000)) == nil, "unexpected error")
+	entry, _, err := a.Info(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+
+	s := a.Snapshot()
+	for i := byte(2); i < 10; i++ {
+		is(a.Write(0, 0, bytes.Repeat([]byte{i}, 1000)) == nil, "unexpected error")
+		is(a.Write(1, 0, bytes.Repeat([]byte{i}, 1000)) == nil, "unexpected error")
+
+		current, _, err := a.Info(0, 0)
+		is(err == nil && current.Offset() != entry.Offset(), "space held by the snapshot was reused")
+	}
+
+	data, err := s.Read(0, 0)
+	is(err == nil && bytes.Equal(data, bytes.Repeat([]byte{1}, 1000)), "incorrect data read from snapshot: %s", err)
+	is(s.Release() == nil, "unexpected error")
+
+	// the space is reused after the snapshot is released
+	is(a.Write(2, 0, bytes.Repeat([]byte{1}, 1000)) == nil, "unexpected error")
+	current, _, err := a.Info(2, 0)
+	is(err == nil && current.Offset() == entry.Offset(), "space was not freed: %d != %d", current.Offset(), entry.Offset())
+}
+
+func (*snapshotTest) TestExternal(is is.Is) {
+	a := makeWorld(is, nil)
+	f, err := a.File(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+	defer f.Close()
+	is(f.CompressionMethod(CompressionNone) == nil, "unexpected error")
+
+	old := bytes.Repeat([]byte{1}, 2<<20)
+	is(f.Write(0, 0, old) == nil, "unexpected error")
+
+	s := a.Snapshot()
+	defer s.Release()
+
+	is(f.Write(0, 0, bytes.Repeat([]byte{2}, 2<<20)) == nil, "unexpected error")
+
+	data, err := s.Read(0, 0)
+	is(err == nil && bytes.Equal(data, old), "external file was not preserved: %s", err)
+	data, err = a.Read(0, 0)
+	is(err == nil && data[0] == 2, "incorrect data read from anvil: %s", err)
+}
+
+func (*snapshotTest) TestConcurrent(is is.Is) {
+	a := makeWorld(is, nil)
+	for x := int32(0); x < 64; x++ {
+		is(a.Write(x, 0, bytes.Repeat([]byte{0}, 5000)) == nil, "unexpected error")
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for x := int32(0); x < 4; x++ {
+		wg.Add(1)
+		go func(x int32) {
+			defer wg.Done()
+			for i := byte(1); ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// both entries are always written with the same value
+				if err := a.Write(x, 0, bytes.Repeat([]byte{i}, 5000)); err != nil {
+					is.T().Error(err)
+					return
+				}
+				if err := a.Write(x+32, 0, bytes.Repeat([]byte{i}, 5000)); err != nil {
+					is.T().Error(err)
+					return
+				}
+			}
+		}(x)
+	}
+
+	for i := 0; i < 20; i++ {
+		s := a.Snapshot()
+		for x := int32(0); x < 4; x++ {
+			first, err := s.Read(x, 0)
+			is(err == nil, "unexpected error: %s", err)
+			second, err := s.Read(x+32, 0)
+			is(err == nil, "unexpected error: %s", err)
+
+			// the snapshot may be taken between the two writes, but never during a write
+			is(len(first) == 5000 && bytes.Count(first, first[:1]) == 5000, "torn entry read from snapshot")
+			is(second[0] == first[0] || second[0] == first[0]-1, "inconsistent entries %d, %d", first[0], second[0])
+		}
+		is(s.Release() == nil, "unexpected error")
+	}
+	close(done)
+	wg.Wait()
+}
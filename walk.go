@@ -0,0 +1,164 @@
+package anvil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// WalkError an error that occurred while walking the entry at Pos.
+// If the error occurred while opening or closing an anvil file,
+// Pos is the position of the first entry in the file.
+type WalkError struct {
+	Pos ChunkPos
+	Err error
+}
+
+func (w *WalkError) Error() string {
+	return fmt.Sprintf("anvil: Walk: (%d,%d): %s", w.Pos.X, w.Pos.Z, w.Err)
+}
+
+func (w *WalkError) Unwrap() error { return w.Err }
+
+// WalkErrors the errors that occurred while walking a world.
+type WalkErrors []*WalkError
+
+func (w WalkErrors) Error() string {
+	if len(w) == 1 {
+		return w[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", w[0], len(w)-1)
+}
+
+// Unwrap returns the errors as a slice of errors.
+func (w WalkErrors) Unwrap() []error {
+	errs := make([]error, len(w))
+	for i, err := range w {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Walk calls `fn` with the decompressed data of every entry in the world.
+// Anvil files are walked concurrently by up to `concurrency` goroutines,
+// each of which walks the entries of one file at a time.
+// If the cache is enabled, `concurrency` is limited to [Settings.CacheSize].
+// If `concurrency` is 0, [runtime.NumCPU] is used.
+// Anvil files opened by the walk are not added to the cache, so walking does not evict frequently used files.
+// `fn` must not retain the [io.Reader] passed to it.
+// Errors returned by `fn` do not stop the walk, they are returned as [WalkErrors]
+// once every entry was walked.
+func Walk(ctx context.Context, a *Anvil, concurrency int, fn func(ChunkPos, io.Reader) error) error {
+	regions, err := a.Regions()
+	if err != nil {
+		return err
+	}
+	return WalkRegions(ctx, a, regions, concurrency, fn)
+}
+
+// WalkRegions is the same as [Walk] but only walks the given anvil files.
+func WalkRegions(ctx context.Context, a *Anvil, regions []RegionPos, concurrency int, fn func(ChunkPos, io.Reader) error) error {
+	return a.walk(ctx, regions, concurrency, func(f *file, pos ChunkPos, x, z uint8) error {
+		return f.ReadWith(x, z, func(r io.Reader) error { return fn(pos, r) })
+	})
+}
+
+// WalkModify is the same as [Walk] but writes the data returned by `fn` back to the entry.
+// If `fn` returns nil, the entry is not modified.
+// Modified entries are compressed using the compression method set for the file.
+func WalkModify(ctx context.Context, a *Anvil, concurrency int, fn func(ChunkPos, io.Reader) ([]byte, error)) error {
+	regions, err := a.Regions()
+	if err != nil {
+		return err
+	}
+
+	return a.walk(ctx, regions, concurrency, func(f *file, pos ChunkPos, x, z uint8) error {
+		f.waitQueued(x, z)
+
+		var data []byte
+		err := f.ReadWith(x, z, func(r io.Reader) (err error) { data, err = fn(pos, r); return })
+		if err == nil && data != nil {
+			err = f.Write(x, z, data)
+		}
+		return err
+	})
+}
+
+// walk calls `fn` for every entry in the given regions.
+func (a *Anvil) walk(ctx context.Context, regions []RegionPos, concurrency int, fn func(f *file, pos ChunkPos, x, z uint8) error) error {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	if a.policy != nil && concurrency > a.settings.CacheSize {
+		concurrency = a.settings.CacheSize
+	}
+
+	var mux sync.Mutex
+	var errs WalkErrors
+	addErr := func(pos ChunkPos, err error) {
+		mux.Lock()
+		errs = append(errs, &WalkError{Pos: pos, Err: err})
+		mux.Unlock()
+	}
+
+	queue := make(chan RegionPos)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rg := range queue {
+				a.walkRegion(ctx, rg, fn, addErr)
+			}
+		}()
+	}
+
+	for _, rg := range regions {
+		select {
+		case queue <- rg:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// walkRegion calls `fn` for every entry in the given region.
+func (a *Anvil) walkRegion(ctx context.Context, rg RegionPos, fn func(f *file, pos ChunkPos, x, z uint8) error, addErr func(ChunkPos, error)) {
+	origin := ChunkPos{X: rg.X << 5, Z: rg.Z << 5}
+
+	f, err := a.getScan(rg.X, rg.Z)
+	if err != nil {
+		addErr(origin, err)
+		return
+	}
+
+	for i := 0; i < Entries && ctx.Err() == nil; i++ {
+		x, z := uint8(i&0x1f), uint8(i>>5)
+		if _, exists := f.Info(x, z); !exists {
+			continue
+		}
+
+		pos := ChunkPos{X: origin.X | int32(x), Z: origin.Z | int32(z)}
+		if err = fn(f, pos, x, z); err != nil {
+			addErr(pos, err)
+		}
+	}
+
+	if err = a.free(f); err != nil {
+		addErr(origin, err)
+	}
+}
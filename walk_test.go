@@ -0,0 +1,89 @@
+package anvil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/yehan2002/is/v2"
+)
+
+type walkTest struct{}
+
+func TestWalk(t *testing.T) { is.SuiteP(t, &walkTest{}) }
+
+func (*walkTest) world(is is.Is) *Anvil {
+	world := makeWorld(is, nil)
+	for _, pos := range []ChunkPos{{0, 0}, {1, 0}, {40, 2}, {-3, -70}} {
+		err := world.Write(pos.X, pos.Z, []byte{byte(pos.X), byte(pos.Z)})
+		is(err == nil, "unexpected error: %s", err)
+	}
+	return world
+}
+
+func (w *walkTest) TestWalk(is is.Is) {
+	world := w.world(is)
+
+	var mux sync.Mutex
+	found := map[ChunkPos]bool{}
+	err := Walk(context.Background(), world, 2, func(pos ChunkPos, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		is(err == nil, "unexpected error: %s", err)
+		is(bytes.Equal(data, []byte{byte(pos.X), byte(pos.Z)}), "incorrect data for (%d,%d)", pos.X, pos.Z)
+
+		mux.Lock()
+		found[pos] = true
+		mux.Unlock()
+		return nil
+	})
+	is(err == nil, "unexpected error: %s", err)
+	is(len(found) == 4, "incorrect number of entries walked: %d", len(found))
+}
+
+func (w *walkTest) TestErrors(is is.Is) {
+	world := w.world(is)
+	errTest := errors.New("test")
+
+	err := Walk(context.Background(), world, 0, func(pos ChunkPos, r io.Reader) error {
+		if pos.X == 40 || pos.X == -3 {
+			return errTest
+		}
+		return nil
+	})
+
+	var errs WalkErrors
+	is(errors.As(err, &errs), "incorrect error returned: %s", err)
+	is(len(errs) == 2, "incorrect number of errors: %d", len(errs))
+	is(errors.Is(err, errTest), "errors were not wrapped")
+	for _, e := range errs {
+		is(e.Pos == ChunkPos{40, 2} || e.Pos == ChunkPos{-3, -70}, "incorrect position: %v", e.Pos)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Walk(ctx, world, 0, func(ChunkPos, io.Reader) error { return nil })
+	is(errors.Is(err, context.Canceled), "incorrect error returned: %s", err)
+}
+
+func (w *walkTest) TestModify(is is.Is) {
+	world := w.world(is)
+
+	err := WalkModify(context.Background(), world, 0, func(pos ChunkPos, r io.Reader) ([]byte, error) {
+		if pos.X != 1 {
+			return nil, nil
+		}
+		return []byte{9}, nil
+	})
+	is(err == nil, "unexpected error: %s", err)
+
+	data, err := world.Read(1, 0)
+	is(err == nil, "unexpected error: %s", err)
+	is(bytes.Equal(data, []byte{9}), "entry was not modified")
+
+	data, err = world.Read(0, 0)
+	is(err == nil, "unexpected error: %s", err)
+	is(bytes.Equal(data, []byte{0, 0}), "entry was modified")
+}